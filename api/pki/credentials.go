@@ -0,0 +1,266 @@
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Credentials 本端的证书和信任的CA。证书可以在运行时替换，
+// 之后新建立的连接使用新证书，已经建立的连接不受影响
+type Credentials struct {
+	mu   sync.RWMutex
+	cert tls.Certificate
+	pool *x509.CertPool
+}
+
+// NewCredentials 从PEM格式的证书、私钥和CA证书创建
+func NewCredentials(certPEM, keyPEM, caPEM []byte) (*Credentials, error) {
+	c := &Credentials{}
+	if err := c.Update(certPEM, keyPEM, caPEM); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCredentials 从dir读取 name.crt、name.key 和 ca.crt
+func LoadCredentials(dir, name string) (*Credentials, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, name+".crt"))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, name+".key"))
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, CACertFile))
+	if err != nil {
+		return nil, err
+	}
+	return NewCredentials(certPEM, keyPEM, caPEM)
+}
+
+// SaveCredentials 把证书、私钥和CA证书写入dir，私钥只有自己可读
+func SaveCredentials(dir, name string, certPEM, keyPEM, caPEM []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{name + ".key", keyPEM, 0o600},
+		{name + ".crt", certPEM, 0o644},
+		{CACertFile, caPEM, 0o644},
+	}
+	for _, f := range files {
+		// 先写临时文件再改名，进程中途退出时不会留下不完整的文件
+		tmp := filepath.Join(dir, f.name+".tmp")
+		if err := os.WriteFile(tmp, f.data, f.perm); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, f.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update 替换证书，证书必须由给定的CA签发
+func (c *Credentials) Update(certPEM, keyPEM, caPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	ca, err := parseCert(caPEM)
+	if err != nil {
+		return fmt.Errorf("CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("certificate not issued by the CA: %w", err)
+	}
+	// 证书链带上CA证书，第一次连接的工作节点要用它核对CA的指纹
+	cert.Certificate = append(cert.Certificate, ca.Raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = cert
+	c.pool = pool
+	return nil
+}
+
+func (c *Credentials) current() (tls.Certificate, *x509.CertPool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, c.pool
+}
+
+// Leaf 当前的证书
+func (c *Credentials) Leaf() *x509.Certificate {
+	cert, _ := c.current()
+	return cert.Leaf
+}
+
+// RenewAt 应该续期的时间：有效期过去三分之二的时候
+func (c *Credentials) RenewAt() time.Time {
+	leaf := c.Leaf()
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(lifetime * 2 / 3)
+}
+
+// ServerConfig 服务端的TLS配置，每次握手使用当前的证书。
+// allow不为空时，客户端证书还要通过allow的检查
+func (c *Credentials) ServerConfig(clientAuth tls.ClientAuthType, allow func(*x509.Certificate) error) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := c.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    pool,
+				ClientAuth:   clientAuth,
+				// 返回的配置不会继承外层的ALPN，gRPC要求协商出h2
+				NextProtos: []string{"h2"},
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					if allow == nil || len(cs.PeerCertificates) == 0 {
+						return nil
+					}
+					return allow(cs.PeerCertificates[0])
+				},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig 客户端的TLS配置，每次握手使用当前的证书。
+// 同一个CA签发的证书都能通过验证，allow检查服务端是不是要连接的那一个
+func (c *Credentials) ClientConfig(allow func(*x509.Certificate) error) *tls.Config {
+	_, pool := c.current()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return &cert, nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || allow == nil {
+				return errors.New("cannot verify the identity of the peer")
+			}
+			return allow(cs.PeerCertificates[0])
+		},
+	}
+}
+
+// AllowCommonName 只接受CN为names之一的对端证书
+func AllowCommonName(names ...string) func(*x509.Certificate) error {
+	return func(cert *x509.Certificate) error {
+		for _, name := range names {
+			if cert.Subject.CommonName == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("peer certificate %q is not allowed", cert.Subject.CommonName)
+	}
+}
+
+// BootstrapConfig 工作节点第一次连接master时使用的TLS配置。
+// 这时还没有CA证书，要求master发来的证书链中有指纹为caHash的CA，并且证书由它签发
+func BootstrapConfig(caHash string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 不使用系统的CA，改为在VerifyPeerCertificate中按指纹核对
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPinned(rawCerts, caHash)
+		},
+	}
+}
+
+func verifyPinned(rawCerts [][]byte, caHash string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("master presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	for _, ca := range certs[1:] {
+		if Hash(ca) != caHash {
+			continue
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+	return fmt.Errorf("master certificate is not issued by the CA %s", caHash)
+}
+
+// PeerCommonName gRPC对端证书的CN，对端没有出示经过验证的证书时返回false
+func PeerCommonName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// 续期失败后重试的间隔
+const rotateRetryInterval = time.Minute
+
+// Rotate 在证书有效期过去三分之二时调用renew换新证书，直到stop被关闭。
+// renew返回新的证书、私钥和CA证书，失败时过一段时间重试
+func Rotate(c *Credentials, renew func() (certPEM, keyPEM, caPEM []byte, err error), stop <-chan struct{}) {
+	for {
+		wait := time.Until(c.RenewAt())
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		certPEM, keyPEM, caPEM, err := renew()
+		if err == nil {
+			err = c.Update(certPEM, keyPEM, caPEM)
+		}
+		if err != nil {
+			log.Printf("证书续期失败: %v", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(rotateRetryInterval):
+			}
+			continue
+		}
+		log.Printf("证书已续期，新证书有效期到 %s", c.Leaf().NotAfter.Format(time.RFC3339))
+	}
+}
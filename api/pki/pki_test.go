@@ -0,0 +1,134 @@
+package pki
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAuthorityReload(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateAuthority(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadOrCreateAuthority(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.Hash() != again.Hash() {
+		t.Fatal("重新加载后CA变了")
+	}
+	if err := VerifyCAHash(again.CertPEM(), ca.Hash()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsRotate(t *testing.T) {
+	ca, err := LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.Issue("node-1", []string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := NewCredentials(certPEM, keyPEM, ca.CertPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := creds.ServerConfig(0, nil)
+	served := func() string {
+		config, err := server.GetConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.Certificates[0].Leaf.SerialNumber.String()
+	}
+	old := served()
+
+	// 替换证书后新的握手使用新证书
+	certPEM, keyPEM, _ = ca.Issue("node-1", []string{"127.0.0.1"}, time.Hour)
+	if err := creds.Update(certPEM, keyPEM, ca.CertPEM()); err != nil {
+		t.Fatal(err)
+	}
+	if served() == old {
+		t.Fatal("替换证书后仍然使用旧证书")
+	}
+	if renew := creds.RenewAt(); !renew.After(time.Now().Add(30*time.Minute)) || !renew.Before(time.Now().Add(time.Hour)) {
+		t.Fatalf("续期时间 %v 应该在有效期过去三分之二的时候", renew)
+	}
+
+	// 其他CA签发的证书不能替换进来
+	other, _ := LoadOrCreateAuthority(t.TempDir())
+	certPEM, keyPEM, _ = other.Issue("node-1", nil, time.Hour)
+	if err := creds.Update(certPEM, keyPEM, ca.CertPEM()); err == nil {
+		t.Fatal("其他CA签发的证书应该被拒绝")
+	}
+}
+
+// 用服务端和客户端的配置完成一次握手，返回客户端的错误
+func handshake(server, client *tls.Config) error {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	go tls.Server(s, server).Handshake()
+	return tls.Client(c, client).Handshake()
+}
+
+func TestClientChecksPeerName(t *testing.T) {
+	ca, err := LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(name string) *Credentials {
+		certPEM, keyPEM, err := ca.Issue(name, []string{"127.0.0.1"}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds, err := NewCredentials(certPEM, keyPEM, ca.CertPEM())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds
+	}
+	node1, node2 := issue("node-1"), issue("node-2")
+	server := node1.ServerConfig(tls.RequireAndVerifyClientCert, nil)
+
+	// 同一个CA签发的证书，名字不对也不接受：节点不能冒充master或者其他节点
+	for _, name := range []string{MasterName, "node-2"} {
+		client := node2.ClientConfig(AllowCommonName(name))
+		client.ServerName = "127.0.0.1"
+		if err := handshake(server, client); err == nil {
+			t.Fatalf("期望对端是 %s 时不应该接受 node-1", name)
+		}
+	}
+	client := node2.ClientConfig(AllowCommonName("node-1"))
+	client.ServerName = "127.0.0.1"
+	if err := handshake(server, client); err != nil {
+		t.Fatalf("连接 node-1 失败: %v", err)
+	}
+}
+
+func TestSignIgnoresRequestedHosts(t *testing.T) {
+	ca, err := LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, csrPEM, err := NewKeyAndCSR("node-1", []string{"master.example.com", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.Sign(csrPEM, "node-1", []string{"10.0.0.2"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseCert(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "10.0.0.2" {
+		t.Fatalf("证书的地址 %v %v，期望只有 10.0.0.2", cert.DNSNames, cert.IPAddresses)
+	}
+}
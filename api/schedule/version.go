@@ -0,0 +1,38 @@
+package schedule
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sche.proto
+
+import "fmt"
+
+// 当前的接口版本。修改sche.proto时：只增加字段、接口或命令时增加次版本号，
+// 删除或改变已有字段的含义时增加主版本号
+// v1.1 增加了JoinService
+// v1.2 心跳增加了GPU信息的采集时间
+// v1.3 注册时上报节点上现有的实例
+// v1.4 组调度的成员在启动前预留分布式组的端口
+const (
+	APIMajor = 1
+	APIMinor = 4
+)
+
+// CurrentVersion 当前的接口版本
+func CurrentVersion() *APIVersion {
+	return &APIVersion{Major: APIMajor, Minor: APIMinor}
+}
+
+// Compatible 对端的接口版本能否和当前版本通信，不能通信时返回原因。
+// 没有版本的对端是加入版本号之前的旧程序
+func Compatible(peer *APIVersion) error {
+	if peer == nil || peer.GetMajor() == 0 {
+		return fmt.Errorf("peer did not report an API version, it predates v%d.0; upgrade it to v%d.x", APIMajor, APIMajor)
+	}
+	if peer.GetMajor() != APIMajor {
+		return fmt.Errorf("peer speaks API v%s, this side speaks v%s; major versions must match", FormatVersion(peer), FormatVersion(CurrentVersion()))
+	}
+	return nil
+}
+
+// FormatVersion 把版本格式化成 "1.0"
+func FormatVersion(v *APIVersion) string {
+	return fmt.Sprintf("%d.%d", v.GetMajor(), v.GetMinor())
+}
@@ -0,0 +1,231 @@
+// Package catalog 模型目录，master和工作节点从同一个文件读取模型的定义：
+// 显存需求、镜像、启动命令、环境变量、挂载、健康检查和资源限制
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 没有指定目录文件时使用的内置目录
+//
+//go:embed models.json
+var defaultCatalog []byte
+
+// 默认值
+const (
+	// 实例默认的空闲超时时间
+	DefaultIdleTTL = 30 * time.Minute
+	// 默认等待模型服务就绪的最长时间
+	DefaultReadyTimeout = 5 * time.Minute
+	// 默认的健康检查路径
+	DefaultProbePath = "/health"
+)
+
+// Catalog 模型目录，key是模型名
+type Catalog struct {
+	Models map[string]Model `json:"models"`
+}
+
+// Model 一个模型的定义
+type Model struct {
+	// 容器镜像，调度时优先选择已经缓存了镜像的节点
+	Image   string            `json:"image"`
+	Command []string          `json:"command,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// 主机路径 -> 容器内路径
+	Mounts map[string]string `json:"mounts,omitempty"`
+
+	// 模型加载后占用的显存，0表示只使用CPU，不占用GPU
+	GPUMemoryMB uint64 `json:"gpu_memory_mb"`
+	// 模型最多可以切分到几张GPU上，0或1表示只能放在单张GPU上
+	MaxGPUs int `json:"max_gpus,omitempty"`
+	// 单个节点放不下时，模型最多可以切分到几个节点上，0或1表示只能放在单个节点上
+	MaxNodes int `json:"max_nodes,omitempty"`
+	// 一个实例同时处理的任务数上限，0表示使用默认值
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// 实例独占分配给它的GPU
+	Exclusive bool `json:"exclusive,omitempty"`
+
+	// 实例空闲多久后卸载，0表示使用默认值，负数表示不卸载
+	IdleTTL Duration `json:"idle_ttl,omitempty"`
+	Probe   Probe    `json:"probe"`
+	// 容器的CPU、内存、共享内存等限制
+	Resources Resources `json:"resources"`
+}
+
+// Probe 模型服务的健康检查
+type Probe struct {
+	// 健康检查路径，为空时使用DefaultProbePath
+	Path string `json:"path,omitempty"`
+	// 两次探测之间的间隔，0表示由工作节点决定
+	Interval Duration `json:"interval,omitempty"`
+	// 等待模型服务就绪的最长时间，0表示使用默认值
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// Duration 在JSON中写成"30m"这样的字符串
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30m\": %s", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// IdleTimeout 实例的空闲超时时间，0表示不卸载
+func (m Model) IdleTimeout() time.Duration {
+	switch ttl := time.Duration(m.IdleTTL); {
+	case ttl < 0:
+		return 0
+	case ttl == 0:
+		return DefaultIdleTTL
+	default:
+		return ttl
+	}
+}
+
+// ReadyTimeout 等待模型服务就绪的最长时间
+func (m Model) ReadyTimeout() time.Duration {
+	if timeout := time.Duration(m.Probe.Timeout); timeout > 0 {
+		return timeout
+	}
+	return DefaultReadyTimeout
+}
+
+// ProbePath 健康检查路径
+func (m Model) ProbePath() string {
+	if m.Probe.Path != "" {
+		return m.Probe.Path
+	}
+	return DefaultProbePath
+}
+
+// Default 内置的模型目录
+func Default() *Catalog {
+	c, err := Parse(defaultCatalog)
+	if err != nil {
+		panic(fmt.Sprintf("内置模型目录不合法: %v", err))
+	}
+	return c
+}
+
+// Load 从文件读取模型目录并校验，扩展名是 .yaml 或 .yml 时按YAML解析，否则按JSON解析
+func Load(file string) (*Catalog, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parse := Parse
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		parse = ParseYAML
+	}
+	c, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return c, nil
+}
+
+// Parse 解析并校验模型目录，拼错的字段名也会报错
+func Parse(data []byte) (*Catalog, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c Catalog
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ParseYAML 解析并校验YAML格式的模型目录，字段名和JSON格式相同。
+// 先转换成JSON再解析，拼错的字段名同样会报错
+func ParseYAML(data []byte) (*Catalog, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("catalog cannot be converted to JSON: %w", err)
+	}
+	return Parse(converted)
+}
+
+// Validate 检查所有模型的定义，返回所有不合法的条目
+func (c *Catalog) Validate() error {
+	if len(c.Models) == 0 {
+		return errors.New("catalog has no models")
+	}
+	names := make([]string, 0, len(c.Models))
+	for name := range c.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := c.Models[name].validate(name); err != nil {
+			errs = append(errs, fmt.Errorf("model %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Model) validate(name string) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(strings.TrimSpace(name) == name && name != "", "name must not be empty or contain surrounding spaces")
+	check(m.Image != "", "image is required")
+	check(m.MaxGPUs >= 0, "max_gpus must not be negative")
+	check(m.MaxNodes >= 0, "max_nodes must not be negative")
+	check(m.MaxConcurrency >= 0, "max_concurrency must not be negative")
+
+	for k := range m.Env {
+		check(k != "" && !strings.Contains(k, "="), "invalid env name %q", k)
+	}
+	for src, dst := range m.Mounts {
+		check(path.IsAbs(src) && path.IsAbs(dst), "mount %s:%s must use absolute paths", src, dst)
+	}
+
+	check(m.Probe.Path == "" || strings.HasPrefix(m.Probe.Path, "/"), "probe path %q must start with /", m.Probe.Path)
+	check(m.Probe.Interval >= 0 && m.Probe.Timeout >= 0, "probe interval and timeout must not be negative")
+	check(m.Probe.Interval == 0 || time.Duration(m.Probe.Interval) < m.ReadyTimeout(),
+		"probe interval %v must be shorter than the ready timeout %v", time.Duration(m.Probe.Interval), m.ReadyTimeout())
+
+	if err := m.Resources.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resources: %w", err))
+	}
+	return errors.Join(errs...)
+}
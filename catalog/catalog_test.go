@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefault(t *testing.T) {
+	m, exists := Default().Models["llama3-8b"]
+	if !exists {
+		t.Fatal("内置目录里没有llama3-8b")
+	}
+	if m.GPUMemoryMB != 16*1024 || m.IdleTimeout() != DefaultIdleTTL || m.ProbePath() != "/health" {
+		t.Errorf("llama3-8b = %+v", m)
+	}
+}
+
+func TestParseReportsInconsistentEntries(t *testing.T) {
+	_, err := Parse([]byte(`{"models": {
+		"ok": {"image": "a", "gpu_memory_mb": 1},
+		"no-image": {"gpu_memory_mb": 1},
+		"cpu-only": {"image": "b", "gpu_memory_mb": 0},
+		"gang": {"image": "b", "gpu_memory_mb": 1, "max_nodes": 2},
+		"bad-gang": {"image": "b", "gpu_memory_mb": 1, "max_nodes": -1},
+		"probe": {"image": "c", "gpu_memory_mb": 1, "probe": {"path": "health", "interval": "10m", "timeout": "1m"}}
+	}}`))
+	if err == nil {
+		t.Fatal("不合法的目录应该报错")
+	}
+	for _, want := range []string{`"no-image": image is required`, `"bad-gang": max_nodes must not be negative`, `must start with /`, `must be shorter`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("错误 %q 里没有 %q", err, want)
+		}
+	}
+	for _, name := range []string{`"ok"`, `"cpu-only"`, `"gang"`} {
+		if strings.Contains(err.Error(), name) {
+			t.Errorf("合法的条目 %s 也报错了: %v", name, err)
+		}
+	}
+
+	// 拼错的字段名
+	if _, err := Parse([]byte(`{"models": {"a": {"image": "a", "gpu_memory": 1}}}`)); err == nil {
+		t.Error("未知字段应该报错")
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "models.yaml")
+	content := `models:
+  qwen-7b:
+    image: qwen:v1
+    gpu_memory_mb: 15360
+    idle_ttl: 10m
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Models["qwen-7b"]
+	if m.Image != "qwen:v1" || m.GPUMemoryMB != 15360 || m.IdleTimeout() != 10*time.Minute {
+		t.Errorf("qwen-7b = %+v", m)
+	}
+
+	// 拼错的字段名
+	if _, err := ParseYAML([]byte("models:\n  a:\n    image: a\n    gpu_memory: 1\n")); err == nil {
+		t.Error("未知字段应该报错")
+	}
+}
+
+func TestWatchReloadsValidChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "models.json")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, mtime, mtime)
+	}
+	start := time.Now()
+	write(`{"models": {"a": {"image": "a", "gpu_memory_mb": 1}}}`, start)
+
+	reloaded := make(chan *Catalog, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Watch(file, 10*time.Millisecond, stop, func(c *Catalog) { reloaded <- c })
+
+	// 不合法的修改被忽略
+	write(`{"models": {"a": {}}}`, start.Add(time.Second))
+	select {
+	case c := <-reloaded:
+		t.Fatalf("不合法的目录被加载了: %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	write(`{"models": {"b": {"image": "b", "gpu_memory_mb": 2}}}`, start.Add(2*time.Second))
+	select {
+	case c := <-reloaded:
+		if _, exists := c.Models["b"]; !exists {
+			t.Errorf("重新加载的目录 = %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("修改后没有重新加载")
+	}
+}
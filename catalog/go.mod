@@ -0,0 +1,5 @@
+module catalog
+
+go 1.24.1
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,44 @@
+package catalog
+
+import "strings"
+
+// Docker Hub的registry，没有写registry的镜像都从这里拉取
+const defaultRegistry = "docker.io"
+
+// NormalizeImage 把镜像引用补全成完整的形式，同一个镜像的不同写法得到相同的结果：
+// 没有registry时使用docker.io，docker.io上只有一段的名称放在library下，
+// 没有tag和digest时使用latest。例如 nginx 补全成 docker.io/library/nginx:latest
+func NormalizeImage(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	name, digest, has_digest := strings.Cut(ref, "@")
+
+	// 第一段带有.或者:（端口），或者是localhost时才是registry
+	registry, path, found := strings.Cut(name, "/")
+	if !found || (!strings.ContainsAny(registry, ".:") && registry != "localhost") {
+		registry, path = defaultRegistry, name
+	}
+	if registry == "index.docker.io" {
+		registry = defaultRegistry
+	}
+	if registry == defaultRegistry && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	// registry已经去掉，剩下部分中的:只能是tag的分隔符
+	if !has_digest && !strings.Contains(path, ":") {
+		path += ":latest"
+	}
+
+	normalized := registry + "/" + path
+	if has_digest {
+		normalized += "@" + digest
+	}
+	return normalized
+}
+
+// SameImage 两个镜像引用是否指向同一个镜像
+func SameImage(a, b string) bool {
+	return a != "" && b != "" && NormalizeImage(a) == NormalizeImage(b)
+}
@@ -0,0 +1,30 @@
+package catalog
+
+import "testing"
+
+func TestNormalizeImage(t *testing.T) {
+	cases := map[string]string{
+		"nginx":                              "docker.io/library/nginx:latest",
+		"nginx:latest":                       "docker.io/library/nginx:latest",
+		"docker.io/nginx":                    "docker.io/library/nginx:latest",
+		"index.docker.io/library/nginx:1.25": "docker.io/library/nginx:1.25",
+		"vllm/vllm-openai:v0.6.0":            "docker.io/vllm/vllm-openai:v0.6.0",
+		"registry.local:5000/llm/server":     "registry.local:5000/llm/server:latest",
+		"localhost/server:dev":               "localhost/server:dev",
+		"ghcr.io/org/model@sha256:abc":       "ghcr.io/org/model@sha256:abc",
+		"model:v1":                           "docker.io/library/model:v1",
+		"":                                   "",
+	}
+	for ref, want := range cases {
+		if got := NormalizeImage(ref); got != want {
+			t.Errorf("NormalizeImage(%q) = %q，期望 %q", ref, got, want)
+		}
+	}
+
+	if !SameImage("nginx", "docker.io/library/nginx:latest") {
+		t.Error("nginx 和 docker.io/library/nginx:latest 是同一个镜像")
+	}
+	if SameImage("nginx:1.25", "nginx") || SameImage("", "") {
+		t.Error("不同的tag和空引用不是同一个镜像")
+	}
+}
@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 重启策略，含义和Docker的--restart相同
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartAlways        = "always"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// Resources 模型容器的资源限制和运行参数，零值表示不限制、使用运行时的默认值
+type Resources struct {
+	// 可以使用的CPU核数，可以是小数，比如1.5
+	CPUs float64 `json:"cpus,omitempty"`
+	// 内存上限，超过后容器被OOM结束
+	MemoryMB uint64 `json:"memory_mb,omitempty"`
+	// /dev/shm的大小，推理服务的多进程和NCCL通信需要较大的共享内存
+	ShmSizeMB uint64   `json:"shm_size_mb,omitempty"`
+	Ulimits   []Ulimit `json:"ulimits,omitempty"`
+	// IPC命名空间：private、shareable、host、none或container:<名称>，
+	// 使用host时ShmSizeMB不起作用
+	IPCMode string `json:"ipc_mode,omitempty"`
+	// 容器退出后的重启策略，MaxRetries只对on-failure有效
+	RestartPolicy string `json:"restart_policy,omitempty"`
+	MaxRetries    int    `json:"max_retries,omitempty"`
+	// 特权模式会让容器看到宿主机的所有设备，只在确实需要时打开
+	Privileged bool `json:"privileged,omitempty"`
+}
+
+// Ulimit 容器进程的资源上限，-1表示不限制
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// Validate 检查资源配置是否合法
+func (r Resources) Validate() error {
+	if r.CPUs < 0 {
+		return fmt.Errorf("cpus must not be negative: %v", r.CPUs)
+	}
+	// Docker要求内存上限至少6MB
+	if r.MemoryMB > 0 && r.MemoryMB < 6 {
+		return fmt.Errorf("memory limit %dMB is too small", r.MemoryMB)
+	}
+
+	switch r.IPCMode {
+	case "", "private", "shareable", "host", "none":
+	default:
+		if !strings.HasPrefix(r.IPCMode, "container:") {
+			return fmt.Errorf("unknown ipc mode %q", r.IPCMode)
+		}
+	}
+	if r.IPCMode == "host" && r.ShmSizeMB > 0 {
+		return fmt.Errorf("shm size has no effect with ipc mode host")
+	}
+
+	switch r.RestartPolicy {
+	case "", RestartNo, RestartAlways, RestartUnlessStopped:
+		if r.MaxRetries != 0 {
+			return fmt.Errorf("max retries is only valid with restart policy %s", RestartOnFailure)
+		}
+	case RestartOnFailure:
+		if r.MaxRetries < 0 {
+			return fmt.Errorf("max retries must not be negative: %d", r.MaxRetries)
+		}
+	default:
+		return fmt.Errorf("unknown restart policy %q", r.RestartPolicy)
+	}
+
+	for _, u := range r.Ulimits {
+		if u.Name == "" {
+			return fmt.Errorf("ulimit name is required")
+		}
+		if u.Soft != -1 && u.Hard != -1 && u.Soft > u.Hard {
+			return fmt.Errorf("ulimit %s: soft limit %d exceeds hard limit %d", u.Name, u.Soft, u.Hard)
+		}
+	}
+	return nil
+}
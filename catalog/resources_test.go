@@ -0,0 +1,33 @@
+package catalog
+
+import "testing"
+
+func TestResourcesValidate(t *testing.T) {
+	valid := []Resources{
+		{},
+		Default().Models["llama3-8b"].Resources,
+		{IPCMode: "host"},
+		{IPCMode: "container:ls-inst-1"},
+		{RestartPolicy: RestartOnFailure, MaxRetries: 3},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("%+v 应该合法: %v", r, err)
+		}
+	}
+
+	invalid := []Resources{
+		{CPUs: -1},
+		{MemoryMB: 1},
+		{IPCMode: "shared"},
+		{IPCMode: "host", ShmSizeMB: 1024},
+		{RestartPolicy: "sometimes"},
+		{RestartPolicy: RestartAlways, MaxRetries: 3},
+		{Ulimits: []Ulimit{{Name: "nofile", Soft: 2048, Hard: 1024}}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v 应该不合法", r)
+		}
+	}
+}
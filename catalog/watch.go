@@ -0,0 +1,47 @@
+package catalog
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// 默认检查目录文件是否变化的间隔
+const DefaultWatchInterval = 5 * time.Second
+
+// Watch 每隔interval检查一次目录文件的修改时间，文件变化并且校验通过时调用onChange。
+// 校验失败时记录错误并继续使用之前的目录，直到stop被关闭
+func Watch(file string, interval time.Duration, stop <-chan struct{}, onChange func(*Catalog)) {
+	var last time.Time
+	if info, err := os.Stat(file); err == nil {
+		last = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Printf("检查模型目录 %s 失败: %v", file, err)
+			continue
+		}
+		if info.ModTime().Equal(last) {
+			continue
+		}
+		last = info.ModTime()
+
+		c, err := Load(file)
+		if err != nil {
+			log.Printf("模型目录不合法，继续使用之前的目录: %v", err)
+			continue
+		}
+		log.Printf("重新加载模型目录 %s，共 %d 个模型", file, len(c.Models))
+		onChange(c)
+	}
+}
@@ -1,14 +1,14 @@
 package cluster
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net"
-	"net/http"
 	"sync"
 	"time"
+
+	"api/pki"
+
+	"google.golang.org/grpc"
 )
 
 type ClusterManager struct {
@@ -16,10 +16,26 @@ type ClusterManager struct {
 	nodes     map[string]*Node
 	heartbeat time.Duration
 	timeout   time.Duration
+	// 控制流断开后等待节点重新连接的时间，超过后节点下线
+	reconnectGrace time.Duration
 	// 设置一个通道，用于在不同goroutine之间通信
 	// 当这个通道监听到信号，则停止健康检查
-	stopChan   chan struct{}
-	httpServer *http.Server
+	stopChan chan struct{}
+	// 接收工作节点控制流的gRPC服务器
+	grpcServer *grpc.Server
+	// 已经连接的工作节点的控制流，key是节点ID
+	sessions    map[string]*nodeSession
+	nextCommand uint64
+	// 启用双向TLS时的CA和master自己的证书，未启用时为nil
+	ca    *pki.Authority
+	creds *pki.Credentials
+	// 还没有使用的加入令牌，key是令牌的哈希，value是过期时间
+	joinTokens map[string]time.Time
+	// 显存预留账本，key是预留ID
+	reservations    map[string]*Reservation
+	nextReservation uint64
+	// 模型实例登记表，key是实例ID
+	instances map[string]*Instance
 }
 
 // 创建一个新的集群管理器
@@ -29,17 +45,34 @@ func NewClusterManager(heartbeat, timeout time.Duration) *ClusterManager {
 		heartbeat: heartbeat,
 		timeout:   timeout,
 		stopChan:  make(chan struct{}),
+		sessions:  make(map[string]*nodeSession),
+
+		reconnectGrace: DefaultReconnectGrace,
+
+		joinTokens: make(map[string]time.Time),
+
+		reservations: make(map[string]*Reservation),
+		instances:    make(map[string]*Instance),
 	}
 }
 
+// 登记节点。已经登记过的节点（例如控制流断开后重新连接）保留实例和显存预留，
+// 只更新地址，节点换了IP时它上面的实例也跟着更新
 func (cm *ClusterManager) RegisterNode(id, ip, port string) error {
 	// 加锁，函数返回时解锁
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	// 如果节点已经注册，这期间又收到相同节点的注册请求，直接返回
-	_, exits := cm.nodes[id]
-	if exits {
+	if node, exists := cm.nodes[id]; exists {
+		if node.IP != ip || node.Port != port {
+			log.Printf("Node %s moved from %s:%s to %s:%s", id, node.IP, node.Port, ip, port)
+			cm.moveNodeInstances(id, ip)
+		}
+		node.IP = ip
+		node.Port = port
+		node.LastActive = time.Now()
+		node.DisconnectedAt = time.Time{}
+		node.Status = node.onlineStatus()
 		return nil
 	}
 
@@ -61,8 +94,9 @@ func (cm *ClusterManager) RegisterNode(id, ip, port string) error {
 	return nil
 }
 
-// 更新节点的心跳时间为现在，状态设置为健康
-func (cm *ClusterManager) UpdateHeartbeat(nodeID string) error {
+// 更新节点的心跳时间为现在，状态设置为健康，并用上报的GPU信息对账显存预留。
+// sampledAt是工作节点采集GPU信息的时间，不是master收到心跳的时间
+func (cm *ClusterManager) UpdateHeartbeat(nodeID string, gpus map[string]GPU, sampledAt time.Time) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 	// 取出节点，把时间更新为现在
@@ -77,10 +111,32 @@ func (cm *ClusterManager) UpdateHeartbeat(nodeID string) error {
 	}
 
 	node.LastActive = time.Now()
-	node.Status = "online"
+	node.Status = node.onlineStatus()
+	node.GPUs = gpus
+	cm.reconcileReservations(nodeID, sampledAt)
+	return nil
+}
+
+// UpdateImages 更新节点上已经缓存的镜像
+func (cm *ClusterManager) UpdateImages(nodeID string, images []string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	node, exists := cm.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+	node.Images = images
 	return nil
 }
 
+// 移除下线的节点，以及它上面的实例和显存预留，调用方需要持有锁
+func (cm *ClusterManager) removeNodeLocked(nodeID string) {
+	delete(cm.nodes, nodeID)
+	cm.dropNodeInstances(nodeID)
+	cm.dropNodeReservations(nodeID)
+}
+
 // 启动健康检查
 func (cm *ClusterManager) StartHealthCheck() {
 	// 每隔heartbeat发送一次检查信号
@@ -108,11 +164,20 @@ func (cm *ClusterManager) checkNodeHealth() {
 	now := time.Now()
 	// 遍历所有节点，计算上次活跃到现在的时间差
 	for id, node := range cm.nodes {
+		// 控制流断开的节点在宽限期内没有重新连接，视为下线
+		if !node.DisconnectedAt.IsZero() {
+			if now.Sub(node.DisconnectedAt) > cm.reconnectGrace {
+				node.Status = "offline"
+				log.Printf("Node %s did not reconnect within %v", id, cm.reconnectGrace)
+				cm.removeNodeLocked(id)
+			}
+			continue
+		}
 		// 如果时间差大于预设的超时时间，则把节点标记为离线，并且把它从节点中去除
 		if now.Sub(node.LastActive) > cm.timeout {
 			node.Status = "offline"
 			log.Printf("Node %s is offline (last active: %v)", id, node.LastActive)
-			delete(cm.nodes, id)
+			cm.removeNodeLocked(id)
 			// 如果只是大于超时的一半，则标记为不健康
 		} else if now.Sub(node.LastActive) > cm.timeout/2 {
 			node.Status = "unhealthy"
@@ -121,120 +186,14 @@ func (cm *ClusterManager) checkNodeHealth() {
 	}
 }
 
-// 启动http服务器，用于处理节点注册和心跳
-func (cm *ClusterManager) StartHeartbeatHTTPServer(port string) error {
-	// 创建一个http请求多路复用器mux，可以把不同请求路径路由给对应处理函数
-	mux := http.NewServeMux()
-	mux.HandleFunc("/register", cm.handleRegister)
-	mux.HandleFunc("/heartbeat", cm.handleHeartbeat)
-
-	// 创建一个http服务器实例，指明访问端口和处理器
-	cm.httpServer = &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
-	}
-
-	// 创建一个tcp监听器，监听http服务器指明的端口
-	listener, err := net.Listen("tcp", cm.httpServer.Addr)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Heartbeat HTTP server listening on %s", cm.httpServer.Addr)
-
-	if err := cm.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
-		log.Printf("HTTP server error: %v", err)
-	}
-
-	return nil
-
-}
-
 // 停止集群管理器
 func (cm *ClusterManager) Stop() {
 	// 关闭通道，所有监听这个通道的goroutine都会停止执行
 	close(cm.stopChan)
-	if cm.httpServer != nil {
-		// 创建一个带有5秒超时的上下文
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		// 在函数返回时，无论是否超时，都调用cancel取消上下文，释放资源
-		defer cancel()
-		// httpServer.Shutdown，优雅地关闭http服务器
-		// 即等待正在进行的请求处理完毕，但一旦上下文超时，会立刻关闭服务器
-		if err := cm.httpServer.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
-		}
-	}
-}
-
-// 处理注册节点
-func (cm *ClusterManager) handleRegister(w http.ResponseWriter, r *http.Request) {
-	// 如果不是post方法，使用http.Error函数向客户端返回一个错误响应
-	if r.Method != "POST" {
-		// StatusMethodNotAllowed是405错误码
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 从请求中获取数据
-	id := r.FormValue("node_id")
-	ip := r.FormValue("ip")
-	port := r.FormValue("port")
-
-	// 如果有参数没传，返回错误响应
-	if id == "" || ip == "" || port == "" {
-		http.Error(w, "Missing parameters", http.StatusBadRequest)
-		return
-	}
-
-	// 调用注册节点函数
-	if err := cm.RegisterNode(id, ip, port); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// 把响应码设置为201，成功创建
-	w.WriteHeader(http.StatusCreated)
-	// Fprintf向响应w中写入内容，返回给客户端
-	fmt.Fprintf(w, "Node %s registered successfully", id)
-}
-
-// 处理心跳
-func (cm *ClusterManager) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
-	// 必须是post请求
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if cm.grpcServer != nil {
+		// 控制流不会自己结束，不能等待它们，直接断开所有连接
+		cm.grpcServer.Stop()
 	}
-
-	// 获取节点id
-	nodeID := r.FormValue("node_id")
-	if nodeID == "" {
-		http.Error(w, "Missing node ID", http.StatusBadRequest)
-		return
-	}
-
-	// 从请求体中获取GPU信息
-	gpus := make(map[string]GPU)
-
-	if err := json.NewDecoder(r.Body).Decode(&gpus); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	cm.nodes[nodeID].GPUs = gpus
-	// 打印一下，测试是否添加成功
-	// fmt.Println(cm.nodes[nodeID].GPUs)
-
-	// 更新节点的心跳时间为现在，并且状态设置为健康
-	if err := cm.UpdateHeartbeat(nodeID); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	}
-
-	// 返回一个成功的响应
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Heartbeat for node %s updated", nodeID)
 }
 
 // 获取所有节点的状态
@@ -251,6 +210,11 @@ func (cm *ClusterManager) GetNodes() map[string]*Node {
 			LastActive: node.LastActive,
 			Status:     node.Status,
 			GPUs:       node.GPUs,
+			Images:     node.Images,
+			Draining:   node.Draining,
+			APIVersion: node.APIVersion,
+
+			DisconnectedAt: node.DisconnectedAt,
 		}
 	}
 	return nodesCopy
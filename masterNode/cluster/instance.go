@@ -0,0 +1,344 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pb "api/schedule"
+)
+
+// 要移除的实例还在处理任务
+var ErrInstanceBusy = errors.New("instance is serving tasks")
+
+// 实例状态
+const (
+	// 容器正在启动，还不能接收其他任务
+	InstanceStarting = "starting"
+	// 容器已经就绪，可以复用
+	InstanceReady = "ready"
+	// 访问实例失败，还没有确认实例是否还在，不再路由新的任务
+	InstanceUnreachable = "unreachable"
+)
+
+// Instance 运行在某个节点上的模型实例（一个模型容器）
+type Instance struct {
+	InstanceID    string    `json:"instance_id"`
+	ModelName     string    `json:"model_name"`
+	NodeID        string    `json:"node_id"`
+	NodeIP        string    `json:"node_ip"`
+	Port          string    `json:"port"`
+	GPUIDs        []string  `json:"gpu_ids"`
+	ReservationID string    `json:"reservation_id"` // 实例占用的显存预留，实例停止时释放
+	State         string    `json:"state"`
+	InFlight      int       `json:"in_flight"`      // 正在处理的任务数
+	MaxConcurrent int       `json:"max_concurrent"` // 同时处理的任务数上限，达到后视为饱和
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsed      time.Time `json:"last_used"`
+	// 跨节点组调度的实例，上面的节点信息是rank 0，这里是其余rank的成员
+	Members []GangMember `json:"members,omitempty"`
+	// 实例独占分配给它的GPU
+	Exclusive bool `json:"exclusive,omitempty"`
+	// 选中这个空闲实例作为卸载对象的预留，那次预留启动的实例会让工作节点卸载它
+	claimedBy string
+}
+
+// GangMember 组调度实例中rank大于0的成员
+type GangMember struct {
+	Rank          int      `json:"rank"`
+	NodeID        string   `json:"node_id"`
+	NodeIP        string   `json:"node_ip"`
+	GPUIDs        []string `json:"gpu_ids"`
+	ReservationID string   `json:"reservation_id"`
+}
+
+// 复制实例，切片也要复制
+func (inst *Instance) snapshot() Instance {
+	c := *inst
+	c.GPUIDs = append([]string(nil), inst.GPUIDs...)
+	c.Members = append([]GangMember(nil), inst.Members...)
+	return c
+}
+
+// 实例的成员所在的节点，按rank排序
+func (inst *Instance) nodeIDs() []string {
+	nodeIDs := []string{inst.NodeID}
+	for _, m := range inst.Members {
+		nodeIDs = append(nodeIDs, m.NodeID)
+	}
+	return nodeIDs
+}
+
+// 实例是否有成员运行在该节点上
+func (inst *Instance) onNode(nodeID string) bool {
+	for _, id := range inst.nodeIDs() {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// AcquireInstance 为模型挑选一个已就绪且未饱和的实例，优先选择正在处理任务最少的，
+// 选中后占用一个并发名额，用完需要调用 ReleaseInstance 归还
+func (cm *ClusterManager) AcquireInstance(modelName string) (Instance, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var best *Instance
+	for _, inst := range cm.instances {
+		if inst.ModelName != modelName || inst.State != InstanceReady || inst.InFlight >= inst.MaxConcurrent {
+			continue
+		}
+		// 即将被卸载的实例不再接收任务，否则它不再空闲，工作节点就腾不出显存
+		if cm.claimedLocked(inst) {
+			continue
+		}
+		// 节点不健康时不往上面的实例继续派发
+		if !cm.instanceHealthy(inst) {
+			continue
+		}
+		if best == nil || inst.InFlight < best.InFlight ||
+			(inst.InFlight == best.InFlight && inst.InstanceID < best.InstanceID) {
+			best = inst
+		}
+	}
+	if best == nil {
+		return Instance{}, false
+	}
+	best.InFlight++
+	best.LastUsed = time.Now()
+	return best.snapshot(), true
+}
+
+// 实例的所有节点都在线，调用方需要持有锁
+func (cm *ClusterManager) instanceHealthy(inst *Instance) bool {
+	for _, id := range inst.nodeIDs() {
+		if node, exists := cm.nodes[id]; !exists || node.Status != "online" {
+			return false
+		}
+	}
+	return true
+}
+
+// AddInstance 登记一个正在启动的实例，启动它的任务占用一个并发名额
+func (cm *ClusterManager) AddInstance(inst Instance) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if _, exists := cm.instances[inst.InstanceID]; exists {
+		return fmt.Errorf("instance %s already exists", inst.InstanceID)
+	}
+	if inst.MaxConcurrent < 1 {
+		inst.MaxConcurrent = 1
+	}
+	now := time.Now()
+	inst.State = InstanceStarting
+	inst.InFlight = 1
+	inst.CreatedAt = now
+	inst.LastUsed = now
+	cm.instances[inst.InstanceID] = &inst
+	return nil
+}
+
+// MarkInstanceReady 容器就绪后记录端口，之后的任务可以复用该实例
+func (cm *ClusterManager) MarkInstanceReady(id, port string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return fmt.Errorf("instance %s not found", id)
+	}
+	inst.State = InstanceReady
+	inst.Port = port
+	return nil
+}
+
+// MarkInstanceUnreachable 访问实例失败，在确认实例的状态之前不再把任务路由给它。
+// 实例仍然登记在注册表中，显存预留也保留，确认实例还在时再调用MarkInstanceReady恢复
+func (cm *ClusterManager) MarkInstanceUnreachable(id string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return fmt.Errorf("instance %s not found", id)
+	}
+	if inst.State == InstanceReady {
+		inst.State = InstanceUnreachable
+	}
+	return nil
+}
+
+// ReleaseInstance 任务处理完后归还实例的并发名额
+func (cm *ClusterManager) ReleaseInstance(id string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if inst, exists := cm.instances[id]; exists && inst.InFlight > 0 {
+		inst.InFlight--
+		inst.LastUsed = time.Now()
+	}
+}
+
+// TakeInstance 从注册表中移除实例并返回它的副本，用于停止实例。
+// 检查并发数和移除在同一把锁内完成，检查之后不会再有任务被路由过来；
+// force为false时不移除还在处理任务的实例，返回ErrInstanceBusy
+func (cm *ClusterManager) TakeInstance(id string, force bool) (Instance, bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return Instance{}, false, nil
+	}
+	if inst.InFlight > 0 && !force {
+		return Instance{}, true, fmt.Errorf("%w: instance %s has %d tasks in flight", ErrInstanceBusy, id, inst.InFlight)
+	}
+	c := inst.snapshot()
+	cm.removeInstanceLocked(id)
+	return c, true, nil
+}
+
+// RemoveInstance 实例启动失败或者已经停止，移除实例并释放它的显存预留
+func (cm *ClusterManager) RemoveInstance(id string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.removeInstanceLocked(id)
+}
+
+// 调用方需要持有锁
+func (cm *ClusterManager) removeInstanceLocked(id string) {
+	inst, exists := cm.instances[id]
+	if !exists {
+		return
+	}
+	delete(cm.instances, id)
+	delete(cm.reservations, inst.ReservationID)
+	for _, m := range inst.Members {
+		delete(cm.reservations, m.ReservationID)
+	}
+	log.Printf("Instance %s of model %s on node %s removed", id, inst.ModelName, inst.NodeID)
+}
+
+// EvictInstance 工作节点主动卸载了实例（空闲超时、为新实例腾出显存或者容器退出），
+// 只有实例确实在该节点上时才移除，防止误删其他节点上的同名实例。
+// 组调度实例的一个成员没了，整个实例都不能用了，通知其他节点停止剩下的成员
+func (cm *ClusterManager) EvictInstance(nodeID, id string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return fmt.Errorf("instance %s not found", id)
+	}
+	if !inst.onNode(nodeID) {
+		return fmt.Errorf("instance %s is not on node %s", id, nodeID)
+	}
+	cm.stopMembersLocked(inst, nodeID, "gang member on node "+nodeID+" evicted")
+	cm.removeInstanceLocked(id)
+	return nil
+}
+
+// DiscardInstance 实例已经不可用（连不上或者节点上已经没有这个实例），从注册表中移除，
+// 之后的任务会调度新的实例。同时通过控制流通知各个节点停止可能残留的成员
+func (cm *ClusterManager) DiscardInstance(id, reason string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return
+	}
+	cm.stopMembersLocked(inst, "", reason)
+	cm.removeInstanceLocked(id)
+}
+
+// 节点下线时移除它上面的所有实例，组调度的实例只要有一个成员在该节点上就整体移除，
+// 并通知其他节点停止这个实例剩下的成员。调用方需要持有锁
+func (cm *ClusterManager) dropNodeInstances(nodeID string) {
+	for id, inst := range cm.instances {
+		if !inst.onNode(nodeID) {
+			continue
+		}
+		cm.stopMembersLocked(inst, nodeID, "gang member on node "+nodeID+" lost")
+		cm.removeInstanceLocked(id)
+	}
+}
+
+// 通过控制流通知实例所在的节点停止它，跳过skipNode，调用方需要持有锁
+func (cm *ClusterManager) stopMembersLocked(inst *Instance, skipNode, reason string) {
+	for _, nodeID := range inst.nodeIDs() {
+		if nodeID == skipNode {
+			continue
+		}
+		_, err := cm.sendCommandLocked(nodeID, &pb.NodeCommand{
+			Command: &pb.NodeCommand_StopInstance{StopInstance: &pb.StopInstanceRequest{
+				InstanceId: inst.InstanceID,
+				Reason:     reason,
+				Force:      true,
+			}},
+		})
+		if err != nil {
+			log.Printf("Stop instance %s on node %s: %v", inst.InstanceID, nodeID, err)
+		}
+	}
+}
+
+// 节点换了IP，更新它上面的实例记录的地址，调用方需要持有锁
+func (cm *ClusterManager) moveNodeInstances(nodeID, ip string) {
+	for _, inst := range cm.instances {
+		if inst.NodeID == nodeID {
+			inst.NodeIP = ip
+		}
+		for i := range inst.Members {
+			if inst.Members[i].NodeID == nodeID {
+				inst.Members[i].NodeIP = ip
+			}
+		}
+	}
+}
+
+// 用节点重新注册时上报的实例对账：断线期间已经在节点上停止的实例（包括暂时连不上的实例）从注册表中移除，
+// 组调度实例剩下的成员也一起停止。启动中的实例可能还没有出现在节点上，不处理。
+// 调用方需要持有锁
+func (cm *ClusterManager) syncNodeInstances(nodeID string, running []string) {
+	exists := make(map[string]bool, len(running))
+	for _, id := range running {
+		exists[id] = true
+	}
+	for id, inst := range cm.instances {
+		if inst.State == InstanceStarting || !inst.onNode(nodeID) || exists[id] {
+			continue
+		}
+		log.Printf("Instance %s is gone from node %s", id, nodeID)
+		cm.stopMembersLocked(inst, nodeID, "gang member on node "+nodeID+" lost")
+		cm.removeInstanceLocked(id)
+	}
+}
+
+// GetInstance 获取单个实例的副本
+func (cm *ClusterManager) GetInstance(id string) (Instance, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	inst, exists := cm.instances[id]
+	if !exists {
+		return Instance{}, false
+	}
+	return inst.snapshot(), true
+}
+
+// GetInstances 获取所有实例的副本
+func (cm *ClusterManager) GetInstances() []Instance {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	instances := make([]Instance, 0, len(cm.instances))
+	for _, inst := range cm.instances {
+		instances = append(instances, inst.snapshot())
+	}
+	return instances
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireInstance(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	for _, id := range []string{"inst-a", "inst-b"} {
+		cm.AddInstance(Instance{InstanceID: id, ModelName: "gpt", NodeID: "node-1", MaxConcurrent: 2})
+	}
+
+	// 启动中的实例不能复用
+	if _, ok := cm.AcquireInstance("gpt"); ok {
+		t.Fatal("启动中的实例不应该被选中")
+	}
+	cm.MarkInstanceReady("inst-a", "31000")
+	cm.MarkInstanceReady("inst-b", "31001")
+	cm.ReleaseInstance("inst-a")
+	cm.ReleaseInstance("inst-b")
+
+	// 优先选择正在处理任务最少的实例，两个实例各有两个名额
+	acquired := map[string]int{}
+	for i := 0; i < 4; i++ {
+		inst, ok := cm.AcquireInstance("gpt")
+		if !ok {
+			t.Fatalf("第 %d 次应该能复用实例", i+1)
+		}
+		acquired[inst.InstanceID]++
+	}
+	if acquired["inst-a"] != 2 || acquired["inst-b"] != 2 {
+		t.Fatalf("复用次数 %v，期望每个实例2次", acquired)
+	}
+
+	// 所有实例都饱和后不再复用，由调用方启动新实例
+	if _, ok := cm.AcquireInstance("gpt"); ok {
+		t.Fatal("饱和的实例不应该被选中")
+	}
+	cm.ReleaseInstance("inst-b")
+	if inst, ok := cm.AcquireInstance("gpt"); !ok || inst.InstanceID != "inst-b" {
+		t.Fatalf("归还名额后应该选中 inst-b，得到 %v %v", inst.InstanceID, ok)
+	}
+	if _, ok := cm.AcquireInstance("other"); ok {
+		t.Fatal("不应该选中其他模型的实例")
+	}
+
+	// 不可用的实例移除后不再被选中
+	cm.ReleaseInstance("inst-a")
+	cm.DiscardInstance("inst-a", "instance unreachable")
+	if _, ok := cm.AcquireInstance("gpt"); ok {
+		t.Fatal("被丢弃的实例不应该被选中")
+	}
+}
@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// NodeCertTTL 签发给工作节点的证书的有效期，节点在过去三分之二时自动续期
+const NodeCertTTL = 7 * 24 * time.Hour
+
+// EnableTLS 启用双向TLS：控制流只接受持有CA签发证书的节点，
+// 没有证书的节点先用一次性令牌通过JoinService申请证书
+func (cm *ClusterManager) EnableTLS(ca *pki.Authority, creds *pki.Credentials) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.ca = ca
+	cm.creds = creds
+}
+
+// CAHash CA的指纹，未启用TLS时为空
+func (cm *ClusterManager) CAHash() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if cm.ca == nil {
+		return ""
+	}
+	return cm.ca.Hash()
+}
+
+// CreateJoinToken 生成一个只能使用一次的加入令牌，只保存令牌的哈希
+func (cm *ClusterManager) CreateJoinToken(ttl time.Duration) (string, time.Time, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(secret)
+	expires := time.Now().Add(ttl)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	// 顺便清理已经过期的令牌
+	for hash, exp := range cm.joinTokens {
+		if time.Now().After(exp) {
+			delete(cm.joinTokens, hash)
+		}
+	}
+	cm.joinTokens[tokenHash(token)] = expires
+	return token, expires, nil
+}
+
+// 使用令牌，令牌存在并且没有过期时返回true，用过之后立即作废
+func (cm *ClusterManager) consumeJoinToken(token string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	hash := tokenHash(token)
+	expires, exists := cm.joinTokens[hash]
+	delete(cm.joinTokens, hash)
+	return exists && time.Now().Before(expires)
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// gRPC对端的IP
+func peerIP(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("cannot determine the node address")
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil || net.ParseIP(host) == nil {
+		return "", fmt.Errorf("cannot determine the node address from %s", p.Addr)
+	}
+	return host, nil
+}
+
+// 节点已经登记或者已经打开了控制流
+func (cm *ClusterManager) nodeKnown(nodeID string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	_, registered := cm.nodes[nodeID]
+	_, connected := cm.sessions[nodeID]
+	return registered || connected
+}
+
+// 获取CA，未启用TLS时返回错误
+func (cm *ClusterManager) authority() (*pki.Authority, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if cm.ca == nil {
+		return nil, status.Error(codes.Unimplemented, "master runs without TLS")
+	}
+	return cm.ca, nil
+}
+
+// 实现JoinService，给工作节点签发证书
+type joinService struct {
+	pb.UnimplementedJoinServiceServer
+	cm *ClusterManager
+}
+
+// Join 用一次性令牌换取证书，证书的CN是节点ID
+func (s *joinService) Join(ctx context.Context, req *pb.JoinRequest) (*pb.JoinResponse, error) {
+	ca, err := s.cm.authority()
+	if err != nil {
+		return nil, err
+	}
+	node_id := req.GetNodeId()
+	if node_id == "" || node_id == pki.MasterName {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid node id %q", node_id)
+	}
+	if !s.cm.consumeJoinToken(req.GetToken()) {
+		log.Printf("Node %s tried to join with an invalid token", node_id)
+		return nil, status.Error(codes.PermissionDenied, "invalid or expired join token")
+	}
+	// 已经在集群中的节点ID不能再申请证书，否则持有令牌的人可以顶替这个节点的控制流
+	if s.cm.nodeKnown(node_id) {
+		log.Printf("Node %s tried to join but is already in the cluster", node_id)
+		return nil, status.Errorf(codes.AlreadyExists, "node %s is already in the cluster", node_id)
+	}
+	return s.sign(ctx, ca, req.GetCsrPem(), node_id)
+}
+
+// Renew 用当前的证书续期，节点ID取自当前证书
+func (s *joinService) Renew(ctx context.Context, req *pb.RenewRequest) (*pb.JoinResponse, error) {
+	ca, err := s.cm.authority()
+	if err != nil {
+		return nil, err
+	}
+	node_id, ok := pki.PeerCommonName(ctx)
+	if !ok || node_id == pki.MasterName {
+		return nil, status.Error(codes.Unauthenticated, "renewal requires a node certificate")
+	}
+	return s.sign(ctx, ca, req.GetCsrPem(), node_id)
+}
+
+// 签发节点证书。证书中只有节点连接master时使用的IP，不用请求中自带的地址，
+// 否则节点可以申请到其他节点或者master地址的证书
+func (s *joinService) sign(ctx context.Context, ca *pki.Authority, csrPEM []byte, node_id string) (*pb.JoinResponse, error) {
+	node_ip, err := peerIP(ctx)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	certPEM, err := ca.Sign(csrPEM, node_id, []string{node_ip}, NodeCertTTL)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("Certificate issued to node %s at %s", node_id, node_ip)
+	return &pb.JoinResponse{CertPem: certPEM, CaPem: ca.CertPEM()}, nil
+}
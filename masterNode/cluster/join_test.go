@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// 启用了TLS的集群管理器，master证书签发给localhost
+func tlsClusterManager(t *testing.T) (*ClusterManager, *pki.Authority) {
+	ca, err := pki.LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.Issue(pki.MasterName, []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := pki.NewCredentials(certPEM, keyPEM, ca.CertPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.EnableTLS(ca, creds)
+	return cm, ca
+}
+
+// 打开控制流并注册，返回服务器对注册的响应
+func registerNode(t *testing.T, client pb.NodeServiceClient, node_id string) error {
+	stream, err := client.Connect(context.Background())
+	if err != nil {
+		return err
+	}
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Register{Register: &pb.RegisterNode{
+		NodeId: node_id, Ip: "127.0.0.1", Port: "10000", ApiVersion: pb.CurrentVersion(),
+	}}})
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Heartbeat{Heartbeat: &pb.NodeHeartbeat{
+		ApiVersion: pb.CurrentVersion(),
+	}}})
+	// 注册成功时流保持打开，用一个很短的超时区分两种情况
+	errc := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestJoinAndConnectWithTLS(t *testing.T) {
+	cm, ca := tlsClusterManager(t)
+	dial := startNodeServer(t, cm)
+	ctx := context.Background()
+
+	// CA指纹不对时不和这个master通信
+	wrong := pb.NewJoinServiceClient(dial(credentials.NewTLS(pki.BootstrapConfig("sha256:00"))))
+	if _, err := wrong.Join(ctx, &pb.JoinRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("CA指纹不对时期望握手失败，得到 %v", err)
+	}
+
+	// 令牌只能使用一次
+	join := pb.NewJoinServiceClient(dial(credentials.NewTLS(pki.BootstrapConfig(ca.Hash()))))
+	token, _, err := cm.CreateJoinToken(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 请求中的地址被忽略，证书中只有节点连接master时使用的IP
+	keyPEM, csrPEM, err := pki.NewKeyAndCSR("node-1", []string{"localhost", "10.0.0.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := join.Join(ctx, &pb.JoinRequest{Token: token, NodeId: "node-1", CsrPem: csrPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := join.Join(ctx, &pb.JoinRequest{Token: token, NodeId: "node-2", CsrPem: csrPEM}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("重复使用令牌期望 PermissionDenied，得到 %v", err)
+	}
+
+	// 没有证书的节点不能注册
+	if err := registerNode(t, pb.NewNodeServiceClient(dial(credentials.NewTLS(pki.BootstrapConfig(ca.Hash())))), "node-1"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("没有证书时期望 Unauthenticated，得到 %v", err)
+	}
+
+	creds, err := pki.NewCredentials(resp.GetCertPem(), keyPEM, resp.GetCaPem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf := creds.Leaf(); len(leaf.DNSNames) != 0 || len(leaf.IPAddresses) != 1 || leaf.IPAddresses[0].String() != "127.0.0.1" {
+		t.Fatalf("节点证书的地址 %v %v，期望只有 127.0.0.1", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	// 连接master时确认对端是master，不是其他节点
+	notMaster := pb.NewNodeServiceClient(dial(credentials.NewTLS(creds.ClientConfig(pki.AllowCommonName("node-2")))))
+	if err := registerNode(t, notMaster, "node-1"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("对端不是期望的节点时期望握手失败，得到 %v", err)
+	}
+	conn := dial(credentials.NewTLS(creds.ClientConfig(pki.AllowCommonName(pki.MasterName))))
+	// 只能用自己的证书注册
+	if err := registerNode(t, pb.NewNodeServiceClient(conn), "node-2"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("冒充其他节点期望 Unauthenticated，得到 %v", err)
+	}
+	if err := registerNode(t, pb.NewNodeServiceClient(conn), "node-1"); err != nil {
+		t.Fatalf("持有证书的节点注册失败: %v", err)
+	}
+	if _, exists := cm.GetNodes()["node-1"]; !exists {
+		t.Fatal("节点没有注册成功")
+	}
+
+	// 持有新令牌也不能用已经在集群中的节点ID申请证书
+	token, _, _ = cm.CreateJoinToken(time.Minute)
+	if _, err := join.Join(ctx, &pb.JoinRequest{Token: token, NodeId: "node-1", CsrPem: csrPEM}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("顶替已有节点期望 AlreadyExists，得到 %v", err)
+	}
+
+	// 用当前的证书续期
+	keyPEM, csrPEM, _ = pki.NewKeyAndCSR("node-1", []string{"127.0.0.1"})
+	renewed, err := pb.NewJoinServiceClient(conn).Renew(ctx, &pb.RenewRequest{CsrPem: csrPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := creds.Update(renewed.GetCertPem(), keyPEM, renewed.GetCaPem()); err != nil {
+		t.Fatal(err)
+	}
+	if name := creds.Leaf().Subject.CommonName; name != "node-1" {
+		t.Fatalf("续期后的证书CN是 %s，期望 node-1", name)
+	}
+}
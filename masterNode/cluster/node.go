@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"catalog"
 	"time"
 )
 
@@ -10,12 +11,41 @@ type Node struct {
 	IP         string
 	Port       string
 	LastActive time.Time
-	Status     string         // 节点状态 "online", "offline", "unhealthy"
+	Status     string         // 节点状态 "online", "offline", "unhealthy", "draining", "disconnected"
 	GPUs       map[string]GPU // 显卡状态（可能有多张）
+	Images     []string       // 节点上已经缓存的容器镜像
+	Draining   bool           // 节点正在排空，不再调度新任务
+	APIVersion string         // 工作节点注册时上报的接口版本，例如 "1.0"
+	// 控制流断开的时间，在宽限期内重新连接的节点保留它的实例和显存预留
+	DisconnectedAt time.Time
+}
+
+// 节点收到心跳后的状态，排空中的节点保持排空
+func (n *Node) onlineStatus() string {
+	if n.Draining {
+		return "draining"
+	}
+	return "online"
+}
+
+// HasImage 节点上是否已经缓存了该镜像，同一个镜像的不同写法（例如 nginx 和 nginx:latest）都算
+func (n *Node) HasImage(image string) bool {
+	for _, cached := range n.Images {
+		if catalog.SameImage(cached, image) {
+			return true
+		}
+	}
+	return false
 }
 
 type GPU struct {
 	GPUModel      string `json:"gpu_model"`       // 显卡型号
 	TotalMemoryMB uint64 `json:"total_memory_mb"` // 最大显存
 	FreeMemoryMB  uint64 `json:"free_memory_mb"`  // 可用显存
+	// 空闲实例占用的显存，启动新实例显存不够时工作节点会按LRU卸载它们腾出显存
+	ReclaimableMemoryMB uint64 `json:"reclaimable_memory_mb,omitempty"`
+	// GPU上实例和预留的个数，独占GPU的模型只能放在没有其他实例的GPU上
+	Holders int `json:"holders,omitempty"`
+	// GPU被独占实例占用，不能再放其他实例
+	Exclusive bool `json:"exclusive,omitempty"`
 }
@@ -0,0 +1,343 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultReconnectGrace 控制流断开后保留节点的时间。工作节点重连的退避时间最长30秒，
+// 短暂的网络抖动不会让节点丢掉它的实例和显存预留
+const DefaultReconnectGrace = time.Minute
+
+// 每个节点最多积压的未发送命令数
+const commandQueueSize = 16
+
+// 控制流的保活参数：连接静默这么久后发一次ping，ping超时就断开连接，
+// 这样节点断电或者网络中断时也能很快发现，不用等心跳超时
+const (
+	keepaliveTime    = 10 * time.Second
+	keepaliveTimeout = 5 * time.Second
+)
+
+// ErrNodeNotConnected 节点没有打开控制流，无法下发命令
+var ErrNodeNotConnected = errors.New("node not connected")
+
+// 一个工作节点的控制流
+type nodeSession struct {
+	nodeID   string
+	commands chan *pb.NodeCommand
+	// 同一个节点重新连接后，旧的控制流被关闭
+	replaced chan struct{}
+}
+
+// 实现NodeService，工作节点通过它注册、发送心跳和实例事件，并接收命令
+type nodeService struct {
+	pb.UnimplementedNodeServiceServer
+	cm *ClusterManager
+}
+
+// StartNodeServer 启动接收工作节点控制流的gRPC服务器
+func (cm *ClusterManager) StartNodeServer(port string) error {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+
+	s := cm.newNodeServer()
+	cm.mu.Lock()
+	cm.grpcServer = s
+	cm.mu.Unlock()
+
+	log.Printf("Node control server listening on %s", listener.Addr())
+	return s.Serve(listener)
+}
+
+// 创建提供NodeService和JoinService的gRPC服务器，启用了TLS时使用master的证书
+func (cm *ClusterManager) newNodeServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    keepaliveTime,
+			Timeout: keepaliveTimeout,
+		}),
+		// 工作节点也会主动ping，允许它在没有其他流量时保活
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             keepaliveTime / 2,
+			PermitWithoutStream: true,
+		}),
+	}
+	cm.mu.Lock()
+	if cm.creds != nil {
+		// 还没有证书的节点要先调用Join，所以客户端证书是可选的，由各个接口自己检查
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cm.creds.ServerConfig(tls.VerifyClientCertIfGiven, nil))))
+	} else {
+		log.Printf("WARNING: node control server runs without TLS")
+	}
+	cm.mu.Unlock()
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterNodeServiceServer(s, &nodeService{cm: cm})
+	pb.RegisterJoinServiceServer(s, &joinService{cm: cm})
+	return s
+}
+
+// Connect 处理一个工作节点的控制流，流结束时节点立即下线
+func (s *nodeService) Connect(stream pb.NodeService_ConnectServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	reg := msg.GetRegister()
+	if reg == nil || reg.GetNodeId() == "" || reg.GetIp() == "" || reg.GetPort() == "" {
+		return status.Error(codes.InvalidArgument, "first message must register the node with node_id, ip and port")
+	}
+
+	// 主版本号不同的工作节点无法通信，直接拒绝并说明原因
+	if err := pb.Compatible(reg.GetApiVersion()); err != nil {
+		log.Printf("Node %s rejected: %v", reg.GetNodeId(), err)
+		return status.Errorf(codes.FailedPrecondition, "master (API v%s) rejected node %s: %v",
+			pb.FormatVersion(pb.CurrentVersion()), reg.GetNodeId(), err)
+	}
+
+	// 启用TLS时，节点只能用自己的证书注册
+	if _, err := s.cm.authority(); err == nil {
+		name, ok := pki.PeerCommonName(stream.Context())
+		if !ok || name != reg.GetNodeId() {
+			log.Printf("Node %s rejected: it did not connect with its own certificate", reg.GetNodeId())
+			return status.Errorf(codes.Unauthenticated, "node %s must connect with its own certificate, join the cluster first", reg.GetNodeId())
+		}
+	}
+
+	sess, err := s.cm.openSession(reg)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer s.cm.closeSession(sess)
+
+	// 接收协程处理节点发来的消息，当前协程负责发送命令，
+	// 任何一边出错都结束整个流
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err == nil {
+				err = s.cm.handleNodeMessage(sess, msg)
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case cmd := <-sess.commands:
+			if err := stream.Send(cmd); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-sess.replaced:
+			return status.Error(codes.Aborted, "replaced by a newer connection from the same node")
+		}
+	}
+}
+
+// 登记节点并记录它的控制流，同一个节点之前的控制流被替换。
+// 断线后重新连接的节点用上报的实例对账，master要求过排空而节点不知道时重新下发排空命令
+func (cm *ClusterManager) openSession(reg *pb.RegisterNode) (*nodeSession, error) {
+	if err := cm.RegisterNode(reg.GetNodeId(), reg.GetIp(), reg.GetPort()); err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	sess := &nodeSession{
+		nodeID:   reg.GetNodeId(),
+		commands: make(chan *pb.NodeCommand, commandQueueSize),
+		replaced: make(chan struct{}),
+	}
+	if old, exists := cm.sessions[sess.nodeID]; exists {
+		close(old.replaced)
+	}
+	cm.sessions[sess.nodeID] = sess
+	version := pb.FormatVersion(reg.GetApiVersion())
+	if node, exists := cm.nodes[sess.nodeID]; exists {
+		node.APIVersion = version
+		if reg.GetDraining() {
+			node.Draining = true
+			node.Status = node.onlineStatus()
+		} else if node.Draining {
+			if _, err := cm.sendCommandLocked(sess.nodeID, &pb.NodeCommand{
+				Command: &pb.NodeCommand_Drain{Drain: &pb.DrainNode{}},
+			}); err != nil {
+				log.Printf("Drain node %s again: %v", sess.nodeID, err)
+			}
+		}
+		if reg.GetInstancesReported() {
+			cm.syncNodeInstances(sess.nodeID, reg.GetInstanceIds())
+		}
+	}
+	// 次版本号不同时可以通信，双方都会忽略不认识的字段和命令
+	if reg.GetApiVersion().GetMinor() != pb.APIMinor {
+		log.Printf("Node %s connected with API v%s, master uses v%s", sess.nodeID, version, pb.FormatVersion(pb.CurrentVersion()))
+	} else {
+		log.Printf("Node %s connected", sess.nodeID)
+	}
+	return sess, nil
+}
+
+// 控制流断开，节点不再接收新任务，但在宽限期内保留它的实例和显存预留，
+// 节点的容器在断线期间还在运行，超过宽限期没有重新连接时由健康检查让它下线。
+// 已经被新连接替换的旧控制流不影响节点
+func (cm *ClusterManager) closeSession(sess *nodeSession) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.sessions[sess.nodeID] != sess {
+		return
+	}
+	delete(cm.sessions, sess.nodeID)
+	if node, exists := cm.nodes[sess.nodeID]; exists {
+		log.Printf("Node %s disconnected, waiting %v for it to reconnect", sess.nodeID, cm.reconnectGrace)
+		node.Status = "disconnected"
+		node.DisconnectedAt = time.Now()
+	}
+}
+
+// 当前的控制流是否还是节点最新的连接
+func (cm *ClusterManager) currentSession(sess *nodeSession) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.sessions[sess.nodeID] == sess
+}
+
+// 处理节点发来的一条消息，返回错误时结束控制流，节点会重新连接并注册
+func (cm *ClusterManager) handleNodeMessage(sess *nodeSession, msg *pb.NodeMessage) error {
+	if !cm.currentSession(sess) {
+		return nil
+	}
+	nodeID := sess.nodeID
+
+	switch payload := msg.GetPayload().(type) {
+	case *pb.NodeMessage_Heartbeat:
+		// 工作节点升级后没有重新注册，让它重新连接
+		if err := cm.checkVersion(nodeID, payload.Heartbeat.GetApiVersion()); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		gpus := make(map[string]GPU, len(payload.Heartbeat.GetGpus()))
+		for id, gpu := range payload.Heartbeat.GetGpus() {
+			gpus[id] = GPU{
+				GPUModel:      gpu.GetGpuModel(),
+				TotalMemoryMB: gpu.GetTotalMemoryMb(),
+				FreeMemoryMB:  gpu.GetFreeMemoryMb(),
+			}
+		}
+		// 节点因为心跳超时被移除后，让它重新注册
+		// 采集时间用工作节点的时钟，节点和master的时钟需要同步
+		var sampledAt time.Time
+		if ms := payload.Heartbeat.GetSampledAtMs(); ms > 0 {
+			sampledAt = time.UnixMilli(ms)
+		}
+		if err := cm.UpdateHeartbeat(nodeID, gpus, sampledAt); err != nil {
+			return status.Error(codes.NotFound, err.Error())
+		}
+		if payload.Heartbeat.GetImagesReported() {
+			cm.UpdateImages(nodeID, payload.Heartbeat.GetImages())
+		}
+
+	case *pb.NodeMessage_InstanceEvent:
+		event := payload.InstanceEvent
+		// 实例已经不在注册表里时（例如master重启过）直接忽略
+		if err := cm.EvictInstance(nodeID, event.GetInstanceId()); err != nil {
+			log.Printf("Evict instance %s from node %s: %v", event.GetInstanceId(), nodeID, err)
+		} else {
+			log.Printf("Instance %s evicted by node %s: %s", event.GetInstanceId(), nodeID, event.GetReason())
+		}
+
+	case *pb.NodeMessage_CommandResult:
+		result := payload.CommandResult
+		if result.GetError() != "" {
+			log.Printf("Command %s on node %s failed: %s", result.GetCommandId(), nodeID, result.GetError())
+		} else {
+			log.Printf("Command %s on node %s done", result.GetCommandId(), nodeID)
+		}
+
+	case *pb.NodeMessage_Register:
+		return status.Error(codes.InvalidArgument, "node already registered on this stream")
+	}
+	return nil
+}
+
+// 心跳里的接口版本必须和注册时一致
+func (cm *ClusterManager) checkVersion(nodeID string, version *pb.APIVersion) error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	node, exists := cm.nodes[nodeID]
+	if !exists || node.APIVersion == pb.FormatVersion(version) {
+		return nil
+	}
+	return fmt.Errorf("node %s registered with API v%s but sent a heartbeat with v%s, reconnect to register again",
+		nodeID, node.APIVersion, pb.FormatVersion(version))
+}
+
+// SendCommand 通过控制流向节点下发命令，返回命令ID，命令的执行结果由节点异步返回
+func (cm *ClusterManager) SendCommand(nodeID string, cmd *pb.NodeCommand) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.sendCommandLocked(nodeID, cmd)
+}
+
+// 调用方需要持有锁，命令队列满时不等待，直接返回错误
+func (cm *ClusterManager) sendCommandLocked(nodeID string, cmd *pb.NodeCommand) (string, error) {
+	sess, exists := cm.sessions[nodeID]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrNodeNotConnected, nodeID)
+	}
+	cm.nextCommand++
+	cmd.CommandId = fmt.Sprintf("cmd-%d", cm.nextCommand)
+	select {
+	case sess.commands <- cmd:
+		return cmd.CommandId, nil
+	default:
+		return "", fmt.Errorf("node %s has too many pending commands", nodeID)
+	}
+}
+
+// DrainNode 排空节点：master不再往节点上调度任务，节点停止空闲的实例，
+// 正在处理请求的实例处理完后停止
+func (cm *ClusterManager) DrainNode(nodeID string) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	node, exists := cm.nodes[nodeID]
+	if !exists {
+		return "", fmt.Errorf("node %s not found", nodeID)
+	}
+	id, err := cm.sendCommandLocked(nodeID, &pb.NodeCommand{
+		Command: &pb.NodeCommand_Drain{Drain: &pb.DrainNode{}},
+	})
+	if err != nil {
+		return "", err
+	}
+	node.Draining = true
+	node.Status = node.onlineStatus()
+	log.Printf("Node %s is draining", nodeID)
+	return id, nil
+}
@@ -0,0 +1,282 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "api/schedule"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// 在本机端口上启动控制流服务器，返回用给定的传输凭证连接它的函数。
+// 签发节点证书时要用到对端的IP，所以不用内存连接
+func startNodeServer(t *testing.T, cm *ClusterManager) func(creds credentials.TransportCredentials) *grpc.ClientConn {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cm.newNodeServer()
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return func(creds credentials.TransportCredentials) *grpc.ClientConn {
+		// 服务器证书签发给localhost
+		conn, err := grpc.NewClient("passthrough:///localhost",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "tcp", lis.Addr().String())
+			}),
+			grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+}
+
+// 不使用TLS的控制流客户端
+func nodeServiceClient(t *testing.T, cm *ClusterManager) pb.NodeServiceClient {
+	dial := startNodeServer(t, cm)
+	return pb.NewNodeServiceClient(dial(insecure.NewCredentials()))
+}
+
+// 等待条件成立，最多等待一秒
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNodeControlStream(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	client := nodeServiceClient(t, cm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Register{Register: &pb.RegisterNode{
+		NodeId: "node-1", Ip: "10.0.0.1", Port: "10000", ApiVersion: pb.CurrentVersion(),
+	}}})
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Heartbeat{Heartbeat: &pb.NodeHeartbeat{
+		Gpus:           map[string]*pb.GPUStatus{"0": {TotalMemoryMb: 24576, FreeMemoryMb: 20480}},
+		Images:         []string{"model:v1"},
+		ImagesReported: true,
+		ApiVersion:     pb.CurrentVersion(),
+	}}})
+	waitFor(t, "节点上报心跳", func() bool {
+		node, exists := cm.GetNodes()["node-1"]
+		return exists && node.GPUs["0"].FreeMemoryMB == 20480 && node.HasImage("model:v1") &&
+			node.APIVersion == pb.FormatVersion(pb.CurrentVersion())
+	})
+
+	// 排空的命令通过控制流下发，节点不再接收新任务
+	command_id, err := cm.DrainNode("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.GetCommandId() != command_id || cmd.GetDrain() == nil {
+		t.Fatalf("收到命令 %v，期望排空命令 %s", cmd, command_id)
+	}
+	if status := cm.GetNodes()["node-1"].Status; status != "draining" {
+		t.Fatalf("节点状态 %s，期望 draining", status)
+	}
+
+	// 控制流断开后节点不再接收命令，超过宽限期没有重新连接时下线，不用等心跳超时
+	cancel()
+	waitFor(t, "节点断开", func() bool {
+		return cm.GetNodes()["node-1"].Status == "disconnected"
+	})
+	if _, err := cm.SendCommand("node-1", &pb.NodeCommand{}); err == nil {
+		t.Fatal("节点断开后下发命令应该失败")
+	}
+	cm.mu.Lock()
+	cm.reconnectGrace = 0
+	cm.mu.Unlock()
+	cm.checkNodeHealth()
+	if _, exists := cm.GetNodes()["node-1"]; exists {
+		t.Fatal("超过宽限期的节点应该下线")
+	}
+}
+
+// 打开控制流并注册节点
+func connectNode(t *testing.T, client pb.NodeServiceClient, reg *pb.RegisterNode) (pb.NodeService_ConnectClient, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.ApiVersion = pb.CurrentVersion()
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Register{Register: reg}})
+	return stream, cancel
+}
+
+func TestNodeReconnectKeepsState(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	client := nodeServiceClient(t, cm)
+
+	_, cancel := connectNode(t, client, &pb.RegisterNode{NodeId: "node-1", Ip: "10.0.0.1", Port: "10000"})
+	waitFor(t, "节点注册", func() bool {
+		_, exists := cm.GetNodes()["node-1"]
+		return exists
+	})
+	cm.UpdateHeartbeat("node-1", map[string]GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 40960}}, time.Now())
+	for _, id := range []string{"inst-a", "inst-b"} {
+		rsv, err := cm.Reserve("node-1", map[string]uint64{"0": 8192})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cm.AddInstance(Instance{InstanceID: id, ModelName: "gpt", NodeID: "node-1", NodeIP: "10.0.0.1", ReservationID: rsv})
+		cm.MarkInstanceReady(id, "31000")
+		cm.ReleaseInstance(id)
+	}
+	cm.DrainNode("node-1")
+
+	// 控制流短暂断开，实例和显存预留都保留，但不再复用断开的节点上的实例
+	cancel()
+	waitFor(t, "节点断开", func() bool {
+		return cm.GetNodes()["node-1"].Status == "disconnected"
+	})
+	if len(cm.GetInstances()) != 2 || len(cm.GetReservations()) != 2 {
+		t.Fatalf("断开后还剩 %d 个实例、%d 个预留，期望都保留", len(cm.GetInstances()), len(cm.GetReservations()))
+	}
+	if _, ok := cm.AcquireInstance("gpt"); ok {
+		t.Fatal("断开的节点上的实例不应该被复用")
+	}
+
+	// 换了IP重新连接，节点上只剩 inst-b，排空命令重新下发
+	stream, cancel := connectNode(t, client, &pb.RegisterNode{
+		NodeId: "node-1", Ip: "10.0.0.9", Port: "10001",
+		InstanceIds: []string{"inst-b"}, InstancesReported: true,
+	})
+	defer cancel()
+	cmd, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.GetDrain() == nil {
+		t.Fatalf("重新连接后收到 %v，期望排空命令", cmd)
+	}
+
+	node := cm.GetNodes()["node-1"]
+	if node.IP != "10.0.0.9" || node.Port != "10001" || node.Status != "draining" || !node.DisconnectedAt.IsZero() {
+		t.Fatalf("重新连接后的节点 %+v", node)
+	}
+	if _, exists := cm.GetInstance("inst-a"); exists {
+		t.Fatal("节点上已经没有的实例应该被移除")
+	}
+	inst, exists := cm.GetInstance("inst-b")
+	if !exists || inst.NodeIP != "10.0.0.9" {
+		t.Fatalf("保留的实例 %+v 应该使用新的IP", inst)
+	}
+	if n := len(cm.GetReservations()); n != 1 {
+		t.Fatalf("还剩 %d 个预留，期望 1", n)
+	}
+}
+
+// 组调度实例的一个成员的容器退出后，其他节点上剩下的成员也被停止
+func TestGangMemberEvictionStopsOtherMembers(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	client := nodeServiceClient(t, cm)
+
+	rank0, cancel0 := connectNode(t, client, &pb.RegisterNode{NodeId: "node-1", Ip: "10.0.0.1", Port: "10000"})
+	defer cancel0()
+	rank1, cancel1 := connectNode(t, client, &pb.RegisterNode{NodeId: "node-2", Ip: "10.0.0.2", Port: "10000"})
+	defer cancel1()
+	waitFor(t, "节点注册", func() bool { return len(cm.GetNodes()) == 2 })
+
+	var rsvs []string
+	for _, id := range []string{"node-1", "node-2"} {
+		cm.UpdateHeartbeat(id, map[string]GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 40960}}, time.Now())
+		rsv, err := cm.Reserve(id, map[string]uint64{"0": 30 * 1024})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsvs = append(rsvs, rsv)
+	}
+	cm.AddInstance(Instance{
+		InstanceID: "inst-gang", ModelName: "big", NodeID: "node-1", NodeIP: "10.0.0.1", ReservationID: rsvs[0],
+		Members: []GangMember{{Rank: 1, NodeID: "node-2", NodeIP: "10.0.0.2", ReservationID: rsvs[1]}},
+	})
+	cm.MarkInstanceReady("inst-gang", "31000")
+
+	// rank 1 的容器退出，工作节点上报卸载
+	rank1.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_InstanceEvent{InstanceEvent: &pb.InstanceEvent{
+		InstanceId: "inst-gang", Reason: "exited",
+	}}})
+
+	// rank 0 所在的节点收到停止命令，上报卸载的节点不再收到命令
+	cmd, err := rank0.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stop := cmd.GetStopInstance(); stop == nil || stop.InstanceId != "inst-gang" || !stop.Force {
+		t.Fatalf("rank 0 收到 %v，期望停止 inst-gang", cmd)
+	}
+	if _, exists := cm.GetInstance("inst-gang"); exists {
+		t.Fatal("成员退出的组调度实例应该被移除")
+	}
+	if n := len(cm.GetReservations()); n != 0 {
+		t.Fatalf("还剩 %d 个预留", n)
+	}
+}
+
+func TestNodeControlStreamRequiresRegister(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	client := nodeServiceClient(t, cm)
+
+	stream, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Heartbeat{Heartbeat: &pb.NodeHeartbeat{}}})
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("没有先注册的控制流应该被拒绝")
+	}
+	if len(cm.GetNodes()) != 0 {
+		t.Fatal("没有注册的节点不应该出现在集群中")
+	}
+}
+
+func TestNodeControlStreamRejectsIncompatibleVersion(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	client := nodeServiceClient(t, cm)
+
+	// 没有版本号的旧工作节点和主版本号不同的工作节点都被拒绝
+	for _, version := range []*pb.APIVersion{nil, {Major: pb.APIMajor + 1}} {
+		stream, err := client.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Register{Register: &pb.RegisterNode{
+			NodeId: "node-1", Ip: "10.0.0.1", Port: "10000", ApiVersion: version,
+		}}})
+		_, err = stream.Recv()
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("版本 %v 应该返回 FailedPrecondition，得到 %v", version, err)
+		}
+	}
+	if len(cm.GetNodes()) != 0 {
+		t.Fatal("不兼容的节点不应该出现在集群中")
+	}
+}
@@ -0,0 +1,331 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+)
+
+// 预留的状态
+const (
+	// 已经调度到节点上，容器还没有启动完成
+	ReservationPending = "pending"
+	// 容器已经启动，显存已经被实际占用
+	ReservationCommitted = "committed"
+)
+
+// 节点上剩余显存不足以完成预留
+var ErrInsufficientMemory = errors.New("节点显存不足")
+
+// GPU已经被独占实例占用，或者独占GPU的预留遇到了已经有实例的GPU
+var ErrGPUExclusive = errors.New("GPU被独占")
+
+// Reservation 一次调度在某个节点上预留的显存
+// 心跳上报的 FreeMemoryMB 只有在下一次心跳时才会变化，
+// 在那之前调度器需要用预留记录扣除已经分配出去的显存，避免重复分配
+type Reservation struct {
+	ID          string            `json:"id"`
+	NodeID      string            `json:"node_id"`
+	GPUMemMB    map[string]uint64 `json:"gpu_mem_mb"` // GPU编号 -> 预留的显存
+	State       string            `json:"state"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CommittedAt time.Time         `json:"committed_at"`
+	// 提交之后收到了新的心跳，说明占用已经体现在上报的可用显存中，不再重复扣除
+	Reconciled bool `json:"reconciled"`
+	// 预留的GPU被实例独占，其他预留不能再使用这些GPU
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+// 预留是否还需要从上报的可用显存中扣除
+func (r *Reservation) outstanding() bool {
+	return r.State == ReservationPending || !r.Reconciled
+}
+
+// ReservationRequest 在一个节点上预留显存的请求
+type ReservationRequest struct {
+	NodeID   string
+	GPUMemMB map[string]uint64 // GPU编号 -> 需要预留的显存
+	// 可以使用空闲实例占用的显存，启动时由工作节点卸载这些实例
+	Evict bool
+	// 实例独占预留的GPU
+	Exclusive bool
+}
+
+// Reserve 在节点的GPU上预留显存，检查和扣除在同一把锁内完成，返回预留ID
+func (cm *ClusterManager) Reserve(nodeID string, gpuMemMB map[string]uint64) (string, error) {
+	ids, err := cm.ReserveAll([]ReservationRequest{{NodeID: nodeID, GPUMemMB: gpuMemMB}})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// ReserveAll 在多个节点上同时预留显存，要么全部成功，要么全部不预留，
+// 返回的预留ID与请求一一对应
+func (cm *ClusterManager) ReserveAll(reqs []ReservationRequest) ([]string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	ids := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		id, err := cm.reserveLocked(req)
+		if err != nil {
+			// 回滚已经完成的预留
+			for _, done := range ids {
+				delete(cm.reservations, done)
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 检查显存和GPU独占并记录预留，调用方需要持有锁。
+// Evict为true时空闲实例占用的显存也算作可用：按最近使用时间从旧到新挑出需要卸载的实例，
+// 把它们标记为被这次预留占用，在预留提交或者释放之前其他预留不能再使用它们的显存
+func (cm *ClusterManager) reserveLocked(req ReservationRequest) (string, error) {
+	nodeID, gpuMemMB, evict := req.NodeID, req.GPUMemMB, req.Evict
+	node, exists := cm.nodes[nodeID]
+	if !exists {
+		return "", fmt.Errorf("node %s not found", nodeID)
+	}
+	holders, exclusive := cm.gpuHoldersLocked(nodeID)
+
+	var victims []*Instance
+	freed := make(map[string]uint64)
+	for _, gpuID := range sortedGPUIDs(gpuMemMB) {
+		need := gpuMemMB[gpuID]
+		if _, ok := node.GPUs[gpuID]; !ok {
+			return "", fmt.Errorf("node %s has no GPU %s", nodeID, gpuID)
+		}
+		if exclusive[gpuID] || (req.Exclusive && holders[gpuID] > 0) {
+			return "", fmt.Errorf("%w: 节点 %s 的GPU %s", ErrGPUExclusive, nodeID, gpuID)
+		}
+		free := cm.availableMemoryMB(node, gpuID)
+		if evict && free+freed[gpuID] < need {
+			for _, inst := range cm.reclaimableInstancesLocked(nodeID) {
+				if free+freed[gpuID] >= need {
+					break
+				}
+				r := cm.reservations[inst.ReservationID]
+				if r.GPUMemMB[gpuID] == 0 || slices.Contains(victims, inst) {
+					continue
+				}
+				victims = append(victims, inst)
+				for id, mb := range r.GPUMemMB {
+					freed[id] += mb
+				}
+			}
+		}
+		if free+freed[gpuID] < need {
+			return "", fmt.Errorf("%w: 节点 %s 的GPU %s 可用 %d MB，需要 %d MB", ErrInsufficientMemory, nodeID, gpuID, free+freed[gpuID], need)
+		}
+	}
+
+	cm.nextReservation++
+	id := fmt.Sprintf("rsv-%d", cm.nextReservation)
+	reserved := make(map[string]uint64, len(gpuMemMB))
+	for gpuID, need := range gpuMemMB {
+		reserved[gpuID] = need
+	}
+	cm.reservations[id] = &Reservation{
+		ID:        id,
+		NodeID:    nodeID,
+		GPUMemMB:  reserved,
+		State:     ReservationPending,
+		CreatedAt: time.Now(),
+		Exclusive: req.Exclusive,
+	}
+	for _, inst := range victims {
+		inst.claimedBy = id
+	}
+	return id, nil
+}
+
+// 按GPU编号排序，保证挑选卸载实例的结果确定
+func sortedGPUIDs(gpuMemMB map[string]uint64) []string {
+	ids := make([]string, 0, len(gpuMemMB))
+	for id := range gpuMemMB {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CommitReservation 容器启动成功后把预留标记为已提交
+func (cm *ClusterManager) CommitReservation(id string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	r, exists := cm.reservations[id]
+	if !exists {
+		return fmt.Errorf("reservation %s not found", id)
+	}
+	r.State = ReservationCommitted
+	r.CommittedAt = time.Now()
+	return nil
+}
+
+// ReleaseReservation 任务失败或者实例停止时释放预留
+func (cm *ClusterManager) ReleaseReservation(id string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.reservations, id)
+}
+
+// GetReservations 获取所有预留记录的副本
+func (cm *ClusterManager) GetReservations() []Reservation {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	reservations := make([]Reservation, 0, len(cm.reservations))
+	for _, r := range cm.reservations {
+		reservations = append(reservations, *r)
+	}
+	return reservations
+}
+
+// 扣除预留之后GPU上的可用显存，调用方需要持有锁
+func (cm *ClusterManager) availableMemoryMB(node *Node, gpuID string) uint64 {
+	free := node.GPUs[gpuID].FreeMemoryMB
+	for _, r := range cm.reservations {
+		if r.NodeID != node.NodeID || !r.outstanding() {
+			continue
+		}
+		need := r.GPUMemMB[gpuID]
+		if need >= free {
+			return 0
+		}
+		free -= need
+	}
+	return free
+}
+
+// 节点上每张GPU的预留个数，以及哪些GPU被独占预留占用，调用方需要持有锁。
+// 预留在实例停止时才释放，所以已经启动的实例也包括在内
+func (cm *ClusterManager) gpuHoldersLocked(nodeID string) (map[string]int, map[string]bool) {
+	holders := make(map[string]int)
+	exclusive := make(map[string]bool)
+	for _, r := range cm.reservations {
+		if r.NodeID != nodeID {
+			continue
+		}
+		for gpuID := range r.GPUMemMB {
+			holders[gpuID]++
+			if r.Exclusive {
+				exclusive[gpuID] = true
+			}
+		}
+	}
+	return holders, exclusive
+}
+
+// 实例已经被一个还没有提交的预留选为卸载对象，它的显存已经许诺给了那次预留。
+// 预留提交或者释放之后标记自动失效，调用方需要持有锁
+func (cm *ClusterManager) claimedLocked(inst *Instance) bool {
+	if inst.claimedBy == "" {
+		return false
+	}
+	r, exists := cm.reservations[inst.claimedBy]
+	return exists && r.State == ReservationPending
+}
+
+// 节点上可以被工作节点按LRU卸载的空闲实例，按最近使用时间从旧到新排序。
+// 组调度的实例由master管理，工作节点不会卸载它们；已经被其他预留选中的实例也不算在内。
+// 调用方需要持有锁
+func (cm *ClusterManager) reclaimableInstancesLocked(nodeID string) []*Instance {
+	var insts []*Instance
+	for _, inst := range cm.instances {
+		if inst.NodeID != nodeID || inst.State != InstanceReady || inst.InFlight > 0 || len(inst.Members) > 0 {
+			continue
+		}
+		if _, exists := cm.reservations[inst.ReservationID]; !exists || cm.claimedLocked(inst) {
+			continue
+		}
+		insts = append(insts, inst)
+	}
+	sort.Slice(insts, func(i, j int) bool {
+		if !insts[i].LastUsed.Equal(insts[j].LastUsed) {
+			return insts[i].LastUsed.Before(insts[j].LastUsed)
+		}
+		return insts[i].InstanceID < insts[j].InstanceID
+	})
+	return insts
+}
+
+// 节点上每张GPU被可卸载的空闲实例占用的显存，调用方需要持有锁
+func (cm *ClusterManager) reclaimableMemoryMB(nodeID string) map[string]uint64 {
+	reclaimable := make(map[string]uint64)
+	for _, inst := range cm.reclaimableInstancesLocked(nodeID) {
+		for gpuID, mb := range cm.reservations[inst.ReservationID].GPUMemMB {
+			reclaimable[gpuID] += mb
+		}
+	}
+	return reclaimable
+}
+
+// 用新的心跳对账：在采集GPU信息之前已经提交的预留，其占用已经体现在上报的显存中。
+// 在提交之前采集、提交之后才收到的心跳不能对账，否则同一块显存会被释放两次。
+// 没有采集时间的旧工作节点不对账，宁可少分配也不超额分配，调用方需要持有锁
+func (cm *ClusterManager) reconcileReservations(nodeID string, sampledAt time.Time) {
+	if sampledAt.IsZero() {
+		return
+	}
+	for _, r := range cm.reservations {
+		if r.NodeID != nodeID || r.State != ReservationCommitted || r.Reconciled {
+			continue
+		}
+		if r.CommittedAt.Before(sampledAt) {
+			r.Reconciled = true
+		}
+	}
+}
+
+// 节点下线时丢弃它上面的所有预留，调用方需要持有锁
+func (cm *ClusterManager) dropNodeReservations(nodeID string) {
+	for id, r := range cm.reservations {
+		if r.NodeID == nodeID {
+			log.Printf("Reservation %s on node %s dropped", id, nodeID)
+			delete(cm.reservations, id)
+		}
+	}
+}
+
+// AvailableNodes 获取所有节点，GPU的可用显存已经扣除了未对账的预留，
+// 并给出空闲实例占用的可回收显存和GPU的独占情况，供调度器使用
+func (cm *ClusterManager) AvailableNodes() map[string]*Node {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	nodesCopy := make(map[string]*Node)
+	for id, node := range cm.nodes {
+		reclaimable := cm.reclaimableMemoryMB(id)
+		holders, exclusive := cm.gpuHoldersLocked(id)
+		gpus := make(map[string]GPU, len(node.GPUs))
+		for gpuID, gpu := range node.GPUs {
+			gpu.FreeMemoryMB = cm.availableMemoryMB(node, gpuID)
+			gpu.ReclaimableMemoryMB = reclaimable[gpuID]
+			gpu.Holders = holders[gpuID]
+			gpu.Exclusive = exclusive[gpuID]
+			gpus[gpuID] = gpu
+		}
+		nodesCopy[id] = &Node{
+			NodeID:     node.NodeID,
+			IP:         node.IP,
+			Port:       node.Port,
+			LastActive: node.LastActive,
+			Status:     node.Status,
+			GPUs:       gpus,
+			Images:     node.Images,
+			Draining:   node.Draining,
+			APIVersion: node.APIVersion,
+
+			DisconnectedAt: node.DisconnectedAt,
+		}
+	}
+	return nodesCopy
+}
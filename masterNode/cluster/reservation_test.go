@@ -0,0 +1,168 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReservationLedger(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, time.Now())
+
+	// 第一次预留成功后，下一次心跳之前同一张GPU不能再被分配出去
+	id, err := cm.Reserve("node-1", map[string]uint64{"0": 16384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("扣除预留后可用显存 %d MB，期望 4096 MB", free)
+	}
+	if _, err := cm.Reserve("node-1", map[string]uint64{"0": 16384}); !errors.Is(err, ErrInsufficientMemory) {
+		t.Fatalf("重复预留应该失败，得到 %v", err)
+	}
+
+	// 提交后在新心跳到来之前仍然扣除
+	cm.CommitReservation(id)
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("提交后可用显存 %d MB，期望 4096 MB", free)
+	}
+
+	// 新心跳已经反映了显存占用，对账后不再重复扣除
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 4096},
+	}, time.Now())
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("对账后可用显存 %d MB，期望 4096 MB", free)
+	}
+
+	// 未提交的预留释放后显存立刻可用
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, time.Now())
+	cm.ReleaseReservation(id)
+	id, err = cm.Reserve("node-1", map[string]uint64{"0": 16384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.ReleaseReservation(id)
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 20480 {
+		t.Fatalf("释放后可用显存 %d MB，期望 20480 MB", free)
+	}
+}
+
+func TestReservationReconcileUsesSampleTime(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, time.Now())
+
+	id, err := cm.Reserve("node-1", map[string]uint64{"0": 16384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampled := time.Now()
+	cm.CommitReservation(id)
+
+	// 在提交之前采集、提交之后才收到的心跳还没有反映显存占用，不能对账
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, sampled.Add(-time.Millisecond))
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("旧的采集结果对账后可用显存 %d MB，期望 4096 MB", free)
+	}
+
+	// 没有采集时间的心跳也不对账
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, time.Time{})
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("没有采集时间的心跳对账后可用显存 %d MB，期望 4096 MB", free)
+	}
+
+	// 提交之后采集的心跳才对账
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 4096},
+	}, time.Now().Add(time.Millisecond))
+	if free := cm.AvailableNodes()["node-1"].GPUs["0"].FreeMemoryMB; free != 4096 {
+		t.Fatalf("对账后可用显存 %d MB，期望 4096 MB", free)
+	}
+}
+
+// 两次需要卸载实例的预留争用同一个空闲实例，只有第一次能成功
+func TestEvictReservationsClaimIdleInstanceOnce(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 40960}}, time.Now())
+
+	// 一个空闲的实例占用30GB，心跳已经反映了占用
+	rsv, err := cm.Reserve("node-1", map[string]uint64{"0": 30 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.AddInstance(Instance{InstanceID: "inst-idle", ModelName: "a", NodeID: "node-1", GPUIDs: []string{"0"}, ReservationID: rsv})
+	cm.CommitReservation(rsv)
+	cm.MarkInstanceReady("inst-idle", "31000")
+	cm.ReleaseInstance("inst-idle")
+	cm.UpdateHeartbeat("node-1", map[string]GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 10 * 1024}}, time.Now().Add(time.Second))
+
+	need := map[string]uint64{"0": 30 * 1024}
+	if _, err := cm.ReserveAll([]ReservationRequest{{NodeID: "node-1", GPUMemMB: need}}); !errors.Is(err, ErrInsufficientMemory) {
+		t.Fatalf("不允许卸载实例时应该放不下，得到 %v", err)
+	}
+	first, err := cm.ReserveAll([]ReservationRequest{{NodeID: "node-1", GPUMemMB: need, Evict: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpu := cm.AvailableNodes()["node-1"].GPUs["0"]; gpu.ReclaimableMemoryMB != 0 {
+		t.Fatalf("已经被选中卸载的实例不应该再算作可回收，得到 %d MB", gpu.ReclaimableMemoryMB)
+	}
+	if _, err := cm.ReserveAll([]ReservationRequest{{NodeID: "node-1", GPUMemMB: need, Evict: true}}); !errors.Is(err, ErrInsufficientMemory) {
+		t.Fatalf("第二次预留不能再使用同一个实例的显存，得到 %v", err)
+	}
+	if _, ok := cm.AcquireInstance("a"); ok {
+		t.Fatal("即将被卸载的实例不应该再接收任务")
+	}
+
+	// 第一次预留释放后，实例又可以被卸载
+	cm.ReleaseReservation(first[0])
+	if _, err := cm.ReserveAll([]ReservationRequest{{NodeID: "node-1", GPUMemMB: need, Evict: true}}); err != nil {
+		t.Fatalf("释放之后应该可以再预留: %v", err)
+	}
+}
+
+func TestExclusiveReservationsConflictBothWays(t *testing.T) {
+	cm := NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]GPU{
+		"0": {TotalMemoryMB: 81920, FreeMemoryMB: 81920},
+		"1": {TotalMemoryMB: 81920, FreeMemoryMB: 81920},
+	}, time.Now())
+
+	// GPU 0 上已经有共享的实例，独占的预留不能再使用它
+	if _, err := cm.Reserve("node-1", map[string]uint64{"0": 8192}); err != nil {
+		t.Fatal(err)
+	}
+	exclusive := ReservationRequest{NodeID: "node-1", GPUMemMB: map[string]uint64{"0": 8192}, Exclusive: true}
+	if _, err := cm.ReserveAll([]ReservationRequest{exclusive}); !errors.Is(err, ErrGPUExclusive) {
+		t.Fatalf("独占预留使用了共享的GPU，得到 %v", err)
+	}
+
+	// GPU 1 被独占之后，共享的预留也不能再使用它
+	exclusive.GPUMemMB = map[string]uint64{"1": 8192}
+	if _, err := cm.ReserveAll([]ReservationRequest{exclusive}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.Reserve("node-1", map[string]uint64{"1": 8192}); !errors.Is(err, ErrGPUExclusive) {
+		t.Fatalf("共享预留使用了独占的GPU，得到 %v", err)
+	}
+
+	gpus := cm.AvailableNodes()["node-1"].GPUs
+	if gpus["0"].Exclusive || gpus["0"].Holders != 1 || !gpus["1"].Exclusive || gpus["1"].Holders != 1 {
+		t.Fatalf("GPU独占情况 %+v", gpus)
+	}
+}
@@ -2,11 +2,23 @@ module lightScheduler
 
 go 1.24.1
 
+require (
+	api v0.0.0-00010101000000-000000000000
+	catalog v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.71.1
+	google.golang.org/protobuf v1.36.4
+)
+
 require (
 	golang.org/x/net v0.34.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
-	google.golang.org/grpc v1.71.1 // indirect
-	google.golang.org/protobuf v1.36.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// master和工作节点之间的接口定义
+replace api => ../api
+
+// 模型目录由master和工作节点共用
+replace catalog => ../catalog
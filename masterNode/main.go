@@ -1,30 +1,97 @@
 package main
 
 import (
+	"api/pki"
+	"catalog"
+	"flag"
 	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
 	"lightScheduler/task"
 	"log"
+	"strings"
 	"time"
 )
 
 func main() {
+	// 调度策略在启动时通过命令行参数选择
+	policy := flag.String("policy", scheduler.PolicyFirstFit, "调度策略: first-fit, best-fit, spread(worst-fit), random")
+	agingInterval := flag.Duration("aging-interval", task.DefaultAgingInterval, "任务每等待这么久优先级提高1级，0表示不老化")
+	dispatchers := flag.Int("dispatchers", task.DefaultDispatchers, "并发调度任务的协程数")
+	adminToken := flag.String("admin-token", "", "管理接口（/admin/...）的令牌，为空时关闭所有管理接口")
+	modelCatalog := flag.String("models", "", "模型目录文件，修改后自动重新加载，为空时使用内置目录")
+	queueCapacity := flag.Int("queue-capacity", task.DefaultQueueCapacity, "所有租户合计最多排队的任务数")
+	maxAttempts := flag.Int("max-attempts", task.DefaultRetryPolicy.MaxAttempts, "每个任务最多尝试调度的次数，用尽后进入死信队列")
+	pkiDir := flag.String("pki-dir", "pki", "CA和证书所在的目录，第一次启动时自动创建CA")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "master证书中的主机名和IP，用逗号分隔，工作节点用它们连接master")
+	insecureMode := flag.Bool("insecure", false, "master和工作节点之间不使用TLS，只用于本地调试")
+	flag.Parse()
+
+	sched, err := scheduler.New(*policy)
+	if err != nil {
+		log.Fatalf("Failed to create scheduler: %v", err)
+	}
+	log.Printf("使用调度策略: %s", sched.Name())
+
+	// 模型目录和工作节点共用同一个文件
+	if *modelCatalog != "" {
+		c, err := catalog.Load(*modelCatalog)
+		if err != nil {
+			log.Fatalf("Failed to load model catalog: %v", err)
+		}
+		task.SetModels(c)
+		log.Printf("加载模型目录 %s，共 %d 个模型", *modelCatalog, len(c.Models))
+		go catalog.Watch(*modelCatalog, catalog.DefaultWatchInterval, nil, task.SetModels)
+	}
+
 	// 创建集群管理器，设置心跳间隔为5秒，超时时间为15秒
 	cm := cluster.NewClusterManager(5*time.Second, 150000*time.Second)
 
 	// 启动健康检查
 	go cm.StartHealthCheck()
 
-	// 启动注册&心跳监测HTTP服务器
+	// 创建任务等待队列
+	wq := task.NewTaskWaitQueueWithAging(128, *agingInterval)
+	wq.SetCapacity(*queueCapacity)
+
+	// master作为CA给自己和工作节点签发证书，和工作节点之间的连接都使用双向TLS
+	if !*insecureMode {
+		ca, err := pki.LoadOrCreateAuthority(*pkiDir)
+		if err != nil {
+			log.Fatalf("Failed to load CA: %v", err)
+		}
+		master_hosts := strings.Split(*hosts, ",")
+		issue := func() ([]byte, []byte, []byte, error) {
+			certPEM, keyPEM, err := ca.Issue(pki.MasterName, master_hosts, cluster.NodeCertTTL)
+			return certPEM, keyPEM, ca.CertPEM(), err
+		}
+		certPEM, keyPEM, caPEM, err := issue()
+		if err != nil {
+			log.Fatalf("Failed to issue master certificate: %v", err)
+		}
+		creds, err := pki.NewCredentials(certPEM, keyPEM, caPEM)
+		if err != nil {
+			log.Fatalf("Failed to load master certificate: %v", err)
+		}
+		// 证书快到期时直接重新签发，不需要重启
+		go pki.Rotate(creds, issue, nil)
+		cm.EnableTLS(ca, creds)
+		wq.SetWorkerCredentials(creds)
+		log.Printf("CA指纹: %s，工作节点加入集群时需要它和 /admin/join-tokens 生成的令牌", ca.Hash())
+	}
+
+	// 启动接收工作节点控制流的gRPC服务器，工作节点通过它注册、发送心跳并接收命令
 	go func() {
-		if err := cm.StartHeartbeatHTTPServer("8080"); err != nil {
-			log.Fatalf("Failed to start HTTP server: %v", err)
+		if err := cm.StartNodeServer("8080"); err != nil {
+			log.Fatalf("Failed to start node control server: %v", err)
 		}
 	}()
 
-	// 创建任务等待队列
-	wq := task.NewTaskWaitQueue(128)
+	retry := task.DefaultRetryPolicy
+	retry.MaxAttempts = *maxAttempts
+	wq.SetRetryPolicy(retry)
+	wq.SetAdminToken(*adminToken)
 	// 启动队伍处理，不断检查队伍中是否有新的任务
-	go wq.HandleQueue(cm)
+	go wq.HandleQueue(cm, sched, *dispatchers)
 	// 启动接受推理请求的服务器
 	if err := wq.StartTaskHTTPServer("8081"); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"lightScheduler/cluster"
+	"sort"
+)
+
+// ScheduleGang 组调度：单个节点放不下模型时，把模型平均切分到多个节点上，
+// 最多使用 maxNodes 个节点，返回的放置方案按rank排序，第一个是rank 0。
+// 能放在单个节点上时只返回一个放置方案，maxNodes 小于等于1时等同于 Schedule
+func ScheduleGang(s Scheduler, req *Request, nodes map[string]*cluster.Node, maxNodes int) ([]*Placement, error) {
+	p, err := Schedule(s, req, nodes)
+	if err == nil {
+		return []*Placement{p}, nil
+	}
+	if !errors.Is(err, ErrNoFeasibleNode) {
+		return nil, err
+	}
+
+	type candidate struct {
+		p     *Placement
+		score float64
+	}
+	for n := 2; n <= maxNodes && n <= len(nodes); n++ {
+		// 每个节点分担的显存，向上取整
+		share := *req
+		share.RequireMemMB = (req.RequireMemMB + uint64(n) - 1) / uint64(n)
+
+		var candidates []candidate
+		for _, id := range sortedNodeIDs(nodes) {
+			if p := s.Filter(&share, nodes[id]); p != nil {
+				candidates = append(candidates, candidate{p: p, score: s.Score(&share, p)})
+			}
+		}
+		if len(candidates) < n {
+			continue
+		}
+
+		// 缓存了镜像、分数高的节点优先，同等条件下保持节点ID的顺序
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			return preferred(&share, a.p, a.score, b.p, b.score)
+		})
+		placements := make([]*Placement, n)
+		for i := range placements {
+			placements[i] = candidates[i].p
+		}
+		return placements, nil
+	}
+
+	return nil, fmt.Errorf("%w: 模型 %s 需要 %d MB 显存，最多 %d 个节点也放不下",
+		ErrNoFeasibleNode, req.ModelName, req.RequireMemMB, max(maxNodes, 1))
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"fmt"
+	"lightScheduler/cluster"
+	"math/rand"
+	"sort"
+)
+
+// 内置策略名称
+const (
+	PolicyFirstFit = "first-fit"
+	PolicyBestFit  = "best-fit"
+	PolicySpread   = "spread"
+	PolicyRandom   = "random"
+)
+
+// New 根据策略名称创建调度器，在启动时选择
+func New(policy string) (Scheduler, error) {
+	switch policy {
+	case PolicyFirstFit, "":
+		return firstFit{}, nil
+	case PolicyBestFit:
+		return bestFit{}, nil
+	// worst-fit 与 spread 是同一种策略
+	case PolicySpread, "worst-fit":
+		return spread{}, nil
+	case PolicyRandom:
+		return random{}, nil
+	default:
+		return nil, fmt.Errorf("unknown scheduling policy %q", policy)
+	}
+}
+
+// GPU挑选顺序
+type gpuOrder int
+
+const (
+	byID       gpuOrder = iota // 按GPU编号
+	tightFirst                 // 可用显存少的优先
+	roomyFirst                 // 可用显存多的优先
+)
+
+// 节点上所有GPU的可用显存之和
+func nodeFreeMemoryMB(node *cluster.Node) uint64 {
+	var free uint64
+	for _, gpu := range node.GPUs {
+		free += gpu.FreeMemoryMB
+	}
+	return free
+}
+
+// GPU编号按数值大小比较，"10" 排在 "9" 后面
+func lessGPUID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// GPU上可以使用的显存，evict为true时包括空闲实例占用、可以被卸载的显存
+func usableMemoryMB(gpu cluster.GPU, evict bool) uint64 {
+	if evict {
+		return gpu.FreeMemoryMB + gpu.ReclaimableMemoryMB
+	}
+	return gpu.FreeMemoryMB
+}
+
+// GPU能否放下请求的实例：被独占的GPU不能再放其他实例，独占GPU的模型只能放在没有实例的GPU上
+func compatible(req *Request, gpu cluster.GPU) bool {
+	return !gpu.Exclusive && !(req.Exclusive && gpu.Holders > 0)
+}
+
+// 所有策略共用的过滤逻辑：节点必须在线，并且能在具体的GPU上放下模型。
+// 优先放在单张GPU上，放不下时才按 MaxGPUs 逐步增加切分的GPU数量，
+// 每张GPU平均分担模型所需的显存。
+// 空闲显存放不下时，把空闲实例占用的显存也算作可用，启动时由工作节点按LRU卸载这些实例
+func fitGPUs(req *Request, node *cluster.Node, order gpuOrder) *Placement {
+	if node.Status != "online" {
+		return nil
+	}
+	// 不需要显存的模型不占用GPU
+	if req.RequireMemMB == 0 {
+		return &Placement{Node: node}
+	}
+	if p := fitGPUsUsing(req, node, order, false); p != nil {
+		return p
+	}
+	return fitGPUsUsing(req, node, order, true)
+}
+
+func fitGPUsUsing(req *Request, node *cluster.Node, order gpuOrder, evict bool) *Placement {
+	ids := make([]string, 0, len(node.GPUs))
+	for id, gpu := range node.GPUs {
+		if compatible(req, gpu) {
+			ids = append(ids, id)
+		}
+	}
+	usable := func(id string) uint64 {
+		return usableMemoryMB(node.GPUs[id], evict)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := usable(ids[i]), usable(ids[j])
+		switch {
+		case order == tightFirst && a != b:
+			return a < b
+		case order == roomyFirst && a != b:
+			return a > b
+		}
+		return lessGPUID(ids[i], ids[j])
+	})
+
+	maxGPUs := req.MaxGPUs
+	if maxGPUs < 1 {
+		maxGPUs = 1
+	}
+	for k := 1; k <= maxGPUs && k <= len(ids); k++ {
+		// 向上取整，保证切分后的显存总和不小于需求
+		perGPU := (req.RequireMemMB + uint64(k) - 1) / uint64(k)
+		var chosen []string
+		for _, id := range ids {
+			if usable(id) >= perGPU {
+				chosen = append(chosen, id)
+				if len(chosen) == k {
+					break
+				}
+			}
+		}
+		if len(chosen) == k {
+			sort.Slice(chosen, func(i, j int) bool { return lessGPUID(chosen[i], chosen[j]) })
+			return &Placement{Node: node, GPUIDs: chosen, PerGPUMemMB: perGPU, Evict: evict}
+		}
+	}
+	return nil
+}
+
+// 放置后选中GPU上剩余的显存
+func chosenLeftoverMB(p *Placement) uint64 {
+	var left uint64
+	for _, id := range p.GPUIDs {
+		left += usableMemoryMB(p.Node.GPUs[id], p.Evict) - p.PerGPUMemMB
+	}
+	return left
+}
+
+// firstFit 选择按节点ID排序后第一个放得下的节点，GPU按编号挑选
+type firstFit struct{}
+
+func (firstFit) Name() string { return PolicyFirstFit }
+func (firstFit) Filter(req *Request, node *cluster.Node) *Placement {
+	return fitGPUs(req, node, byID)
+}
+func (firstFit) Score(req *Request, p *Placement) float64 { return 0 }
+
+// bestFit 选择放下后GPU剩余显存最少的方案，尽量把任务打包到一起
+type bestFit struct{}
+
+func (bestFit) Name() string { return PolicyBestFit }
+func (bestFit) Filter(req *Request, node *cluster.Node) *Placement {
+	return fitGPUs(req, node, tightFirst)
+}
+func (bestFit) Score(req *Request, p *Placement) float64 {
+	return -float64(chosenLeftoverMB(p))
+}
+
+// spread 选择放下后节点剩余显存最多的方案，尽量把任务分散开
+type spread struct{}
+
+func (spread) Name() string { return PolicySpread }
+func (spread) Filter(req *Request, node *cluster.Node) *Placement {
+	return fitGPUs(req, node, roomyFirst)
+}
+func (spread) Score(req *Request, p *Placement) float64 {
+	return float64(nodeFreeMemoryMB(p.Node)) - float64(p.PerGPUMemMB)*float64(len(p.GPUIDs))
+}
+
+// random 在放得下的节点中随机选择一个
+type random struct{}
+
+func (random) Name() string { return PolicyRandom }
+func (random) Filter(req *Request, node *cluster.Node) *Placement {
+	return fitGPUs(req, node, byID)
+}
+func (random) Score(req *Request, p *Placement) float64 { return rand.Float64() }
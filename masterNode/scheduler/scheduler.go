@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"lightScheduler/cluster"
+	"sort"
+)
+
+// Request 一次调度中与放置相关的需求
+type Request struct {
+	ModelName    string
+	RequireMemMB uint64
+	// 模型最多可以切分到几张GPU上，小于等于1表示必须放在单张GPU上
+	MaxGPUs int
+	// 模型的容器镜像，已经缓存了镜像的节点优先
+	Image string
+	// 模型独占分配给它的GPU，不能和其他实例共用GPU
+	Exclusive bool
+}
+
+// Placement 调度决策：目标节点以及在该节点上选中的GPU
+type Placement struct {
+	Node   *cluster.Node
+	GPUIDs []string
+	// 每张选中的GPU上需要占用的显存
+	PerGPUMemMB uint64
+	// 空闲显存放不下，需要工作节点先卸载选中GPU上的空闲实例
+	Evict bool
+}
+
+// Scheduler 调度策略接口，一次调度分为过滤和打分两个阶段
+type Scheduler interface {
+	// Name 策略名称
+	Name() string
+	// Filter 过滤阶段，返回节点上能容纳该请求的GPU放置方案，放不下返回nil
+	Filter(req *Request, node *cluster.Node) *Placement
+	// Score 打分阶段，给通过过滤的放置方案打分，分数越高越优先
+	Score(req *Request, p *Placement) float64
+}
+
+// 没有任何节点能容纳请求时返回的错误
+var ErrNoFeasibleNode = errors.New("没有找到合适的节点调度任务")
+
+// Schedule 用给定的策略在节点中选出放置方案
+func Schedule(s Scheduler, req *Request, nodes map[string]*cluster.Node) (*Placement, error) {
+	var best *Placement
+	var bestScore float64
+	for _, id := range sortedNodeIDs(nodes) {
+		p := s.Filter(req, nodes[id])
+		if p == nil {
+			continue
+		}
+		score := s.Score(req, p)
+		if best == nil || preferred(req, p, score, best, bestScore) {
+			best = p
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("%w: 模型 %s 需要 %d MB 显存", ErrNoFeasibleNode, req.ModelName, req.RequireMemMB)
+	}
+	return best, nil
+}
+
+// 放置方案a是否优于b：不需要卸载实例的方案优先；其次已经缓存了模型镜像的节点优先，
+// 不用先花几分钟拉取镜像；都相同时比较策略打出的分数
+func preferred(req *Request, a *Placement, aScore float64, b *Placement, bScore float64) bool {
+	if a.Evict != b.Evict {
+		return !a.Evict
+	}
+	aCached, bCached := a.Node.HasImage(req.Image), b.Node.HasImage(req.Image)
+	if aCached != bCached {
+		return aCached
+	}
+	return aScore > bScore
+}
+
+// 按节点ID排序，保证同分时结果确定，不受map随机遍历顺序影响
+func sortedNodeIDs(nodes map[string]*cluster.Node) []string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
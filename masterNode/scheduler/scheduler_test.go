@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"errors"
+	"lightScheduler/cluster"
+	"testing"
+)
+
+// 构造一个只有一张GPU的在线节点
+func fakeNode(id string, freeMB uint64) *cluster.Node {
+	return &cluster.Node{
+		NodeID: id,
+		Status: "online",
+		GPUs: map[string]cluster.GPU{
+			"0": {TotalMemoryMB: 81920, FreeMemoryMB: freeMB},
+		},
+	}
+}
+
+func TestSchedulePolicies(t *testing.T) {
+	nodes := map[string]*cluster.Node{
+		"node-a": fakeNode("node-a", 20*1024),
+		"node-b": fakeNode("node-b", 40*1024),
+		"node-c": fakeNode("node-c", 17*1024),
+		"node-d": fakeNode("node-d", 8*1024),
+	}
+	req := &Request{ModelName: "llama3-8b", RequireMemMB: 16 * 1024}
+
+	cases := map[string]string{
+		PolicyFirstFit: "node-a",
+		PolicyBestFit:  "node-c",
+		PolicySpread:   "node-b",
+	}
+	for policy, want := range cases {
+		s, err := New(policy)
+		if err != nil {
+			t.Fatalf("New(%q): %v", policy, err)
+		}
+		got, err := Schedule(s, req, nodes)
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if got.Node.NodeID != want {
+			t.Errorf("%s 选择了 %s，期望 %s", policy, got.Node.NodeID, want)
+		}
+	}
+
+	s, _ := New(PolicyRandom)
+	for i := 0; i < 20; i++ {
+		got, err := Schedule(s, req, nodes)
+		if err != nil {
+			t.Fatalf("random: %v", err)
+		}
+		if got.Node.NodeID == "node-d" {
+			t.Fatalf("random 选择了放不下的节点 %s", got.Node.NodeID)
+		}
+	}
+}
+
+func TestScheduleNoFeasibleNode(t *testing.T) {
+	nodes := map[string]*cluster.Node{
+		"node-a": fakeNode("node-a", 8*1024),
+	}
+	unhealthy := fakeNode("node-b", 80*1024)
+	unhealthy.Status = "unhealthy"
+	nodes["node-b"] = unhealthy
+
+	s, _ := New(PolicyFirstFit)
+	_, err := Schedule(s, &Request{ModelName: "llama3-8b", RequireMemMB: 16 * 1024}, nodes)
+	if !errors.Is(err, ErrNoFeasibleNode) {
+		t.Fatalf("期望 ErrNoFeasibleNode，得到 %v", err)
+	}
+
+	if _, err := New("unknown"); err == nil {
+		t.Fatal("未知策略应该返回错误")
+	}
+}
+
+func TestSchedulePerGPU(t *testing.T) {
+	// 两张10GB的GPU，总量够但单张放不下16GB的模型
+	nodes := map[string]*cluster.Node{
+		"node-a": {
+			NodeID: "node-a",
+			Status: "online",
+			GPUs: map[string]cluster.GPU{
+				"0": {FreeMemoryMB: 10 * 1024},
+				"1": {FreeMemoryMB: 10 * 1024},
+			},
+		},
+	}
+	s, _ := New(PolicyFirstFit)
+
+	req := &Request{ModelName: "llama3-8b", RequireMemMB: 16 * 1024}
+	if _, err := Schedule(s, req, nodes); !errors.Is(err, ErrNoFeasibleNode) {
+		t.Fatalf("不允许切分时应该放不下，得到 %v", err)
+	}
+
+	req.MaxGPUs = 2
+	p, err := Schedule(s, req, nodes)
+	if err != nil {
+		t.Fatalf("允许切分到两张GPU时应该能放下: %v", err)
+	}
+	if len(p.GPUIDs) != 2 || p.GPUIDs[0] != "0" || p.GPUIDs[1] != "1" {
+		t.Errorf("选中的GPU是 %v，期望 [0 1]", p.GPUIDs)
+	}
+	if p.PerGPUMemMB != 8*1024 {
+		t.Errorf("每张GPU占用 %d MB，期望 %d MB", p.PerGPUMemMB, 8*1024)
+	}
+
+	// 单张GPU能放下时不切分
+	nodes["node-a"].GPUs["2"] = cluster.GPU{FreeMemoryMB: 20 * 1024}
+	p, err = Schedule(s, req, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.GPUIDs) != 1 || p.GPUIDs[0] != "2" {
+		t.Errorf("选中的GPU是 %v，期望 [2]", p.GPUIDs)
+	}
+}
+
+func TestSchedulePrefersCachedImage(t *testing.T) {
+	nodes := map[string]*cluster.Node{
+		"node-a": fakeNode("node-a", 40*1024),
+		"node-b": fakeNode("node-b", 20*1024),
+		"node-c": fakeNode("node-c", 8*1024),
+	}
+	// node-c 有镜像但是放不下，不能选
+	nodes["node-b"].Images = []string{"model:v1"}
+	nodes["node-c"].Images = []string{"model:v1"}
+	req := &Request{ModelName: "llama3-8b", RequireMemMB: 16 * 1024, Image: "model:v1"}
+
+	s, _ := New(PolicySpread)
+	got, err := Schedule(s, req, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Node.NodeID != "node-b" {
+		t.Fatalf("选择了 %s，期望缓存了镜像的 node-b", got.Node.NodeID)
+	}
+
+	// 节点上报的是镜像的完整写法
+	nodes["node-b"].Images = []string{"docker.io/library/model:v1"}
+	if got, _ := Schedule(s, req, nodes); got.Node.NodeID != "node-b" {
+		t.Fatalf("选择了 %s，期望缓存了 docker.io/library/model:v1 的 node-b", got.Node.NodeID)
+	}
+}
+
+func TestScheduleCountsReclaimableMemoryLast(t *testing.T) {
+	// node-a 的显存被空闲实例占着，node-b 的空闲显存够用
+	nodes := map[string]*cluster.Node{
+		"node-a": fakeNode("node-a", 4*1024),
+		"node-b": fakeNode("node-b", 20*1024),
+	}
+	gpu := nodes["node-a"].GPUs["0"]
+	gpu.ReclaimableMemoryMB = 30 * 1024
+	nodes["node-a"].GPUs["0"] = gpu
+	req := &Request{ModelName: "llama3-8b", RequireMemMB: 16 * 1024, Image: "model:v1"}
+	// 即使 node-a 缓存了镜像，也优先选择不需要卸载实例的节点
+	nodes["node-a"].Images = []string{"model:v1"}
+
+	for _, policy := range []string{PolicyFirstFit, PolicyBestFit, PolicySpread} {
+		s, _ := New(policy)
+		got, err := Schedule(s, req, nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Node.NodeID != "node-b" || got.Evict {
+			t.Fatalf("%s: 选择了 %s (evict=%v)，期望不需要卸载实例的 node-b", policy, got.Node.NodeID, got.Evict)
+		}
+	}
+
+	// 只有卸载空闲实例才放得下时，选择 node-a 并标记需要卸载
+	delete(nodes, "node-b")
+	s, _ := New(PolicyBestFit)
+	got, err := Schedule(s, req, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Node.NodeID != "node-a" || !got.Evict {
+		t.Fatalf("选择了 %s (evict=%v)，期望卸载 node-a 上的空闲实例", got.Node.NodeID, got.Evict)
+	}
+}
+
+func TestScheduleSkipsConflictingExclusiveGPUs(t *testing.T) {
+	// node-a 的GPU 0 被独占实例占用，GPU 1 上有一个共享实例，GPU 2 没有实例
+	node := fakeNode("node-a", 0)
+	node.GPUs["0"] = cluster.GPU{TotalMemoryMB: 81920, FreeMemoryMB: 60 * 1024, Holders: 1, Exclusive: true}
+	node.GPUs["1"] = cluster.GPU{TotalMemoryMB: 81920, FreeMemoryMB: 50 * 1024, Holders: 1}
+	node.GPUs["2"] = cluster.GPU{TotalMemoryMB: 81920, FreeMemoryMB: 20 * 1024}
+	nodes := map[string]*cluster.Node{"node-a": node}
+	s, _ := New(PolicySpread)
+
+	// 共享的模型不能放到独占的GPU 0 上，即使它的空闲显存最多
+	got, err := Schedule(s, &Request{ModelName: "shared", RequireMemMB: 16 * 1024}, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GPUIDs) != 1 || got.GPUIDs[0] != "1" {
+		t.Fatalf("共享模型选择了GPU %v，期望GPU 1", got.GPUIDs)
+	}
+
+	// 独占的模型只能放到没有实例的GPU 2 上
+	got, err = Schedule(s, &Request{ModelName: "exclusive", RequireMemMB: 16 * 1024, Exclusive: true}, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GPUIDs) != 1 || got.GPUIDs[0] != "2" {
+		t.Fatalf("独占模型选择了GPU %v，期望GPU 2", got.GPUIDs)
+	}
+
+	// GPU 2 放不下时，独占的模型没有可用的GPU
+	_, err = Schedule(s, &Request{ModelName: "exclusive", RequireMemMB: 30 * 1024, Exclusive: true}, nodes)
+	if !errors.Is(err, ErrNoFeasibleNode) {
+		t.Fatalf("err = %v，期望 ErrNoFeasibleNode", err)
+	}
+}
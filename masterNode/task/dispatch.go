@@ -0,0 +1,339 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	pb "api/schedule"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 并发调度时，其他调度协程可能先一步预留了同一块显存，最多重新选择这么多次
+const maxPlacementConflicts = 3
+
+// 为任务选择节点和GPU并预留显存，单个节点放不下时按组调度放到多个节点上，
+// 返回的放置方案和预留ID按rank排序。
+// 选择基于某一时刻的节点快照，预留时会在集群管理器的锁内重新检查显存，
+// 多个调度协程同时选中同一块显存时只有一个能预留成功，其余的重新选择；
+// 组调度的所有成员要么全部预留成功，要么全部不预留
+func place(task *Task, cm *cluster.ClusterManager, sched scheduler.Scheduler) ([]*scheduler.Placement, []string, error) {
+	// 先获取任务中模型的显存需求
+	model_info, exists := lookupModel(task.ModelName)
+	if !exists {
+		return nil, nil, fmt.Errorf("model %s not in catalog", task.ModelName)
+	}
+	require_mem_MB := model_info.gpu_memory_MB
+
+	var err error
+	for i := 0; i < maxPlacementConflicts; i++ {
+		// 按调度策略在集群节点中选择节点和具体的GPU
+		var placements []*scheduler.Placement
+		placements, err = scheduler.ScheduleGang(sched, &scheduler.Request{
+			ModelName:    task.ModelName,
+			RequireMemMB: require_mem_MB,
+			MaxGPUs:      model_info.max_GPUs,
+			Image:        model_info.image,
+			Exclusive:    model_info.exclusive,
+		}, cm.AvailableNodes(), model_info.max_nodes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// 在下一次心跳之前，用预留记录占住这部分显存，避免后面的任务重复分配
+		reqs := make([]cluster.ReservationRequest, len(placements))
+		for rank, p := range placements {
+			log.Printf("策略 %s 选择节点 %s 的GPU %v 调度任务 %s (rank %d/%d)",
+				sched.Name(), p.Node.NodeID, p.GPUIDs, task.TaskID, rank, len(placements))
+			if p.Evict {
+				log.Printf("节点 %s 的空闲显存不够，启动任务 %s 时会卸载空闲的实例", p.Node.NodeID, task.TaskID)
+			}
+			gpu_mem_MB := make(map[string]uint64, len(p.GPUIDs))
+			for _, gpu_id := range p.GPUIDs {
+				gpu_mem_MB[gpu_id] = p.PerGPUMemMB
+			}
+			reqs[rank] = cluster.ReservationRequest{
+				NodeID:    p.Node.NodeID,
+				GPUMemMB:  gpu_mem_MB,
+				Evict:     p.Evict,
+				Exclusive: model_info.exclusive,
+			}
+		}
+		var reservation_ids []string
+		reservation_ids, err = cm.ReserveAll(reqs)
+		if err == nil {
+			return placements, reservation_ids, nil
+		}
+		if !errors.Is(err, cluster.ErrInsufficientMemory) && !errors.Is(err, cluster.ErrGPUExclusive) {
+			break
+		}
+		log.Printf("任务 %s 的显存被其他调度抢先预留，重新选择: %v", task.TaskID, err)
+	}
+	return nil, nil, fmt.Errorf("预留显存失败: %w", err)
+}
+
+// 调度一个任务，任何一步失败都返回错误，由调用方决定重试还是放进死信队列
+// 模型已经有就绪且未饱和的实例时直接复用，只有没有实例或者实例都饱和时才启动新容器
+func (q *TaskWaitQueue) sechedule(task *Task, cm *cluster.ClusterManager, sched scheduler.Scheduler) error {
+	// 排队期间被取消的任务直接跳过
+	if err := q.store.SetStatus(task.TaskID, StatusScheduling, ""); err != nil {
+		log.Printf("跳过任务 %s: %v", task.TaskID, err)
+		return nil
+	}
+	q.store.Update(task.TaskID, func(t *Task) {
+		t.Attempts++
+	})
+
+	if inst, ok := cm.AcquireInstance(task.ModelName); ok {
+		defer cm.ReleaseInstance(inst.InstanceID)
+		q.store.Update(task.TaskID, func(t *Task) {
+			t.NodeIP = inst.NodeIP
+			t.Port = inst.Port
+			t.GPUIDs = inst.GPUIDs
+			t.InstanceID = inst.InstanceID
+		})
+		q.store.SetStatus(task.TaskID, StatusRunning, "routed to running instance "+inst.InstanceID)
+
+		// 组调度的实例只需要把提示词发给rank 0
+		result, err := q.infer(task, inst.NodeIP, inst.InstanceID)
+		if err != nil {
+			q.checkLostInstance(cm, inst.NodeIP, inst.InstanceID, err)
+			return fmt.Errorf("rpc请求实例 %s 失败: %w", inst.InstanceID, err)
+		}
+		q.succeed(task, inst.Port, result)
+		return nil
+	}
+
+	placements, reservation_ids, err := place(task, cm, sched)
+	if err != nil {
+		return err
+	}
+	target_node := placements[0].Node
+
+	// 登记新实例，启动完成之前其他任务不会被路由过来
+	instance_id := newID("inst")
+	var members []cluster.GangMember
+	node_ids := []string{target_node.NodeID}
+	for rank := 1; rank < len(placements); rank++ {
+		p := placements[rank]
+		members = append(members, cluster.GangMember{
+			Rank:          rank,
+			NodeID:        p.Node.NodeID,
+			NodeIP:        p.Node.IP,
+			GPUIDs:        p.GPUIDs,
+			ReservationID: reservation_ids[rank],
+		})
+		node_ids = append(node_ids, p.Node.NodeID)
+	}
+	model_info, _ := lookupModel(task.ModelName)
+	err = cm.AddInstance(cluster.Instance{
+		InstanceID:    instance_id,
+		ModelName:     task.ModelName,
+		NodeID:        target_node.NodeID,
+		NodeIP:        target_node.IP,
+		GPUIDs:        placements[0].GPUIDs,
+		ReservationID: reservation_ids[0],
+		MaxConcurrent: model_info.maxConcurrency(),
+		Members:       members,
+		Exclusive:     model_info.exclusive,
+	})
+	if err != nil {
+		for _, id := range reservation_ids {
+			cm.ReleaseReservation(id)
+		}
+		return err
+	}
+	q.store.Update(task.TaskID, func(t *Task) {
+		t.NodeIP = target_node.IP
+		t.GPUIDs = placements[0].GPUIDs
+		t.ReservationID = reservation_ids[0]
+		t.InstanceID = instance_id
+	})
+	q.store.SetStatus(task.TaskID, StatusStarting,
+		fmt.Sprintf("starting instance %s on node %s", instance_id, strings.Join(node_ids, ",")))
+
+	info, err := q.startInstance(task, instance_id, placements)
+	if err != nil {
+		// 移除实例的同时释放它所有成员的显存预留
+		cm.RemoveInstance(instance_id)
+		return err
+	}
+
+	for _, id := range reservation_ids {
+		cm.CommitReservation(id)
+	}
+	cm.MarkInstanceReady(instance_id, info.Port)
+	defer cm.ReleaseInstance(instance_id)
+	q.store.Update(task.TaskID, func(t *Task) {
+		t.Port = info.Port
+	})
+	q.store.SetStatus(task.TaskID, StatusRunning, "instance listening on port "+info.Port)
+
+	// 实例已经就绪，推理失败时保留实例，重试的任务会被路由到它上面；
+	// 实例已经不可用时移除它，重试的任务会调度新的实例
+	result, err := q.infer(task, target_node.IP, instance_id)
+	if err != nil {
+		q.checkLostInstance(cm, target_node.IP, instance_id, err)
+		return fmt.Errorf("rpc请求实例 %s 失败: %w", instance_id, err)
+	}
+	q.succeed(task, info.Port, result)
+	return nil
+}
+
+// 推理失败可能是因为实例已经不可用（节点或者容器连不上、节点上已经没有这个实例），
+// 先停止往实例路由任务，再向节点确认实例的状态：节点上已经没有这个实例或者它没有就绪时，
+// 把实例从注册表中移除并停止它剩下的成员，重试的任务会调度新的实例；
+// 实例仍然就绪时恢复路由；节点连不上时保持不路由，由节点下线的处理移除实例。
+// 模型服务自己返回的错误说明实例还活着，不做处理
+func (q *TaskWaitQueue) checkLostInstance(cm *cluster.ClusterManager, node_ip, instance_id string, err error) {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.NotFound:
+	default:
+		return
+	}
+	cm.MarkInstanceUnreachable(instance_id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), workerRequestTimeout)
+	defer cancel()
+	info, get_err := q.workers.GetInstance(ctx, node_ip, instance_id)
+	switch {
+	case status.Code(get_err) == codes.NotFound:
+		log.Printf("实例 %s 已经不在节点 %s 上，不再复用: %v", instance_id, node_ip, err)
+		cm.DiscardInstance(instance_id, "instance lost")
+	case get_err != nil:
+		log.Printf("无法确认实例 %s 的状态，暂停路由: %v", instance_id, get_err)
+	case info.GetState() != pb.InstanceState_INSTANCE_STATE_READY:
+		log.Printf("实例 %s 没有就绪，不再复用: %v", instance_id, err)
+		cm.DiscardInstance(instance_id, "instance not ready")
+	default:
+		log.Printf("实例 %s 仍然就绪，继续复用: %v", instance_id, err)
+		cm.MarkInstanceReady(instance_id, info.GetPort())
+	}
+}
+
+// 组调度时在每个成员的节点上预留分布式组的端口，返回按rank排序的成员地址，
+// rank 0 的地址就是分布式组的主地址。同一节点上的多个实例各自使用不同的端口
+func (q *TaskWaitQueue) reserveRendezvous(ctx context.Context, instance_id string, placements []*scheduler.Placement) ([]string, error) {
+	peer_addrs := make([]string, len(placements))
+	errs := make([]error, len(placements))
+	var wg sync.WaitGroup
+	for rank, p := range placements {
+		wg.Add(1)
+		go func(rank int, node_ip string) {
+			defer wg.Done()
+			port, err := q.workers.ReserveRendezvousPort(ctx, node_ip, instance_id)
+			if err != nil {
+				errs[rank] = fmt.Errorf("rank %d 预留分布式组端口失败: %w", rank, err)
+				return
+			}
+			peer_addrs[rank] = net.JoinHostPort(node_ip, port)
+		}(rank, p.Node.IP)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		// 已经预留的端口由停止请求归还，没有送达的工作节点会在超时后自己归还
+		for rank, addr := range peer_addrs {
+			if addr != "" {
+				q.stopOnNode(placements[rank].Node.IP, instance_id, "gang rendezvous failed", true)
+			}
+		}
+		return nil, err
+	}
+	return peer_addrs, nil
+}
+
+// 在选中的节点上启动实例，返回rank 0的实例信息。
+// 组调度时所有成员同时启动，分布式组需要所有rank都到齐才能完成初始化，
+// 任何一个成员失败整个实例都算启动失败，已经启动的成员会被停止
+func (q *TaskWaitQueue) startInstance(task *Task, instance_id string, placements []*scheduler.Placement) (*pb.InstanceInfo, error) {
+	model_info, _ := lookupModel(task.ModelName)
+	world_size := len(placements)
+
+	ctx, cancel := context.WithTimeout(context.Background(), workerStartTimeout)
+	defer cancel()
+
+	var peer_addrs []string
+	if world_size > 1 {
+		var err error
+		if peer_addrs, err = q.reserveRendezvous(ctx, instance_id, placements); err != nil {
+			return nil, err
+		}
+	}
+
+	infos := make([]*pb.InstanceInfo, world_size)
+	errs := make([]error, world_size)
+	var wg sync.WaitGroup
+	for rank, p := range placements {
+		req := &pb.StartInstanceRequest{
+			InstanceId: instance_id,
+			ModelName:  task.ModelName,
+			TaskId:     task.TaskID,
+			Rank:       int32(rank),
+			WorldSize:  int32(world_size),
+			GpuIds:     p.GPUIDs,
+			Exclusive:  model_info.exclusive,
+		}
+		if world_size > 1 {
+			req.PeerAddrs = peer_addrs
+		}
+
+		wg.Add(1)
+		go func(rank int, node_ip string) {
+			defer wg.Done()
+			info, err := q.workers.StartInstance(ctx, node_ip, req)
+			if err != nil {
+				errs[rank] = fmt.Errorf("rank %d rpc请求创建容器失败: %w", rank, err)
+				return
+			}
+			infos[rank] = info
+		}(rank, p.Node.IP)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		// 停止已经启动的成员。启动失败的成员由工作节点归还预留的端口
+		for rank, info := range infos {
+			if info != nil {
+				q.stopOnNode(placements[rank].Node.IP, instance_id, "gang member failed to start", true)
+			}
+		}
+		return nil, err
+	}
+	return infos[0], nil
+}
+
+// 停止节点上的实例，失败时只记录日志，节点之后会按空闲超时回收它。
+// force为false时工作节点不会停止还在处理请求的实例
+func (q *TaskWaitQueue) stopOnNode(node_ip, instance_id, reason string, force bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), workerRequestTimeout)
+	defer cancel()
+	err := q.workers.StopInstance(ctx, node_ip, &pb.StopInstanceRequest{
+		InstanceId: instance_id,
+		Reason:     reason,
+		Force:      force,
+	})
+	if err != nil {
+		log.Printf("停止节点 %s 上的实例 %s 失败: %v", node_ip, instance_id, err)
+	}
+	return err
+}
+
+// 记录任务的推理结果
+func (q *TaskWaitQueue) succeed(task *Task, port, result string) {
+	fmt.Printf("访问端口是: %s \n", port)
+	fmt.Printf("响应内容: %s", result)
+
+	q.store.Update(task.TaskID, func(t *Task) {
+		t.Result = result
+	})
+	q.store.SetStatus(task.TaskID, StatusSucceeded, "")
+}
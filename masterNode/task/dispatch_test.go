@@ -0,0 +1,633 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+	"catalog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 假的工作节点客户端，记录收到的请求，可以让指定节点启动失败
+type fakeWorkers struct {
+	mu      sync.Mutex
+	starts  map[string]*pb.StartInstanceRequest // 节点IP -> 最近一次启动请求
+	prompts map[string]string                   // 节点IP -> 最近一次收到的提示词
+	stopped []string                            // 被停止的实例，格式是 节点IP/实例ID
+	forced  []bool                              // 每次停止请求是否强制停止
+	failIP  string
+	// 不为空时推理请求返回这个错误
+	inferErr error
+	// 不为空时查询实例返回这个错误
+	getErr error
+	// 流式推理发出第一段之后一直等到请求被取消
+	holdStream bool
+	// 不为空时在返回启动结果之前调用，模拟工作节点启动实例时的行为
+	onStart func(node_ip string, req *pb.StartInstanceRequest)
+}
+
+func (f *fakeWorkers) StartInstance(ctx context.Context, node_ip string, req *pb.StartInstanceRequest) (*pb.InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.starts == nil {
+		f.starts = make(map[string]*pb.StartInstanceRequest)
+	}
+	f.starts[node_ip] = req
+	if f.onStart != nil {
+		f.onStart(node_ip, req)
+	}
+	if node_ip == f.failIP {
+		return nil, errors.New("container runtime failed")
+	}
+	return &pb.InstanceInfo{
+		InstanceId: req.InstanceId,
+		ModelName:  req.ModelName,
+		State:      pb.InstanceState_INSTANCE_STATE_READY,
+		Port:       "31122",
+		Rank:       req.Rank,
+	}, nil
+}
+
+func (f *fakeWorkers) StopInstance(ctx context.Context, node_ip string, req *pb.StopInstanceRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = append(f.stopped, node_ip+"/"+req.InstanceId)
+	f.forced = append(f.forced, req.Force)
+	return nil
+}
+
+func (f *fakeWorkers) GetInstance(ctx context.Context, node_ip string, instance_id string) (*pb.InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	if r, exists := f.starts[node_ip]; exists && r.InstanceId == instance_id {
+		return &pb.InstanceInfo{InstanceId: r.InstanceId, ModelName: r.ModelName, State: pb.InstanceState_INSTANCE_STATE_READY, Port: "31122"}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "instance %s not found", instance_id)
+}
+
+func (f *fakeWorkers) ListInstances(ctx context.Context, node_ip string, req *pb.ListInstancesRequest) ([]*pb.InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r, exists := f.starts[node_ip]; exists {
+		return []*pb.InstanceInfo{{InstanceId: r.InstanceId, ModelName: r.ModelName, Rank: r.Rank}}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeWorkers) recordPrompt(node_ip, prompt string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.prompts == nil {
+		f.prompts = make(map[string]string)
+	}
+	f.prompts[node_ip] = prompt
+}
+
+func (f *fakeWorkers) Infer(ctx context.Context, node_ip string, req *pb.InferRequest) (string, error) {
+	f.recordPrompt(node_ip, req.Prompt)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.inferErr != nil {
+		return "", f.inferErr
+	}
+	return "rank done", nil
+}
+
+func (f *fakeWorkers) InferStream(ctx context.Context, node_ip string, req *pb.InferRequest, chunk func(*pb.GenerateChunk) error) error {
+	f.recordPrompt(node_ip, req.Prompt)
+	for _, c := range []*pb.GenerateChunk{{Port: "31122"}, {Text: "hel"}, {Text: "lo"}} {
+		if err := chunk(c); err != nil {
+			return err
+		}
+		if f.holdStream && c.Text != "" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// 每个节点预留的分布式组端口都是31500
+func (f *fakeWorkers) ReserveRendezvousPort(ctx context.Context, node_ip string, instance_id string) (string, error) {
+	return "31500", nil
+}
+
+func (f *fakeWorkers) StreamLogs(ctx context.Context, node_ip string, req *pb.LogsRequest, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "logs of %s on %s\n", req.InstanceId, node_ip)
+	return err
+}
+
+func (f *fakeWorkers) PullImage(ctx context.Context, node_ip string, req *pb.PullImageRequest, progress func(*pb.PullProgress)) error {
+	progress(&pb.PullProgress{Image: req.Image, Layer: "layer-1", Status: "Downloading", Current: 1, Total: 2})
+	progress(&pb.PullProgress{Image: req.Image, Status: "done", Done: true})
+	return nil
+}
+
+// 两个节点，每个节点两张40GB的GPU，都放不下140GB的模型
+func gangCluster() *cluster.ClusterManager {
+	cm := cluster.NewClusterManager(time.Second, time.Minute)
+	for _, n := range []struct{ id, ip string }{{"node-1", "10.0.0.1"}, {"node-2", "10.0.0.2"}} {
+		cm.RegisterNode(n.id, n.ip, "7070")
+		cm.UpdateHeartbeat(n.id, map[string]cluster.GPU{
+			"0": {TotalMemoryMB: 40960, FreeMemoryMB: 40960},
+			"1": {TotalMemoryMB: 40960, FreeMemoryMB: 40960},
+		}, time.Now())
+	}
+	return cm
+}
+
+func withGangModel(t *testing.T) {
+	c := &catalog.Catalog{Models: map[string]catalog.Model{}}
+	for name, m := range catalog.Default().Models {
+		c.Models[name] = m
+	}
+	c.Models["test-140b"] = catalog.Model{Image: "test:v1", GPUMemoryMB: 140 * 1024, MaxGPUs: 2, MaxNodes: 2}
+	SetModels(c)
+	t.Cleanup(func() { SetModels(catalog.Default()) })
+}
+
+func TestGangScheduling(t *testing.T) {
+	withGangModel(t)
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	workers := &fakeWorkers{}
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(workers)
+
+	tk := &Task{ModelName: "test-140b", OriginPrompt: "hello"}
+	q.store.Add(tk)
+	if err := q.sechedule(tk, cm, sched); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个节点都收到了启动请求，rank、组大小和成员地址都正确
+	wantPeers := []string{"10.0.0.1:31500", "10.0.0.2:31500"}
+	for rank, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		req := workers.starts[ip]
+		if req == nil {
+			t.Fatalf("节点 %s 没有收到请求", ip)
+		}
+		if int(req.Rank) != rank || req.WorldSize != 2 {
+			t.Errorf("节点 %s: rank=%d world_size=%d", ip, req.Rank, req.WorldSize)
+		}
+		if len(req.PeerAddrs) != 2 || req.PeerAddrs[0] != wantPeers[0] || req.PeerAddrs[1] != wantPeers[1] {
+			t.Errorf("节点 %s: peer_addrs=%v", ip, req.PeerAddrs)
+		}
+		if len(req.GpuIds) == 0 {
+			t.Errorf("节点 %s 没有收到要使用的GPU", ip)
+		}
+		if _, prompted := workers.prompts[ip]; (rank == 0) != prompted {
+			t.Errorf("只有rank 0应该收到提示词，rank %d 收到 %q", rank, workers.prompts[ip])
+		}
+	}
+
+	// 两个节点上各有一份已提交的预留，实例登记了另一个成员
+	reservations := cm.GetReservations()
+	if len(reservations) != 2 {
+		t.Fatalf("预留数 %d，期望 2", len(reservations))
+	}
+	for _, r := range reservations {
+		if r.State != cluster.ReservationCommitted {
+			t.Errorf("预留 %s 的状态是 %s", r.ID, r.State)
+		}
+	}
+	instances := cm.GetInstances()
+	if len(instances) != 1 || len(instances[0].Members) != 1 || instances[0].State != cluster.InstanceReady {
+		t.Fatalf("实例登记不正确: %+v", instances)
+	}
+
+	got, _ := q.store.Get(tk.TaskID)
+	if got.Status != StatusSucceeded {
+		t.Errorf("任务状态 %s，期望 %s", got.Status, StatusSucceeded)
+	}
+}
+
+func TestGangSchedulingAllOrNothing(t *testing.T) {
+	withGangModel(t)
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	q := NewTaskWaitQueue(8)
+	workers := &fakeWorkers{failIP: "10.0.0.2"}
+	q.SetWorkerClient(workers)
+
+	tk := &Task{ModelName: "test-140b"}
+	q.store.Add(tk)
+	if err := q.sechedule(tk, cm, sched); err == nil {
+		t.Fatal("有一个成员启动失败，整个组应该失败")
+	}
+
+	// 失败后所有成员的预留都被释放，实例也被移除
+	if n := len(cm.GetReservations()); n != 0 {
+		t.Errorf("还剩 %d 个预留没有释放", n)
+	}
+	if n := len(cm.GetInstances()); n != 0 {
+		t.Errorf("还剩 %d 个实例没有移除", n)
+	}
+	// 已经启动的rank 0被停止
+	if len(workers.stopped) != 1 || !strings.HasPrefix(workers.stopped[0], "10.0.0.1/") {
+		t.Errorf("停止的实例 %v", workers.stopped)
+	}
+}
+
+func TestInstanceLogsProxy(t *testing.T) {
+	withGangModel(t)
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(&fakeWorkers{})
+	q.SetAdminToken("secret")
+	q.cluster = cm
+
+	tk := &Task{ModelName: "test-140b", OriginPrompt: "hello"}
+	q.store.Add(tk)
+	if err := q.sechedule(tk, cm, sched); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := q.store.Get(tk.TaskID)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /instances/{id}/logs", q.handleInstanceLogs)
+	getAs := func(path, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set(adminHeader, token)
+		}
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		return getAs(path, "secret")
+	}
+
+	// 日志里有其他租户的提示词，没有管理令牌不能查看
+	for _, token := range []string{"", "wrong"} {
+		if rec := getAs("/instances/"+got.InstanceID+"/logs", token); rec.Code != http.StatusForbidden {
+			t.Fatalf("管理令牌为 %q 时返回 %d", token, rec.Code)
+		}
+	}
+
+	// rank 1 的日志从第二个节点读取
+	rec := get("/instances/" + got.InstanceID + "/logs?rank=1")
+	if want := "logs of " + got.InstanceID + " on 10.0.0.2\n"; rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("得到 %d %q，期望 %q", rec.Code, rec.Body.String(), want)
+	}
+
+	// 实例移除后根据任务记录找到rank 0所在的节点
+	cm.RemoveInstance(got.InstanceID)
+	rec = get("/instances/" + got.InstanceID + "/logs")
+	if want := "logs of " + got.InstanceID + " on 10.0.0.1\n"; rec.Body.String() != want {
+		t.Fatalf("得到 %q，期望 %q", rec.Body.String(), want)
+	}
+
+	if rec := get("/instances/inst-unknown/logs"); rec.Code != http.StatusNotFound {
+		t.Fatalf("不存在的实例返回 %d", rec.Code)
+	}
+}
+
+func TestInferenceStreamsGeneratedChunks(t *testing.T) {
+	withGangModel(t)
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	workers := &fakeWorkers{}
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(workers)
+	go q.HandleQueue(cm, sched, 1)
+	defer q.Close()
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"model_name": "test-140b", "origin_prompt": "hello", "stream": true}`)
+	q.addToWaitQueue(rec, httptest.NewRequest("POST", "/inference", body))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{"event: task\n", `data: {"text":"hel"}`, `data: {"text":"lo"}`, "event: done\n", `"status":"succeeded"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("响应里没有 %q:\n%s", want, out)
+		}
+	}
+
+	// 只有rank 0通过流式接口处理提示词，完整结果也记录在任务里
+	tasks := q.store.List()
+	if len(tasks) != 1 || tasks[0].Result != "hello" {
+		t.Fatalf("任务 %+v", tasks)
+	}
+	if r := workers.starts["10.0.0.2"]; r.Rank != 1 {
+		t.Errorf("rank 1 收到 %v", r)
+	}
+	if _, prompted := workers.prompts["10.0.0.2"]; prompted {
+		t.Error("rank 1 不应该收到提示词")
+	}
+}
+
+func TestStreamCancelledWhenClientGone(t *testing.T) {
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(&fakeWorkers{holdStream: true})
+	tk := &Task{ModelName: "test-140b", OriginPrompt: "hello", stream: newTaskStream()}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := q.relayGeneration(context.Background(), tk, "10.0.0.1", &pb.InferRequest{Prompt: tk.OriginPrompt})
+		errc <- err
+	}()
+	<-tk.stream.chunks
+	tk.stream.close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errClientGone) {
+			t.Fatalf("客户端断开后返回 %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("客户端断开后生成没有被取消")
+	}
+}
+
+func TestAdminStopInstance(t *testing.T) {
+	withGangModel(t)
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	workers := &fakeWorkers{}
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(workers)
+	q.SetAdminToken("secret")
+	q.cluster = cm
+
+	tk := &Task{ModelName: "test-140b", OriginPrompt: "hello"}
+	q.store.Add(tk)
+	if err := q.sechedule(tk, cm, sched); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := q.store.Get(tk.TaskID)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /admin/instances/{id}", q.handleStopInstance)
+	stop := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/admin/instances/"+got.InstanceID, nil)
+		req.Header.Set(adminHeader, "secret")
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 还在处理任务的实例默认不停止，也不从注册表中移除
+	inst, ok := cm.AcquireInstance("test-140b")
+	if !ok {
+		t.Fatal("没有可以复用的实例")
+	}
+	if rec := stop(); rec.Code != http.StatusConflict {
+		t.Fatalf("停止处理中的实例返回 %d %s，期望 409", rec.Code, rec.Body.String())
+	}
+	if _, exists := cm.GetInstance(inst.InstanceID); !exists || len(workers.stopped) != 0 {
+		t.Fatalf("处理中的实例被停止了: %v", workers.stopped)
+	}
+	cm.ReleaseInstance(inst.InstanceID)
+
+	if rec := stop(); rec.Code != http.StatusOK {
+		t.Fatalf("停止实例返回 %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 两个成员都被停止，没有要求强制停止时工作节点也不强制停止，实例和显存预留都被移除
+	if len(workers.stopped) != 2 {
+		t.Errorf("停止的实例 %v", workers.stopped)
+	}
+	for _, force := range workers.forced {
+		if force {
+			t.Errorf("没有要求强制停止，停止请求却是强制的")
+		}
+	}
+	if n := len(cm.GetInstances()); n != 0 {
+		t.Errorf("还剩 %d 个实例", n)
+	}
+	if n := len(cm.GetReservations()); n != 0 {
+		t.Errorf("还剩 %d 个预留", n)
+	}
+}
+
+// 已经就绪的实例被复用，节点确认实例已经不在时才移除，重试的任务启动新的实例
+func TestReuseAndDiscardLostInstance(t *testing.T) {
+	cm := gangCluster()
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	workers := &fakeWorkers{}
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(workers)
+
+	run := func() (Task, error) {
+		tk := &Task{ModelName: "llama3-8b", OriginPrompt: "hello"}
+		q.store.Add(tk)
+		err := q.sechedule(tk, cm, sched)
+		got, _ := q.store.Get(tk.TaskID)
+		return got, err
+	}
+
+	first, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.InstanceID != first.InstanceID || len(workers.starts) != 1 {
+		t.Fatalf("第二个任务应该复用实例 %s，得到 %s", first.InstanceID, second.InstanceID)
+	}
+
+	// 模型服务返回的错误说明实例还活着，实例不被停止，之后的任务继续复用它
+	for _, code := range []codes.Code{codes.Internal, codes.InvalidArgument, codes.DeadlineExceeded} {
+		workers.mu.Lock()
+		workers.inferErr = status.Error(code, "model error")
+		workers.mu.Unlock()
+		if _, err := run(); err == nil {
+			t.Fatalf("%v: 推理失败时任务应该失败", code)
+		}
+		if inst, exists := cm.GetInstance(first.InstanceID); !exists || inst.State != cluster.InstanceReady {
+			t.Fatalf("%v: 实例不应该被移除或者停止路由", code)
+		}
+	}
+
+	// 连接暂时失败，但节点确认实例仍然就绪，实例继续被复用
+	workers.mu.Lock()
+	workers.inferErr = status.Error(codes.Unavailable, "connection reset")
+	workers.mu.Unlock()
+	run()
+	workers.mu.Lock()
+	workers.inferErr = nil
+	workers.mu.Unlock()
+	if again, err := run(); err != nil || again.InstanceID != first.InstanceID {
+		t.Fatalf("实例仍然就绪时应该继续复用，得到 %s, %v", again.InstanceID, err)
+	}
+
+	// 节点也连不上，实例不再被路由，但是在确认之前不移除也不释放显存
+	workers.mu.Lock()
+	workers.inferErr = status.Error(codes.Unavailable, "connection refused")
+	workers.getErr = status.Error(codes.Unavailable, "connection refused")
+	workers.mu.Unlock()
+	run()
+	if inst, exists := cm.GetInstance(first.InstanceID); !exists || inst.State != cluster.InstanceUnreachable {
+		t.Fatalf("无法确认状态的实例应该停止路由，得到 %+v", inst)
+	}
+	if n := len(cm.GetReservations()); n != 1 {
+		t.Fatalf("无法确认状态的实例应该保留显存预留，还剩 %d 个预留", n)
+	}
+	cm.MarkInstanceReady(first.InstanceID, "31122")
+
+	// 容器连不上，节点上也已经没有这个实例，实例被移除，它的显存预留也被释放
+	workers.mu.Lock()
+	workers.getErr = nil
+	workers.starts = nil
+	workers.mu.Unlock()
+	if _, err := run(); err == nil {
+		t.Fatal("实例连不上时任务应该失败")
+	}
+	if _, exists := cm.GetInstance(first.InstanceID); exists {
+		t.Fatal("连不上的实例应该被移除")
+	}
+	if n := len(cm.GetReservations()); n != 0 {
+		t.Fatalf("还剩 %d 个预留", n)
+	}
+
+	// 重试的任务调度新的实例
+	workers.mu.Lock()
+	workers.inferErr = nil
+	workers.mu.Unlock()
+	retried, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.InstanceID == first.InstanceID {
+		t.Fatal("重试的任务不应该再被路由到连不上的实例")
+	}
+
+}
+
+// 节点的显存被空闲实例占满时，新模型仍然调度到这个节点上，启动时由工作节点卸载最久未使用的实例
+func TestStartEvictsIdleInstanceOnFullNode(t *testing.T) {
+	c := &catalog.Catalog{Models: map[string]catalog.Model{
+		"model-a": {Image: "a:v1", GPUMemoryMB: 30 * 1024},
+		"model-b": {Image: "b:v1", GPUMemoryMB: 30 * 1024},
+	}}
+	SetModels(c)
+	t.Cleanup(func() { SetModels(catalog.Default()) })
+
+	cm := cluster.NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "10.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]cluster.GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 40960}}, time.Now())
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	workers := &fakeWorkers{}
+	q := NewTaskWaitQueue(8)
+	q.SetWorkerClient(workers)
+
+	run := func(model string) Task {
+		tk := &Task{ModelName: model, OriginPrompt: "hello"}
+		q.store.Add(tk)
+		if err := q.sechedule(tk, cm, sched); err != nil {
+			t.Fatalf("%s: %v", model, err)
+		}
+		got, _ := q.store.Get(tk.TaskID)
+		return got
+	}
+
+	first := run("model-a")
+	// 心跳上报实例a已经占用了显存
+	cm.UpdateHeartbeat("node-1", map[string]cluster.GPU{"0": {TotalMemoryMB: 40960, FreeMemoryMB: 10 * 1024}}, time.Now().Add(time.Second))
+
+	// 工作节点为实例b腾出显存，卸载空闲的实例a，并通过控制流通知master
+	workers.onStart = func(node_ip string, req *pb.StartInstanceRequest) {
+		if req.ModelName == "model-b" {
+			cm.EvictInstance("node-1", first.InstanceID)
+		}
+	}
+	second := run("model-b")
+
+	if second.NodeIP != "10.0.0.1" || len(second.GPUIDs) != 1 || second.GPUIDs[0] != "0" {
+		t.Fatalf("模型b应该调度到节点1的GPU 0上，得到 %s %v", second.NodeIP, second.GPUIDs)
+	}
+	if _, exists := cm.GetInstance(first.InstanceID); exists {
+		t.Fatal("空闲的实例a应该被卸载")
+	}
+	if _, exists := cm.GetInstance(second.InstanceID); !exists {
+		t.Fatal("实例b应该已经登记")
+	}
+	if rs := cm.GetReservations(); len(rs) != 1 || rs[0].ID != second.ReservationID {
+		t.Fatalf("应该只剩实例b的预留，得到 %+v", rs)
+	}
+}
+
+func TestCreateJoinTokenRequiresAdminToken(t *testing.T) {
+	ca, err := pki.LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := cluster.NewClusterManager(time.Second, time.Minute)
+	cm.EnableTLS(ca, nil)
+	q := NewTaskWaitQueue(8)
+	q.cluster = cm
+
+	create := func(token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/admin/join-tokens", nil)
+		if token != "" {
+			r.Header.Set(adminHeader, token)
+		}
+		q.handleCreateJoinToken(rec, r)
+		return rec
+	}
+
+	// 没有设置管理令牌时管理接口全部关闭
+	if rec := create(""); rec.Code != http.StatusForbidden {
+		t.Fatalf("没有管理令牌时返回 %d，期望 403", rec.Code)
+	}
+	q.SetAdminToken("secret")
+	if rec := create("wrong"); rec.Code != http.StatusForbidden {
+		t.Fatalf("管理令牌错误时返回 %d，期望 403", rec.Code)
+	}
+	if rec := create("secret"); rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), ca.Hash()) {
+		t.Fatalf("生成加入令牌返回 %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// 启用TLS时只连接登记过的节点，并且要求对端的证书属于登记在这个IP上的节点
+func TestWorkerClientRequiresRegisteredNode(t *testing.T) {
+	ca, err := pki.LoadOrCreateAuthority(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, _ := ca.Issue(pki.MasterName, nil, time.Hour)
+	creds, err := pki.NewCredentials(certPEM, keyPEM, ca.CertPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewTaskWaitQueue(8)
+	q.cluster = gangCluster()
+	q.SetWorkerCredentials(creds)
+
+	wc := q.workers.(grpcWorkerClient)
+	if _, err := wc.transportCredentials("10.0.0.3"); err == nil {
+		t.Fatal("没有节点登记在该IP上时不应该连接")
+	}
+	if ids := q.nodeIDsAt("10.0.0.2"); len(ids) != 1 || ids[0] != "node-2" {
+		t.Fatalf("10.0.0.2 上的节点 %v，期望 node-2", ids)
+	}
+	if _, err := wc.transportCredentials("10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	pb "api/schedule"
+)
+
+// 预拉取镜像的超时时间，大模型的镜像有几十GB
+const pullImageTimeout = 30 * time.Minute
+
+// POST /admin/nodes/{id}/pull?model=llama3-8b 让节点预先拉取模型镜像，
+// 也可以用image参数直接指定镜像。拉取进度按行返回JSON，
+// 加上async=true时立即返回命令ID
+func (q *TaskWaitQueue) handlePullImage(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	req := &pb.PullImageRequest{
+		ModelName: query.Get("model"),
+		Image:     query.Get("image"),
+	}
+	if req.Image == "" {
+		info, exists := lookupModel(req.ModelName)
+		if !exists {
+			http.Error(w, "Unknown model", http.StatusBadRequest)
+			return
+		}
+		req.Image = info.image
+	}
+
+	// async=true时通过控制流下发拉取命令，不等待拉取完成
+	if query.Get("async") == "true" {
+		q.pullImageAsync(w, r.PathValue("id"), req)
+		return
+	}
+
+	node_ip, found := q.nodeIP(r.PathValue("id"))
+	if !found {
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), pullImageTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	out := &flushWriter{w: w}
+	enc := json.NewEncoder(out)
+	err := q.workers.PullImage(ctx, node_ip, req, func(p *pb.PullProgress) {
+		enc.Encode(map[string]any{
+			"image":   p.Image,
+			"layer":   p.Layer,
+			"status":  p.Status,
+			"current": p.Current,
+			"total":   p.Total,
+			"done":    p.Done,
+		})
+	})
+	if err != nil {
+		// 已经开始输出进度之后就不能再修改状态码了
+		if !out.written {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		enc.Encode(map[string]any{"image": req.Image, "error": err.Error()})
+	}
+}
+
+// 通过控制流让节点在后台拉取镜像，拉取结果由节点异步上报
+func (q *TaskWaitQueue) pullImageAsync(w http.ResponseWriter, nodeID string, req *pb.PullImageRequest) {
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil {
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+	command_id, err := cm.SendCommand(nodeID, &pb.NodeCommand{
+		Command: &pb.NodeCommand_PullImage{PullImage: req},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), commandErrorCode(err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"node_id": nodeID, "image": req.Image, "command_id": command_id})
+}
+
+// 查找节点的IP
+func (q *TaskWaitQueue) nodeIP(nodeID string) (string, bool) {
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil {
+		return "", false
+	}
+	node, exists := cm.GetNodes()[nodeID]
+	if !exists {
+		return "", false
+	}
+	return node.IP, true
+}
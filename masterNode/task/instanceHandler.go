@@ -0,0 +1,80 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"lightScheduler/cluster"
+	"net/http"
+
+	pb "api/schedule"
+)
+
+// DELETE /admin/instances/{id}?force=true 停止实例，先从实例注册表中移除，
+// 不再有新任务路由过来，再停止它在各个节点上的成员。
+// 默认不停止还在处理任务的实例
+func (q *TaskWaitQueue) handleStopInstance(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil {
+		http.Error(w, "Instance not found", http.StatusNotFound)
+		return
+	}
+
+	id := r.PathValue("id")
+	force := r.URL.Query().Get("force") == "true"
+	inst, exists, err := cm.TakeInstance(id, force)
+	if !exists {
+		http.Error(w, "Instance not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, cluster.ErrInstanceBusy) {
+		http.Error(w, "Instance is serving tasks", http.StatusConflict)
+		return
+	}
+
+	node_ips := []string{inst.NodeIP}
+	for _, m := range inst.Members {
+		node_ips = append(node_ips, m.NodeIP)
+	}
+	var errs []error
+	for _, node_ip := range node_ips {
+		if err := q.stopOnNode(node_ip, id, "stopped by admin", force); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"instance_id": id, "status": "stopped"})
+}
+
+// GET /admin/nodes/{id}/instances 查询节点上实际运行的实例
+func (q *TaskWaitQueue) handleNodeInstances(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	node_ip, found := q.nodeIP(r.PathValue("id"))
+	if !found {
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workerRequestTimeout)
+	defer cancel()
+	instances, err := q.workers.ListInstances(ctx, node_ip, &pb.ListInstancesRequest{
+		ModelName: r.URL.Query().Get("model"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if instances == nil {
+		instances = []*pb.InstanceInfo{}
+	}
+	writeJSON(w, http.StatusOK, instances)
+}
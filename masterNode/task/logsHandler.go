@@ -0,0 +1,102 @@
+package task
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	pb "api/schedule"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GET /instances/{id}/logs?follow=true&tail=100&rank=0 转发工作节点上实例的日志。
+// 实例已经被移除时，根据任务记录找到它所在的节点，工作节点会返回保存的最后日志。
+// 实例被多个租户共享，日志里有各个租户的提示词，只有管理员可以查看
+func (q *TaskWaitQueue) handleInstanceLogs(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	id := r.PathValue("id")
+	query := r.URL.Query()
+	follow := query.Get("follow") == "true"
+	tail, _ := strconv.Atoi(query.Get("tail"))
+	rank, _ := strconv.Atoi(query.Get("rank"))
+
+	node_ip, found := q.instanceNode(id, rank)
+	if !found {
+		http.Error(w, "Instance not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	if !follow {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, workerRequestTimeout)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := &flushWriter{w: w}
+	err := q.workers.StreamLogs(ctx, node_ip, &pb.LogsRequest{
+		InstanceId: id,
+		Follow:     follow,
+		Tail:       int32(tail),
+	}, out)
+	// 已经开始输出日志之后就不能再修改状态码了
+	if err != nil && !out.written {
+		code := http.StatusBadGateway
+		if status.Code(err) == codes.NotFound {
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+	}
+}
+
+// 查找实例某个rank所在节点的IP，先查实例注册表，再查任务记录
+func (q *TaskWaitQueue) instanceNode(id string, rank int) (string, bool) {
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+
+	if cm != nil {
+		if inst, exists := cm.GetInstance(id); exists {
+			if rank == 0 {
+				return inst.NodeIP, true
+			}
+			for _, m := range inst.Members {
+				if m.Rank == rank {
+					return m.NodeIP, true
+				}
+			}
+			return "", false
+		}
+	}
+
+	// 任务记录里只有rank 0所在的节点
+	if rank != 0 {
+		return "", false
+	}
+	for _, t := range q.store.List() {
+		if t.InstanceID == id && t.NodeIP != "" {
+			return t.NodeIP, true
+		}
+	}
+	return "", false
+}
+
+// 每次写入后立即发送给客户端，follow模式下客户端能实时看到日志
+type flushWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.written = true
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
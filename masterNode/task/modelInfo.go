@@ -1,18 +1,72 @@
 package task
 
-// 字典，用于查询模型中的信息
-var ModelsInfo = map[string]ModelInfo{
-	"lamma3-8b": {
-		size_GB: 16,
-	},
-
-	"gpt": {
-		size_GB: 0,
-	},
-}
+import (
+	"sync"
+
+	"catalog"
+)
+
+// 字典，用于查询模型中的信息，来自master和工作节点共用的模型目录，
+// SetModels 会在目录文件变化时整个替换它
+var (
+	modelsMu sync.RWMutex
+	models   = modelsFromCatalog(catalog.Default())
+)
 
 type ModelInfo struct {
-	size_GB uint64
+	// 实例需要的显存（MB），和模型目录中的单位一致
+	gpu_memory_MB uint64
+	// 模型最多可以切分到几张GPU上，0或1表示只能放在单张GPU上
+	max_GPUs int
+	// 单个节点放不下时，模型最多可以切分到几个节点上，0或1表示只能放在单个节点上
+	max_nodes int
+	// 一个实例同时处理的任务数上限，0表示使用默认值
+	max_concurrency int
+	// 实例独占分配给它的GPU，工作节点不会再把这些GPU分给其他实例
+	exclusive bool
+	// 模型的容器镜像，调度时优先选择已经缓存了镜像的节点
+	image string
+}
+
+// 实例默认同时处理的任务数上限
+const defaultMaxConcurrency = 4
+
+// 一个实例同时处理的任务数上限
+func (m ModelInfo) maxConcurrency() int {
+	if m.max_concurrency > 0 {
+		return m.max_concurrency
+	}
+	return defaultMaxConcurrency
 }
 
-// TODO，增加一些增删改查的接口，用于操作 ModelInfo
+// 把模型目录转换成调度需要的信息
+func modelsFromCatalog(c *catalog.Catalog) map[string]ModelInfo {
+	infos := make(map[string]ModelInfo, len(c.Models))
+	for name, m := range c.Models {
+		infos[name] = ModelInfo{
+			gpu_memory_MB:   m.GPUMemoryMB,
+			max_GPUs:        m.MaxGPUs,
+			max_nodes:       m.MaxNodes,
+			max_concurrency: m.MaxConcurrency,
+			exclusive:       m.Exclusive,
+			image:           m.Image,
+		}
+	}
+	return infos
+}
+
+// SetModels 替换模型目录，已经在运行的实例和排队中的任务不受影响
+func SetModels(c *catalog.Catalog) {
+	next := modelsFromCatalog(c)
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models = next
+}
+
+// 查询模型信息
+func lookupModel(model_name string) (ModelInfo, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	info, exists := models[model_name]
+	return info, exists
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"errors"
+	"lightScheduler/cluster"
+	"net/http"
+	"time"
+)
+
+// 加入令牌默认的有效期
+const defaultJoinTokenTTL = time.Hour
+
+// POST /admin/nodes/{id}/drain 排空节点，不再往节点上调度任务，
+// 节点上的实例处理完手上的任务后停止
+func (q *TaskWaitQueue) handleDrainNode(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil {
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+
+	id := r.PathValue("id")
+	command_id, err := cm.DrainNode(id)
+	if err != nil {
+		http.Error(w, err.Error(), commandErrorCode(err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"node_id": id, "status": "draining", "command_id": command_id})
+}
+
+// 下发命令失败时的状态码：节点没有连接时是503，其他情况是404
+func commandErrorCode(err error) int {
+	if errors.Is(err, cluster.ErrNodeNotConnected) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusNotFound
+}
+
+// POST /admin/join-tokens?ttl=1h 生成一次性的加入令牌，工作节点用它和CA指纹申请证书
+func (q *TaskWaitQueue) handleCreateJoinToken(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil || cm.CAHash() == "" {
+		http.Error(w, "Master runs without TLS", http.StatusConflict)
+		return
+	}
+
+	ttl := defaultJoinTokenTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	token, expires, err := cm.CreateJoinToken(ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token":      token,
+		"ca_hash":    cm.CAHash(),
+		"expires_at": expires,
+	})
+}
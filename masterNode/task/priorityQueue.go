@@ -0,0 +1,98 @@
+package task
+
+import (
+	"container/heap"
+	"time"
+)
+
+// 默认的老化间隔：任务每多等待这么久，有效优先级提高1级
+const DefaultAgingInterval = 10 * time.Second
+
+// 任务优先级的取值范围，超出范围的优先级乘以老化间隔后会溢出
+const (
+	MinPriority = -1000
+	MaxPriority = 1000
+)
+
+// 把优先级限制在取值范围内
+func clampPriority(priority int) int {
+	if priority < MinPriority {
+		return MinPriority
+	}
+	if priority > MaxPriority {
+		return MaxPriority
+	}
+	return priority
+}
+
+// 队列中的一个任务
+type queuedTask struct {
+	task       *Task
+	priority   int       // 入队时的优先级
+	enqueuedAt time.Time // 入队时间，用于计算老化
+	seq        uint64    // 入队序号，优先级相同时先进先出
+}
+
+// priorityQueue 带老化的优先级队列，总是先取出有效优先级最高的任务
+// 有效优先级 = 入队优先级 + 等待时间 / 老化间隔。
+// 所有任务老化的速度相同，所以两个任务有效优先级的先后关系不随时间变化，
+// 比较时只需要比较 priority*agingInterval - 入队时间，可以直接用堆维护
+type priorityQueue struct {
+	items         []*queuedTask
+	agingInterval time.Duration // 小于等于0表示不老化
+	epoch         time.Time     // 计算入队时间偏移的基准，避免溢出
+	seq           uint64
+}
+
+func newPriorityQueue(agingInterval time.Duration) *priorityQueue {
+	return &priorityQueue{
+		agingInterval: agingInterval,
+		epoch:         time.Now(),
+	}
+}
+
+// 老化后排序用的键，越大越先出队
+func (pq *priorityQueue) key(it *queuedTask) int64 {
+	if pq.agingInterval <= 0 {
+		return int64(it.priority)
+	}
+	return int64(it.priority)*int64(pq.agingInterval) - int64(it.enqueuedAt.Sub(pq.epoch))
+}
+
+// 实现 heap.Interface
+func (pq *priorityQueue) Len() int { return len(pq.items) }
+func (pq *priorityQueue) Less(i, j int) bool {
+	ki, kj := pq.key(pq.items[i]), pq.key(pq.items[j])
+	if ki != kj {
+		return ki > kj
+	}
+	return pq.items[i].seq < pq.items[j].seq
+}
+func (pq *priorityQueue) Swap(i, j int) { pq.items[i], pq.items[j] = pq.items[j], pq.items[i] }
+func (pq *priorityQueue) Push(x any)    { pq.items = append(pq.items, x.(*queuedTask)) }
+func (pq *priorityQueue) Pop() any {
+	n := len(pq.items)
+	it := pq.items[n-1]
+	pq.items[n-1] = nil
+	pq.items = pq.items[:n-1]
+	return it
+}
+
+// 按任务的优先级和入队时间入队，超出取值范围的优先级按边界值处理
+func (pq *priorityQueue) push(t *Task, enqueuedAt time.Time) {
+	pq.seq++
+	heap.Push(pq, &queuedTask{
+		task:       t,
+		priority:   clampPriority(t.Priority),
+		enqueuedAt: enqueuedAt,
+		seq:        pq.seq,
+	})
+}
+
+// 取出有效优先级最高的任务
+func (pq *priorityQueue) pop() *Task {
+	if len(pq.items) == 0 {
+		return nil
+	}
+	return heap.Pop(pq).(*queuedTask).task
+}
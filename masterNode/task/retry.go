@@ -0,0 +1,149 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 任务失败后的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 每个任务默认最多尝试的次数
+	BaseBackoff time.Duration // 第一次重试前等待的时间
+	MaxBackoff  time.Duration // 退避时间的上限
+}
+
+// 默认重试策略：最多尝试3次，退避时间从2秒开始翻倍，最长1分钟
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseBackoff: 2 * time.Second,
+	MaxBackoff:  time.Minute,
+}
+
+// Backoff 第attempt次失败后，下一次重试前需要等待的时间，按指数增长
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.BaseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// 死信队列最多保留的任务数，超过后丢弃最早的
+const deadLetterCapacity = 1024
+
+// DeadLetter 用尽重试次数的任务
+type DeadLetter struct {
+	Task      Task      `json:"task"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueue 死信队列，保存最终失败的任务供排查
+type DeadLetterQueue struct {
+	mu      sync.RWMutex
+	letters []DeadLetter
+}
+
+// NewDeadLetterQueue 创建死信队列
+func NewDeadLetterQueue() *DeadLetterQueue {
+	return &DeadLetterQueue{}
+}
+
+// Add 把任务放进死信队列
+func (d *DeadLetterQueue) Add(letter DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.letters) >= deadLetterCapacity {
+		d.letters = d.letters[1:]
+	}
+	d.letters = append(d.letters, letter)
+}
+
+// List 获取死信队列中的所有任务
+func (d *DeadLetterQueue) List() []DeadLetter {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]DeadLetter(nil), d.letters...)
+}
+
+// Len 死信队列中的任务数
+func (d *DeadLetterQueue) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.letters)
+}
+
+// 处理一次调度失败：还有剩余次数时退避后重新入队，否则放进死信队列
+func (q *TaskWaitQueue) handleFailure(task *Task, cause error) {
+	var attempts, maxAttempts int
+	q.store.Update(task.TaskID, func(t *Task) {
+		t.LastError = cause.Error()
+		attempts, maxAttempts = t.Attempts, t.MaxAttempts
+	})
+
+	if q.streamFailed(task, attempts, cause) {
+		return
+	}
+
+	select {
+	case <-q.closed:
+		q.deadLetter(task, attempts, fmt.Errorf("queue closed: %w", cause))
+		return
+	default:
+	}
+
+	if attempts >= maxAttempts {
+		q.deadLetter(task, attempts, cause)
+		return
+	}
+
+	backoff := q.retry.Backoff(attempts)
+	log.Printf("任务 %s 第 %d 次调度失败: %v，%v 后重试", task.TaskID, attempts, cause, backoff)
+	q.store.SetStatus(task.TaskID, StatusQueued,
+		fmt.Sprintf("attempt %d/%d failed: %v; retrying in %v", attempts, maxAttempts, cause, backoff))
+
+	time.AfterFunc(backoff, func() {
+		if err := q.Enqueue(task); err != nil {
+			q.deadLetter(task, attempts, fmt.Errorf("requeue failed: %w (last error: %v)", err, cause))
+		}
+	})
+}
+
+// 把任务标记为失败并放进死信队列
+func (q *TaskWaitQueue) deadLetter(task *Task, attempts int, cause error) {
+	log.Printf("任务 %s 尝试 %d 次后失败，放入死信队列: %v", task.TaskID, attempts, cause)
+	if err := q.store.SetStatus(task.TaskID, StatusFailed, cause.Error()); err != nil {
+		// 任务已经结束（比如在退避期间被取消），不再进入死信队列
+		return
+	}
+	snapshot, _ := q.store.Get(task.TaskID)
+	q.dlq.Add(DeadLetter{
+		Task:      snapshot,
+		Attempts:  attempts,
+		LastError: cause.Error(),
+		FailedAt:  time.Now(),
+	})
+}
+
+// GET /dead-letters 查看死信队列，和任务一样只能看到自己租户的
+func (q *TaskWaitQueue) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	visible, ok := q.taskViewer(w, r)
+	if !ok {
+		return
+	}
+	letters := []DeadLetter{}
+	for _, letter := range q.dlq.List() {
+		if visible(letter.Task) {
+			letters = append(letters, letter)
+		}
+	}
+	writeJSON(w, http.StatusOK, letters)
+}
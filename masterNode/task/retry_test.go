@@ -0,0 +1,51 @@
+package task
+
+import (
+	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %v，期望 %v", i+1, got, w)
+		}
+	}
+}
+
+// 集群中没有节点时，任务应该重试到上限后进入死信队列，而不是让master退出
+func TestUnschedulableTaskDeadLettered(t *testing.T) {
+	q := NewTaskWaitQueue(8)
+	q.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	cm := cluster.NewClusterManager(time.Second, time.Minute)
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+	go q.HandleQueue(cm, sched, 2)
+	defer q.Close()
+
+	tk := &Task{ModelName: "llama3-8b", MaxAttempts: 3}
+	q.store.Add(tk)
+	if err := q.Enqueue(tk); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for q.dlq.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("任务没有进入死信队列")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	letter := q.dlq.List()[0]
+	if letter.Attempts != 3 || letter.LastError == "" {
+		t.Errorf("死信记录 attempts=%d last_error=%q", letter.Attempts, letter.LastError)
+	}
+	got, _ := q.store.Get(tk.TaskID)
+	if got.Status != StatusFailed {
+		t.Errorf("任务状态是 %s，期望 %s", got.Status, StatusFailed)
+	}
+}
@@ -0,0 +1,169 @@
+package task
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 已经结束的任务在任务仓库中保留的时间
+const finishedTaskRetention = time.Hour
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// TaskStore 任务仓库，负责分配任务ID并记录任务的整个生命周期
+// 任务字段只能通过仓库的方法修改，读取时拿到的是副本
+type TaskStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*Task
+}
+
+// NewTaskStore 创建任务仓库
+func NewTaskStore() *TaskStore {
+	return &TaskStore{
+		tasks: make(map[string]*Task),
+	}
+}
+
+// 生成带前缀的随机ID
+func newID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
+
+// Add 提交任务时分配ID，状态置为 queued
+func (s *TaskStore) Add(t *Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	t.TaskID = newID("task")
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	t.Status = StatusQueued
+	t.History = []StatusEvent{{Status: StatusQueued, Time: now}}
+	t.done = make(chan struct{})
+	s.tasks[t.TaskID] = t
+
+	s.prune(now)
+}
+
+// Get 获取任务的副本
+func (s *TaskStore) Get(id string) (Task, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return Task{}, false
+	}
+	return t.snapshot(), true
+}
+
+// List 获取所有任务的副本，按提交时间排序
+func (s *TaskStore) List() []Task {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]Task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t.snapshot())
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+	return tasks
+}
+
+// Done 返回任务结束时关闭的通道
+func (s *TaskStore) Done(id string) (<-chan struct{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return nil, false
+	}
+	return t.done, true
+}
+
+// Update 在锁内修改任务的字段
+func (s *TaskStore) Update(id string, fn func(t *Task)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	fn(t)
+	return nil
+}
+
+// SetStatus 修改任务状态并记录时间，已经结束的任务不再变化
+func (s *TaskStore) SetStatus(id, status, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	if t.finished() {
+		return fmt.Errorf("task %s already %s", id, t.Status)
+	}
+	t.setStatus(status, message)
+	return nil
+}
+
+// Cancel 取消还在排队的任务，已经开始调度的任务无法取消
+func (s *TaskStore) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tasks[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, id)
+	}
+	if t.Status != StatusQueued {
+		return fmt.Errorf("task %s is %s and cannot be cancelled", id, t.Status)
+	}
+	t.setStatus(StatusCancelled, "cancelled by client")
+	return nil
+}
+
+// 修改状态，调用方需要持有锁
+func (t *Task) setStatus(status, message string) {
+	now := time.Now()
+	t.Status = status
+	t.UpdatedAt = now
+	if status == StatusFailed {
+		t.Error = message
+	}
+	t.History = append(t.History, StatusEvent{Status: status, Time: now, Message: message})
+	if t.finished() && t.done != nil {
+		close(t.done)
+	}
+}
+
+// 复制任务，切片也要复制，避免调用方看到后续的修改
+func (t *Task) snapshot() Task {
+	c := *t
+	c.GPUIDs = append([]string(nil), t.GPUIDs...)
+	c.History = append([]StatusEvent(nil), t.History...)
+	return c
+}
+
+// 清理结束超过保留时间的任务，调用方需要持有锁
+func (s *TaskStore) prune(now time.Time) {
+	for id, t := range s.tasks {
+		if t.finished() && now.Sub(t.UpdatedAt) > finishedTaskRetention {
+			delete(s.tasks, id)
+		}
+	}
+}
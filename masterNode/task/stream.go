@@ -0,0 +1,146 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	pb "api/schedule"
+)
+
+// 客户端已经断开，不再需要生成的内容
+var errClientGone = errors.New("client disconnected")
+
+// 调度协程最多比客户端多缓存的片段数
+const streamBuffer = 64
+
+// 流式任务的输出，调度协程写入生成的片段，HTTP处理函数读取并转发给客户端
+type taskStream struct {
+	chunks chan string
+	// 客户端断开后关闭，调度协程不再等待写入
+	gone     chan struct{}
+	goneOnce sync.Once
+	// 已经有片段发给了客户端，之后失败也不能重试，否则客户端会收到重复的内容
+	sent atomic.Bool
+}
+
+func newTaskStream() *taskStream {
+	return &taskStream{
+		chunks: make(chan string, streamBuffer),
+		gone:   make(chan struct{}),
+	}
+}
+
+// 发送一个片段，客户端已经断开时返回errClientGone
+func (s *taskStream) send(text string) error {
+	select {
+	case s.chunks <- text:
+		s.sent.Store(true)
+		return nil
+	case <-s.gone:
+		return errClientGone
+	}
+}
+
+// 客户端断开
+func (s *taskStream) close() {
+	s.goneOnce.Do(func() { close(s.gone) })
+}
+
+// 通过流式接口把提示词发给实例，生成的内容一边收到一边转发给客户端，返回拼接好的完整结果
+func (q *TaskWaitQueue) relayGeneration(ctx context.Context, task *Task, node_ip string, req *pb.InferRequest) (string, error) {
+	// 客户端断开后取消请求，工作节点随之停止生成
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-task.stream.gone:
+			cancel(errClientGone)
+		case <-ctx.Done():
+		}
+	}()
+
+	var result strings.Builder
+	err := q.workers.InferStream(ctx, node_ip, req, func(c *pb.GenerateChunk) error {
+		if c.Text == "" {
+			return nil
+		}
+		result.WriteString(c.Text)
+		return task.stream.send(c.Text)
+	})
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			return "", cause
+		}
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// 流式任务失败后是否还能重试：已经发出内容或者客户端已经断开时不能
+func (q *TaskWaitQueue) streamFailed(task *Task, attempts int, cause error) bool {
+	if task.stream == nil {
+		return false
+	}
+	switch {
+	case errors.Is(cause, errClientGone):
+		q.store.SetStatus(task.TaskID, StatusFailed, cause.Error())
+	case task.stream.sent.Load():
+		q.deadLetter(task, attempts, fmt.Errorf("failed after streaming output: %w", cause))
+	default:
+		return false
+	}
+	return true
+}
+
+// 以SSE的形式把流式任务生成的内容转发给客户端，任务结束后发送最终状态。
+// 第一个事件是task，之后每个片段是一个没有事件名的data，最后是done
+func (q *TaskWaitQueue) streamTask(w http.ResponseWriter, r *http.Request, t *Task) {
+	done, _ := q.store.Done(t.TaskID)
+	defer t.stream.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	out := &flushWriter{w: w}
+	writeEvent(out, "task", map[string]string{"task_id": t.TaskID, "status": StatusQueued})
+
+	for {
+		select {
+		case text := <-t.stream.chunks:
+			writeEvent(out, "", map[string]string{"text": text})
+		case <-done:
+			// 任务结束之前发出的片段都已经在缓冲区里了
+			for drained := false; !drained; {
+				select {
+				case text := <-t.stream.chunks:
+					writeEvent(out, "", map[string]string{"text": text})
+				default:
+					drained = true
+				}
+			}
+			final, _ := q.store.Get(t.TaskID)
+			writeEvent(out, "done", map[string]string{"task_id": t.TaskID, "status": final.Status, "error": final.Error})
+			return
+		case <-r.Context().Done():
+			// 还在排队的任务直接取消
+			q.store.Cancel(t.TaskID)
+			return
+		}
+	}
+}
+
+// 写一个SSE事件
+func writeEvent(w io.Writer, event string, data any) {
+	b, _ := json.Marshal(data)
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", b)
+}
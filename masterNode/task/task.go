@@ -1,10 +1,64 @@
 package task
 
+import "time"
+
+// 任务状态，正常流转顺序是 queued → scheduling → starting → running → succeeded，
+// 任何一步出错都会进入 failed，排队中的任务可以被取消进入 cancelled
+const (
+	StatusQueued     = "queued"
+	StatusScheduling = "scheduling"
+	StatusStarting   = "starting"
+	StatusRunning    = "running"
+	StatusSucceeded  = "succeeded"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+)
+
 type Task struct {
-	TaskID       string `json:"task_id"`
-	ModelName    string `json:"model_name"`
-	OriginPrompt string `json:"origin_prompt"`
-	NodeIP       string `json:"node_ip"`
-	Port         string `json:"port"`
-	Status       string `json:"status"`
+	TaskID       string   `json:"task_id"`
+	ModelName    string   `json:"model_name"`
+	OriginPrompt string   `json:"origin_prompt"`
+	NodeIP       string   `json:"node_ip"`
+	Port         string   `json:"port"`
+	GPUIDs       []string `json:"gpu_ids"` // 调度时选中的GPU编号
+	Status       string   `json:"status"`
+	Priority     int      `json:"priority"` // 优先级，数值越大越先调度
+	Tenant       string   `json:"tenant"`   // 任务所属的租户
+	// 任务在节点上预留的显存，任务失败时释放
+	ReservationID string `json:"reservation_id"`
+	// 处理任务的模型实例
+	InstanceID string `json:"instance_id"`
+
+	Attempts    int    `json:"attempts"`             // 已经尝试调度的次数
+	MaxAttempts int    `json:"max_attempts"`         // 最多尝试的次数，用尽后进入死信队列
+	LastError   string `json:"last_error,omitempty"` // 最近一次调度失败的原因
+
+	Result    string        `json:"result,omitempty"` // 推理结果
+	Error     string        `json:"error,omitempty"`  // 失败原因
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	History   []StatusEvent `json:"history"` // 每一次状态变化的记录
+
+	// 第一次入队的时间，重试时沿用它，等待的时间继续参与老化
+	enqueuedAt time.Time
+	// 请求流式返回结果时，生成的内容通过它转发给客户端
+	stream *taskStream
+	// 任务结束时关闭
+	done chan struct{}
+}
+
+// StatusEvent 一次状态变化
+type StatusEvent struct {
+	Status  string    `json:"status"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message,omitempty"`
+}
+
+// 任务是否已经结束
+func (t *Task) finished() bool {
+	switch t.Status {
+	case StatusSucceeded, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// 把对象以json格式写回客户端
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// 识别调用方能看到哪些任务：带管理令牌时可以看到所有租户的任务，
+// 否则只能看到自己租户的任务。识别失败时已经写回了错误
+func (q *TaskWaitQueue) taskViewer(w http.ResponseWriter, r *http.Request) (func(t Task) bool, bool) {
+	if q.isAdmin(r) {
+		return func(Task) bool { return true }, true
+	}
+	tenant, err := q.tenantOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return func(t Task) bool { return t.Tenant == tenant }, true
+}
+
+// 获取调用方可以看到的任务，其他租户的任务当作不存在
+func (q *TaskWaitQueue) visibleTask(w http.ResponseWriter, r *http.Request) (Task, bool) {
+	visible, ok := q.taskViewer(w, r)
+	if !ok {
+		return Task{}, false
+	}
+	t, exists := q.store.Get(r.PathValue("id"))
+	if !exists || !visible(t) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return Task{}, false
+	}
+	return t, true
+}
+
+// GET /tasks 列出调用方租户的任务，带管理令牌时列出所有任务
+func (q *TaskWaitQueue) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	visible, ok := q.taskViewer(w, r)
+	if !ok {
+		return
+	}
+	tasks := []Task{}
+	for _, t := range q.store.List() {
+		if visible(t) {
+			tasks = append(tasks, t)
+		}
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// GET /tasks/{id} 查询单个任务的状态
+func (q *TaskWaitQueue) handleGetTask(w http.ResponseWriter, r *http.Request) {
+	t, ok := q.visibleTask(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// DELETE /tasks/{id} 取消还在排队的任务
+func (q *TaskWaitQueue) handleCancelTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := q.visibleTask(w, r); !ok {
+		return
+	}
+	id := r.PathValue("id")
+	if err := q.store.Cancel(id); err != nil {
+		if errors.Is(err, ErrTaskNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	t, _ := q.store.Get(id)
+	writeJSON(w, http.StatusOK, t)
+}
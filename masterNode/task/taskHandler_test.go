@@ -0,0 +1,61 @@
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTaskEndpointsAreScopedToTenant(t *testing.T) {
+	q := NewTaskWaitQueue(8)
+	q.SetAdminToken("secret")
+	q.SetTenant("team-a", 1, []string{"key-a"})
+	q.SetTenant("team-b", 1, []string{"key-b"})
+	mine := &Task{ModelName: "gpt", OriginPrompt: "mine", Tenant: "team-a"}
+	theirs := &Task{ModelName: "gpt", OriginPrompt: "theirs", Tenant: "team-b"}
+	q.store.Add(mine)
+	q.store.Add(theirs)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", q.handleListTasks)
+	mux.HandleFunc("GET /tasks/{id}", q.handleGetTask)
+	mux.HandleFunc("DELETE /tasks/{id}", q.handleCancelTask)
+	do := func(method, path string, header, value string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set(header, value)
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+	count := func(rec *httptest.ResponseRecorder) int {
+		var tasks []Task
+		json.NewDecoder(rec.Body).Decode(&tasks)
+		return len(tasks)
+	}
+
+	// 只能看到和取消自己租户的任务，其他租户的任务当作不存在
+	if n := count(do("GET", "/tasks", APIKeyHeader, "key-a")); n != 1 {
+		t.Fatalf("team-a 看到 %d 个任务，期望 1", n)
+	}
+	if rec := do("GET", "/tasks/"+mine.TaskID, APIKeyHeader, "key-a"); rec.Code != http.StatusOK {
+		t.Fatalf("查询自己的任务返回 %d", rec.Code)
+	}
+	if rec := do("GET", "/tasks/"+theirs.TaskID, APIKeyHeader, "key-a"); rec.Code != http.StatusNotFound {
+		t.Fatalf("查询其他租户的任务返回 %d，期望 404", rec.Code)
+	}
+	if rec := do("DELETE", "/tasks/"+theirs.TaskID, APIKeyHeader, "key-a"); rec.Code != http.StatusNotFound {
+		t.Fatalf("取消其他租户的任务返回 %d，期望 404", rec.Code)
+	}
+	if got, _ := q.store.Get(theirs.TaskID); got.Status != StatusQueued {
+		t.Fatalf("其他租户的任务被取消了: %s", got.Status)
+	}
+	if rec := do("GET", "/tasks", TenantHeader, "team-b"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("用请求头冒充租户返回 %d，期望 401", rec.Code)
+	}
+
+	// 管理员可以看到所有任务
+	if n := count(do("GET", "/tasks", adminHeader, "secret")); n != 2 {
+		t.Fatalf("管理员看到 %d 个任务，期望 2", n)
+	}
+}
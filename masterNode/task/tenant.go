@@ -0,0 +1,221 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 没有携带租户身份的请求归到默认租户
+const DefaultTenant = "default"
+
+// 请求中携带租户身份的请求头
+const (
+	TenantHeader = "X-Tenant-ID"
+	APIKeyHeader = "X-API-Key"
+	adminHeader  = "X-Admin-Token"
+)
+
+// tenantQueue 一个租户自己的等待队列
+type tenantQueue struct {
+	name   string
+	weight int
+	tasks  *priorityQueue
+	// 上一个被服务任务的虚拟结束时间，用于加权公平排队
+	finish float64
+	// 由管理员配置过的租户，队列为空时也保留
+	configured bool
+}
+
+// TenantInfo 租户的配置和当前状态
+type TenantInfo struct {
+	Name    string `json:"name"`
+	Weight  int    `json:"weight"`
+	Queued  int    `json:"queued"`
+	APIKeys int    `json:"api_keys"`
+}
+
+// 获取租户的队列，不存在时以权重1创建，调用方需要持有锁
+func (q *TaskWaitQueue) tenantLocked(name string) *tenantQueue {
+	tq, exists := q.tenants[name]
+	if !exists {
+		tq = &tenantQueue{
+			name:   name,
+			weight: 1,
+			tasks:  newPriorityQueue(q.agingInterval),
+		}
+		q.tenants[name] = tq
+	}
+	return tq
+}
+
+// 按加权公平排队（start-time fair queueing）选出下一个被服务的租户并取出任务，
+// 每个租户按权重分享出队机会，租户内部仍然按优先级和老化出队，调用方需要持有锁
+func (q *TaskWaitQueue) popLocked() *Task {
+	var best *tenantQueue
+	var bestStart float64
+	for _, tq := range q.tenants {
+		if tq.tasks.Len() == 0 {
+			continue
+		}
+		// 空闲过的租户从当前虚拟时间开始计算，不能攒下额度之后突发
+		start := max(q.vtime, tq.finish)
+		if best == nil || start < bestStart || (start == bestStart && tq.name < best.name) {
+			best = tq
+			bestStart = start
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	q.vtime = bestStart
+	best.finish = bestStart + 1/float64(best.weight)
+	t := best.tasks.pop()
+	q.queued--
+	if best.tasks.Len() == 0 && !best.configured {
+		delete(q.tenants, best.name)
+	}
+	return t
+}
+
+// SetTenant 设置租户的权重和API Key，权重越大分到的出队机会越多
+func (q *TaskWaitQueue) SetTenant(name string, weight int, apiKeys []string) error {
+	if name == "" {
+		return fmt.Errorf("tenant name is required")
+	}
+	if weight < 1 {
+		return fmt.Errorf("tenant weight must be at least 1, got %d", weight)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tq := q.tenantLocked(name)
+	tq.weight = weight
+	tq.configured = true
+
+	// 替换该租户原有的API Key
+	for key, tenant := range q.apiKeys {
+		if tenant == name {
+			delete(q.apiKeys, key)
+		}
+	}
+	for _, key := range apiKeys {
+		if key != "" {
+			q.apiKeys[key] = name
+		}
+	}
+	return nil
+}
+
+// Tenants 获取所有租户的权重和排队深度
+func (q *TaskWaitQueue) Tenants() []TenantInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	keys := make(map[string]int)
+	for _, tenant := range q.apiKeys {
+		keys[tenant]++
+	}
+	infos := make([]TenantInfo, 0, len(q.tenants))
+	for _, tq := range q.tenants {
+		infos = append(infos, TenantInfo{
+			Name:    tq.name,
+			Weight:  tq.weight,
+			Queued:  tq.tasks.Len(),
+			APIKeys: keys[tq.name],
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// SetAdminToken 设置管理接口的令牌，为空表示不校验
+func (q *TaskWaitQueue) SetAdminToken(token string) {
+	q.adminToken = token
+}
+
+// 从请求中识别租户：优先使用API Key，其次是租户请求头，都没有时归到默认租户。
+// 配置了API Key的租户只能用API Key识别，不能通过请求头冒用
+func (q *TaskWaitQueue) tenantOf(r *http.Request) (string, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		q.mu.Lock()
+		tenant, exists := q.apiKeys[key]
+		q.mu.Unlock()
+		if !exists {
+			return "", fmt.Errorf("unknown API key")
+		}
+		return tenant, nil
+	}
+	if tenant := strings.TrimSpace(r.Header.Get(TenantHeader)); tenant != "" {
+		if q.hasAPIKeys(tenant) {
+			return "", fmt.Errorf("tenant %s requires an API key", tenant)
+		}
+		return tenant, nil
+	}
+	return DefaultTenant, nil
+}
+
+// 租户是否配置了API Key
+func (q *TaskWaitQueue) hasAPIKeys(tenant string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, name := range q.apiKeys {
+		if name == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// 请求是否带着正确的管理令牌，没有设置管理令牌时谁都不是管理员
+func (q *TaskWaitQueue) isAdmin(r *http.Request) bool {
+	return q.adminToken != "" && r.Header.Get(adminHeader) == q.adminToken
+}
+
+// 校验管理接口的令牌，没有设置管理令牌时拒绝所有管理请求
+func (q *TaskWaitQueue) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if q.adminToken == "" {
+		http.Error(w, "Admin API is disabled, start the master with -admin-token", http.StatusForbidden)
+		return false
+	}
+	if r.Header.Get(adminHeader) != q.adminToken {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GET /admin/tenants 查看所有租户
+func (q *TaskWaitQueue) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, q.Tenants())
+}
+
+// PUT /admin/tenants/{tenant} 设置租户的权重和API Key
+func (q *TaskWaitQueue) handleSetTenant(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAdmin(w, r) {
+		return
+	}
+
+	var reqBody struct {
+		Weight  int      `json:"weight"`
+		APIKeys []string `json:"api_keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("tenant")
+	if err := q.SetTenant(name, reqBody.Weight, reqBody.APIKeys); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "weight": reqBody.Weight})
+}
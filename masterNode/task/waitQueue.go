@@ -1,66 +1,192 @@
 package task
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
 	"log"
 	"net"
 	"net/http"
 	"sync"
 	"time"
-
-	pb "lightScheduler/schedule" // 替换为你的包路径
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-// TaskWaitQueue 基于Channel的任务队列
+// TaskWaitQueue 多租户的任务队列，每个租户有自己的优先级队列，
+// 租户之间按权重公平出队，避免一个租户的突发请求挤占其他租户；
+// 租户内部先取出优先级最高的任务，低优先级的任务会随着等待时间老化提高优先级，避免饿死
 type TaskWaitQueue struct {
-	queue     chan *Task
-	closeOnce sync.Once
-	closed    chan struct{}
+	mu sync.Mutex
+	// 租户名 -> 租户队列
+	tenants map[string]*tenantQueue
+	// API Key -> 租户名
+	apiKeys map[string]string
+	// 加权公平排队的全局虚拟时间
+	vtime float64
+	// 每个租户最多排队的任务数
+	size int
+	// 所有租户合计最多排队的任务数，以及当前排队的任务数。
+	// 租户请求头可以随意取名，每个租户各自的上限挡不住换着名字提交的请求
+	capacity      int
+	queued        int
+	agingInterval time.Duration
+	adminToken    string
+	// 有新任务入队时通知等待中的 Dequeue
+	notify chan struct{}
+	// 正在运行的调度协程
+	dispatchers sync.WaitGroup
+	closeOnce   sync.Once
+	closed      chan struct{}
+	// 记录所有提交过的任务及其状态
+	store *TaskStore
+	// 调度失败后的重试策略和最终失败任务的死信队列
+	retry RetryPolicy
+	dlq   *DeadLetterQueue
+	// 访问工作节点的客户端
+	workers WorkerClient
+	// 集群管理器，HandleQueue 开始后才有，用于查询实例所在的节点
+	cluster *cluster.ClusterManager
+	// 获取当前时间，测试时可以替换
+	now func() time.Time
 }
 
-// NewTaskWaitQueue 创建新队列
+// 默认所有租户合计最多排队的任务数
+const DefaultQueueCapacity = 1024
+
+// NewTaskWaitQueue 创建新队列，size 是每个租户最多排队的任务数
 func NewTaskWaitQueue(size int) *TaskWaitQueue {
+	return NewTaskWaitQueueWithAging(size, DefaultAgingInterval)
+}
+
+// NewTaskWaitQueueWithAging 创建使用指定老化间隔的队列，任务每等待 agingInterval
+// 优先级提高1级，小于等于0表示不老化。堆的顺序依赖老化间隔，所以创建后不能再修改
+func NewTaskWaitQueueWithAging(size int, agingInterval time.Duration) *TaskWaitQueue {
 	return &TaskWaitQueue{
-		queue:  make(chan *Task, size),
-		closed: make(chan struct{}),
+		tenants:       make(map[string]*tenantQueue),
+		apiKeys:       make(map[string]string),
+		size:          size,
+		capacity:      max(size, DefaultQueueCapacity),
+		agingInterval: agingInterval,
+		notify:        make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+		store:         NewTaskStore(),
+		retry:         DefaultRetryPolicy,
+		dlq:           NewDeadLetterQueue(),
+		workers:       grpcWorkerClient{},
+		now:           time.Now,
 	}
 }
 
-// Enqueue 添加任务
+// SetCapacity 设置所有租户合计最多排队的任务数，需要在开始接收任务之前调用
+func (q *TaskWaitQueue) SetCapacity(capacity int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capacity = capacity
+}
+
+// SetRetryPolicy 设置重试策略，需要在开始接收任务之前调用
+func (q *TaskWaitQueue) SetRetryPolicy(p RetryPolicy) {
+	q.retry = p
+}
+
+// DeadLetters 获取死信队列
+func (q *TaskWaitQueue) DeadLetters() *DeadLetterQueue {
+	return q.dlq
+}
+
+// Store 获取任务仓库
+func (q *TaskWaitQueue) Store() *TaskStore {
+	return q.store
+}
+
+// Len 所有租户等待中的任务总数
+func (q *TaskWaitQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued
+}
+
+// Enqueue 把任务添加到所属租户的队列，租户队列或者整个队列满时返回错误
 func (q *TaskWaitQueue) Enqueue(req *Task) error {
 	select {
-	case q.queue <- req:
-		return nil
 	case <-q.closed:
 		return errors.New("queue closed")
 	default:
+	}
+
+	if req.Tenant == "" {
+		req.Tenant = DefaultTenant
+	}
+
+	q.mu.Lock()
+	// 先检查总数，整个队列满时不再创建新的租户队列
+	if q.queued >= q.capacity {
+		q.mu.Unlock()
 		return errors.New("queue full")
 	}
+	tq := q.tenantLocked(req.Tenant)
+	if tq.tasks.Len() >= q.size {
+		q.mu.Unlock()
+		return errors.New("queue full")
+	}
+	// 重试的任务沿用第一次入队的时间，不会因为重试失去已经累积的老化。
+	// 已经放进任务仓库的任务由调用方事先写好入队时间，这里只给没有入库的任务补上
+	if req.enqueuedAt.IsZero() {
+		req.enqueuedAt = q.now()
+	}
+	tq.tasks.push(req, req.enqueuedAt)
+	q.queued++
+	q.mu.Unlock()
+
+	q.signal()
+	return nil
 }
 
-// Dequeue 获取任务
+// Dequeue 获取任务，队列为空时阻塞，直到有新任务或者队列关闭
 func (q *TaskWaitQueue) Dequeue() (*Task, error) {
+	for {
+		select {
+		case <-q.closed:
+			return nil, errors.New("queue closed")
+		default:
+		}
+
+		q.mu.Lock()
+		req := q.popLocked()
+		q.mu.Unlock()
+
+		if req != nil {
+			// 通知只有一个缓冲，取出任务后继续唤醒其他等待者，
+			// 队列已经空了的话，被唤醒的等待者会重新进入等待
+			q.signal()
+			return req, nil
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.closed:
+			return nil, errors.New("queue closed")
+		}
+	}
+}
+
+// 非阻塞地发出一次入队通知
+func (q *TaskWaitQueue) signal() {
 	select {
-	case req := <-q.queue:
-		return req, nil
-	case <-q.closed:
-		return nil, errors.New("queue closed")
+	case q.notify <- struct{}{}:
+	default:
 	}
 }
 
-// Close 关闭队列
+// Close 关闭队列，不再出队新的任务，等待正在进行的调度完成后返回
 func (q *TaskWaitQueue) Close() {
 	q.closeOnce.Do(func() {
+		q.mu.Lock()
 		close(q.closed)
-		close(q.queue)
+		q.mu.Unlock()
 	})
+	q.dispatchers.Wait()
 }
 
 // 启动任务接受服务器
@@ -68,6 +194,18 @@ func (q *TaskWaitQueue) StartTaskHTTPServer(port string) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/inference", q.addToWaitQueue)
 	mux.HandleFunc("/health", q.handleHealth)
+	mux.HandleFunc("GET /tasks", q.handleListTasks)
+	mux.HandleFunc("GET /tasks/{id}", q.handleGetTask)
+	mux.HandleFunc("DELETE /tasks/{id}", q.handleCancelTask)
+	mux.HandleFunc("GET /dead-letters", q.handleDeadLetters)
+	mux.HandleFunc("GET /instances/{id}/logs", q.handleInstanceLogs)
+	mux.HandleFunc("GET /admin/tenants", q.handleListTenants)
+	mux.HandleFunc("PUT /admin/tenants/{tenant}", q.handleSetTenant)
+	mux.HandleFunc("POST /admin/nodes/{id}/pull", q.handlePullImage)
+	mux.HandleFunc("GET /admin/nodes/{id}/instances", q.handleNodeInstances)
+	mux.HandleFunc("POST /admin/nodes/{id}/drain", q.handleDrainNode)
+	mux.HandleFunc("POST /admin/join-tokens", q.handleCreateJoinToken)
+	mux.HandleFunc("DELETE /admin/instances/{id}", q.handleStopInstance)
 
 	http_server := &http.Server{
 		Addr:    ":" + port,
@@ -101,6 +239,12 @@ func (q *TaskWaitQueue) addToWaitQueue(w http.ResponseWriter, r *http.Request) {
 	type RequestBody struct {
 		ModelName    string `json:"model_name"`
 		OriginPrompt string `json:"origin_prompt"`
+		// 可选，覆盖默认的最多尝试次数
+		MaxAttempts int `json:"max_attempts"`
+		// 可选，数值越大越先调度，默认为0
+		Priority int `json:"priority"`
+		// 可选，为true时以SSE的形式边生成边返回结果，否则只返回任务ID
+		Stream bool `json:"stream"`
 	}
 
 	// 2. 解析请求体
@@ -110,104 +254,128 @@ func (q *TaskWaitQueue) addToWaitQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 识别请求所属的租户
+	tenant, err := q.tenantOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	// 3. 验证必填字段
 	if reqBody.ModelName == "" {
 		http.Error(w, "model_name and prompt are required", http.StatusBadRequest)
 		return
 	}
+	if _, exists := lookupModel(reqBody.ModelName); !exists {
+		http.Error(w, "Unknown model", http.StatusBadRequest)
+		return
+	}
+	if reqBody.Priority < MinPriority || reqBody.Priority > MaxPriority {
+		http.Error(w, fmt.Sprintf("priority must be between %d and %d", MinPriority, MaxPriority), http.StatusBadRequest)
+		return
+	}
 
 	// 从请求体中取出值，构造任务
 	modelName := reqBody.ModelName
 	origin_prompt := reqBody.OriginPrompt
 
+	max_attempts := q.retry.MaxAttempts
+	if reqBody.MaxAttempts > 0 {
+		max_attempts = reqBody.MaxAttempts
+	}
+
 	new_task := &Task{
 		ModelName:    modelName,
 		OriginPrompt: origin_prompt,
+		MaxAttempts:  max_attempts,
+		Priority:     reqBody.Priority,
+		Tenant:       tenant,
+		// 入队时间在放进任务仓库之前写好，放进去之后任务只能在仓库的锁内修改
+		enqueuedAt: q.now(),
+	}
+	if reqBody.Stream {
+		new_task.stream = newTaskStream()
 	}
+	// 先放进任务仓库分配ID，再入队，保证出队时任务一定能查到
+	q.store.Add(new_task)
 
 	if err := q.Enqueue(new_task); err != nil {
+		q.store.SetStatus(new_task.TaskID, StatusFailed, err.Error())
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("等待队列中的任务数：%d", q.Len())
+
+	if new_task.stream != nil {
+		q.streamTask(w, r, new_task)
+		return
 	}
-	log.Printf("等待队列中的任务数：%d", len(q.queue))
+
+	// 返回任务ID，客户端可以通过 /tasks/{id} 查询任务状态
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"task_id": new_task.TaskID,
+		"status":  StatusQueued,
+	})
 
 }
 
-// 健康测试，实际上会返回当前等待队列中的任务数量
+// 健康测试，实际上会返回当前等待队列中的任务数量，以及每个租户的排队深度
 func (q *TaskWaitQueue) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "等待队列中的任务数：%d", len(q.queue))
-}
-
-// 持续不断取出等待队列中的元素
-func (q *TaskWaitQueue) HandleQueue(cm *cluster.ClusterManager) {
-	for {
-		select {
-		case task := <-q.queue:
-			// 把任务调度到合适的节点上
-			log.Printf("任务已加入：%s", task.ModelName)
-			sechedule(task, cm)
-		case <-q.closed:
-			fmt.Println("Processor stopped by close signal")
-			return
-		}
+	fmt.Fprintf(w, "等待队列中的任务数：%d，死信队列中的任务数：%d", q.Len(), q.dlq.Len())
+	for _, tenant := range q.Tenants() {
+		fmt.Fprintf(w, "\n租户 %s：排队 %d，权重 %d", tenant.Name, tenant.Queued, tenant.Weight)
 	}
 }
 
-func sechedule(task *Task, cm *cluster.ClusterManager) {
-	// 先获取任务中模型的显存需求
-	model_info := ModelsInfo[task.ModelName]
-	require_mem_MB := model_info.size_GB * 1024
+// 默认的调度协程数
+const DefaultDispatchers = 4
 
-	// TODO,遍历cm的节点列表，选择一个合适的节点调度
-	var target_node *cluster.Node = nil
-	for _, node := range cm.GetNodes() {
-		var node_availabe_mem_MB uint64
-		node_availabe_mem_MB = 0
-		for _, gpu := range node.GPUs {
-			node_availabe_mem_MB += gpu.FreeMemoryMB
-		}
-		if node_availabe_mem_MB >= require_mem_MB {
-			target_node = node
-			break
-		}
+// 启动 dispatchers 个调度协程，持续不断取出等待队列中的元素，用sched选择的策略进行调度
+// 阻塞直到队列关闭、所有调度协程退出
+func (q *TaskWaitQueue) HandleQueue(cm *cluster.ClusterManager, sched scheduler.Scheduler, dispatchers int) {
+	if dispatchers < 1 {
+		dispatchers = 1
 	}
 
-	if target_node == nil {
-		log.Fatalf("没有找到合适的节点调度任务")
+	// 和 Close 互斥，保证关闭之后不会再增加调度协程
+	q.mu.Lock()
+	select {
+	case <-q.closed:
+		q.mu.Unlock()
 		return
+	default:
 	}
-
-	url := target_node.IP + ":10000"
-
-	// grpc通信服务器的地址
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+	q.dispatchers.Add(dispatchers)
+	q.cluster = cm
+	q.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < dispatchers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer q.dispatchers.Done()
+			q.dispatch(cm, sched)
+		}()
 	}
-	defer conn.Close()
-
-	c := pb.NewScheduleServiceClient(conn)
-
-	// 增加超时时间到 30 秒，启动一个容器是比较耗时的
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// 发送请求
-	r, err := c.ProcessMessage(ctx, &pb.ScheduleRequest{
-		ModelName:    task.ModelName,
-		OriginPrompt: task.OriginPrompt,
-	})
-
-	if err != nil {
-		log.Fatalf("rpc请求创建容器失败: %v", err)
-	}
-
-	if r.Success {
-		fmt.Printf("访问端口是: %s \n", r.Port)
-		fmt.Printf("响应内容: %s", r.Message)
+	wg.Wait()
+	fmt.Println("Processor stopped by close signal")
+}
 
-	} else {
-		log.Printf("处理失败: %s", r.Message)
+// 一个调度协程的主循环
+func (q *TaskWaitQueue) dispatch(cm *cluster.ClusterManager, sched scheduler.Scheduler) {
+	for {
+		task, err := q.Dequeue()
+		if err != nil {
+			return
+		}
+		// 把任务调度到合适的节点上
+		log.Printf("任务已加入：%s，优先级：%d", task.ModelName, task.Priority)
+		if err := q.sechedule(task, cm, sched); err != nil {
+			q.handleFailure(task, err)
+		}
 	}
-
 }
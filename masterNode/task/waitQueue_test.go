@@ -0,0 +1,274 @@
+package task
+
+import (
+	"fmt"
+	"lightScheduler/cluster"
+	"lightScheduler/scheduler"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitQueuePriority(t *testing.T) {
+	q := NewTaskWaitQueueWithAging(3, 0)
+
+	for _, p := range []int{0, 5, 1} {
+		if err := q.Enqueue(&Task{Priority: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue(&Task{}); err == nil || err.Error() != "queue full" {
+		t.Fatalf("期望 queue full，得到 %v", err)
+	}
+
+	for _, want := range []int{5, 1, 0} {
+		got, err := q.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Priority != want {
+			t.Errorf("出队任务的优先级是 %d，期望 %d", got.Priority, want)
+		}
+	}
+
+	q.Close()
+	if _, err := q.Dequeue(); err == nil {
+		t.Fatal("关闭后 Dequeue 应该返回错误")
+	}
+	if err := q.Enqueue(&Task{}); err == nil {
+		t.Fatal("关闭后 Enqueue 应该返回错误")
+	}
+}
+
+func TestWaitQueueAging(t *testing.T) {
+	q := NewTaskWaitQueueWithAging(8, time.Second)
+
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	old := &Task{Priority: 0}
+	q.Enqueue(old)
+
+	// 低优先级任务等待了3秒，有效优先级变成3，高于后来的优先级2的任务
+	now = now.Add(3 * time.Second)
+	q.Enqueue(&Task{Priority: 2})
+	if got, _ := q.Dequeue(); got != old {
+		t.Fatalf("老化后的任务应该先出队，得到优先级 %d 的任务", got.Priority)
+	}
+
+	// 优先级足够高的新任务仍然可以插队
+	q.Enqueue(old)
+	now = now.Add(time.Second)
+	q.Enqueue(&Task{Priority: 9})
+	if got, _ := q.Dequeue(); got.Priority != 9 {
+		t.Fatalf("期望优先级9的任务先出队，得到 %d", got.Priority)
+	}
+}
+
+// 重试的任务重新入队时保留已经累积的老化
+func TestWaitQueueRequeueKeepsAging(t *testing.T) {
+	q := NewTaskWaitQueueWithAging(8, time.Second)
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	retried := &Task{Priority: 0}
+	q.Enqueue(retried)
+	q.Dequeue()
+
+	// 调度失败后过了3秒重新入队，有效优先级是3，高于刚入队的优先级2的任务
+	now = now.Add(3 * time.Second)
+	q.Enqueue(&Task{Priority: 2})
+	q.Enqueue(retried)
+	if got, _ := q.Dequeue(); got != retried {
+		t.Fatalf("重试的任务应该先出队，得到优先级 %d 的任务", got.Priority)
+	}
+}
+
+// 超出取值范围的优先级按边界值排序，不会溢出成最低优先级
+func TestWaitQueuePriorityBounds(t *testing.T) {
+	q := NewTaskWaitQueueWithAging(8, time.Hour)
+
+	for _, p := range []int{math.MinInt, 0, math.MaxInt, MaxPriority - 1} {
+		q.Enqueue(&Task{Priority: p})
+	}
+	for _, want := range []int{math.MaxInt, MaxPriority - 1, 0, math.MinInt} {
+		got, _ := q.Dequeue()
+		if got.Priority != want {
+			t.Fatalf("出队任务的优先级是 %d，期望 %d", got.Priority, want)
+		}
+	}
+
+	// 通过接口提交时直接拒绝
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(fmt.Sprintf(`{"model_name": "llama3-8b", "priority": %d}`, MaxPriority+1))
+	q.addToWaitQueue(rec, httptest.NewRequest("POST", "/inference", body))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "priority") {
+		t.Fatalf("超出范围的优先级返回 %d %q，期望 400", rec.Code, rec.Body.String())
+	}
+	if q.Len() != 0 {
+		t.Fatal("被拒绝的任务不应该入队")
+	}
+}
+
+// 通过接口提交的任务放进任务仓库之后，入队不再修改任务，和读取任务仓库的请求没有数据竞争
+func TestSubmitDoesNotRaceWithTaskReads(t *testing.T) {
+	q := NewTaskWaitQueue(64)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				q.store.List()
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		rec := httptest.NewRecorder()
+		q.addToWaitQueue(rec, httptest.NewRequest("POST", "/inference", strings.NewReader(`{"model_name": "llama3-8b"}`)))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("提交任务返回 %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, task := range q.store.List() {
+		if task.enqueuedAt.IsZero() {
+			t.Fatalf("任务 %s 没有记录入队时间", task.TaskID)
+		}
+	}
+}
+
+func TestWaitQueueDequeueBlocks(t *testing.T) {
+	q := NewTaskWaitQueue(8)
+	done := make(chan *Task)
+	go func() {
+		got, _ := q.Dequeue()
+		done <- got
+	}()
+
+	want := &Task{ModelName: "gpt"}
+	time.Sleep(10 * time.Millisecond)
+	q.Enqueue(want)
+	select {
+	case got := <-done:
+		if got != want {
+			t.Fatal("出队的不是刚入队的任务")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dequeue 没有被入队唤醒")
+	}
+}
+
+func TestWaitQueueFairShare(t *testing.T) {
+	q := NewTaskWaitQueueWithAging(8, 0)
+	q.SetTenant("team-a", 3, nil)
+	q.SetTenant("team-b", 1, nil)
+
+	// team-a 的突发请求只会占满它自己的队列
+	for i := 0; i < 8; i++ {
+		if err := q.Enqueue(&Task{Tenant: "team-a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue(&Task{Tenant: "team-a"}); err == nil {
+		t.Fatal("team-a 的队列应该已满")
+	}
+	for i := 0; i < 8; i++ {
+		if err := q.Enqueue(&Task{Tenant: "team-b"}); err != nil {
+			t.Fatalf("team-b 不应该被 team-a 阻塞: %v", err)
+		}
+	}
+
+	// 按 3:1 的权重出队
+	served := map[string]int{}
+	for i := 0; i < 8; i++ {
+		got, _ := q.Dequeue()
+		served[got.Tenant]++
+	}
+	if served["team-a"] != 6 || served["team-b"] != 2 {
+		t.Errorf("出队次数 %v，期望 team-a:6 team-b:2", served)
+	}
+
+	for _, info := range q.Tenants() {
+		if info.Name == "team-a" && info.Queued != 2 {
+			t.Errorf("team-a 排队深度 %d，期望 2", info.Queued)
+		}
+	}
+}
+
+func TestWaitQueueTenantHeaderLimits(t *testing.T) {
+	q := NewTaskWaitQueue(4)
+	q.SetCapacity(6)
+	q.SetTenant("team-a", 1, []string{"key-a"})
+
+	// 换着租户名提交也不能超过整个队列的上限
+	for i := 0; i < 6; i++ {
+		if err := q.Enqueue(&Task{Tenant: fmt.Sprintf("tenant-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue(&Task{Tenant: "tenant-new"}); err == nil {
+		t.Fatal("整个队列已满时应该拒绝新租户的任务")
+	}
+	if n := len(q.Tenants()); n != 7 {
+		t.Fatalf("租户数 %d，期望 7，被拒绝的租户不应该留下队列", n)
+	}
+
+	// 配置了API Key的租户不能通过请求头冒用
+	r := httptest.NewRequest("POST", "/inference", nil)
+	r.Header.Set(TenantHeader, "team-a")
+	if _, err := q.tenantOf(r); err == nil {
+		t.Fatal("没有API Key时不应该识别成 team-a")
+	}
+	r.Header.Set(APIKeyHeader, "key-a")
+	if tenant, err := q.tenantOf(r); err != nil || tenant != "team-a" {
+		t.Fatalf("用API Key识别出 %q %v，期望 team-a", tenant, err)
+	}
+	r = httptest.NewRequest("POST", "/inference", nil)
+	r.Header.Set(TenantHeader, "team-b")
+	if tenant, err := q.tenantOf(r); err != nil || tenant != "team-b" {
+		t.Fatalf("没有API Key的租户识别出 %q %v，期望 team-b", tenant, err)
+	}
+}
+
+// 多个调度协程同时放置任务时，同一块显存只能被预留一次
+func TestConcurrentPlacementNoDoubleBooking(t *testing.T) {
+	cm := cluster.NewClusterManager(time.Second, time.Minute)
+	cm.RegisterNode("node-1", "127.0.0.1", "7070")
+	cm.UpdateHeartbeat("node-1", map[string]cluster.GPU{
+		"0": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+		"1": {TotalMemoryMB: 24576, FreeMemoryMB: 20480},
+	}, time.Now())
+	sched, _ := scheduler.New(scheduler.PolicyFirstFit)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	placed := map[string]int{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, _, err := place(&Task{ModelName: "llama3-8b"}, cm, sched)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			placed[p[0].GPUIDs[0]]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(placed) != 2 || placed["0"] != 1 || placed["1"] != 1 {
+		t.Fatalf("每张GPU应该只被分配一次，实际 %v", placed)
+	}
+}
@@ -0,0 +1,262 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 工作节点调度服务器的端口
+const workerSchedulePort = "10000"
+
+// 发给已经就绪的实例的请求超时时间
+const workerRequestTimeout = 30 * time.Second
+
+// 一次生成的最长时间，长文本的生成可能要几分钟，流式任务在客户端断开时提前取消
+const workerInferTimeout = 10 * time.Minute
+
+// 启动一个容器要拉起模型服务并加载权重，非常耗时，等待时间要比工作节点的就绪超时更长，
+// 容器加载失败时由工作节点负责提前返回
+const workerStartTimeout = 10 * time.Minute
+
+// WorkerClient 管理工作节点上的实例并向实例发送提示词，测试时可以换成假的实现
+type WorkerClient interface {
+	// StartInstance 启动实例，直到模型服务就绪才返回
+	StartInstance(ctx context.Context, node_ip string, req *pb.StartInstanceRequest) (*pb.InstanceInfo, error)
+	StopInstance(ctx context.Context, node_ip string, req *pb.StopInstanceRequest) error
+	// ReserveRendezvousPort 在节点上为组调度的成员预留分布式组使用的端口
+	ReserveRendezvousPort(ctx context.Context, node_ip string, instance_id string) (string, error)
+	// GetInstance 查询节点上的实例，节点上没有这个实例时返回NotFound
+	GetInstance(ctx context.Context, node_ip string, instance_id string) (*pb.InstanceInfo, error)
+	ListInstances(ctx context.Context, node_ip string, req *pb.ListInstancesRequest) ([]*pb.InstanceInfo, error)
+	// Infer 把提示词发给已经就绪的实例，返回完整结果
+	Infer(ctx context.Context, node_ip string, req *pb.InferRequest) (string, error)
+	// InferStream 和Infer一样处理提示词，每收到一段生成的内容调用一次chunk，chunk返回错误时停止生成
+	InferStream(ctx context.Context, node_ip string, req *pb.InferRequest, chunk func(*pb.GenerateChunk) error) error
+	// StreamLogs 把实例的日志写入w，直到日志结束或ctx取消
+	StreamLogs(ctx context.Context, node_ip string, req *pb.LogsRequest, w io.Writer) error
+	// PullImage 让工作节点预先拉取镜像，每收到一条进度调用一次progress
+	PullImage(ctx context.Context, node_ip string, req *pb.PullImageRequest, progress func(*pb.PullProgress)) error
+}
+
+// SetWorkerCredentials 设置连接工作节点使用的证书，需要在开始调度之前调用
+func (q *TaskWaitQueue) SetWorkerCredentials(creds *pki.Credentials) {
+	q.workers = grpcWorkerClient{creds: creds, nodeIDs: q.nodeIDsAt}
+}
+
+// 登记在该IP上的节点
+func (q *TaskWaitQueue) nodeIDsAt(node_ip string) []string {
+	q.mu.Lock()
+	cm := q.cluster
+	q.mu.Unlock()
+	if cm == nil {
+		return nil
+	}
+	var ids []string
+	for id, node := range cm.GetNodes() {
+		if node.IP == node_ip {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// 通过gRPC访问工作节点
+type grpcWorkerClient struct {
+	// 连接工作节点使用的证书，为nil时不使用TLS
+	creds *pki.Credentials
+	// 查询登记在某个IP上的节点，对端的证书必须属于这些节点之一
+	nodeIDs func(node_ip string) []string
+}
+
+// 连接工作节点使用的传输凭证。所有节点的证书都由同一个CA签发，
+// 还要确认对端的证书属于登记在这个IP上的节点
+func (wc grpcWorkerClient) transportCredentials(node_ip string) (credentials.TransportCredentials, error) {
+	if wc.creds == nil {
+		return insecure.NewCredentials(), nil
+	}
+	ids := wc.nodeIDs(node_ip)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no node registered at %s", node_ip)
+	}
+	return credentials.NewTLS(wc.creds.ClientConfig(pki.AllowCommonName(ids...))), nil
+}
+
+// 连接节点上的调度服务器，用完之后要关闭连接
+func (wc grpcWorkerClient) dialWorker(node_ip string) (*grpc.ClientConn, pb.ScheduleServiceClient, error) {
+	creds, err := wc.transportCredentials(node_ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	// grpc通信服务器的地址
+	url := node_ip + ":" + workerSchedulePort
+	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("did not connect: %w", err)
+	}
+	return conn, pb.NewScheduleServiceClient(conn), nil
+}
+
+func (wc grpcWorkerClient) StartInstance(ctx context.Context, node_ip string, req *pb.StartInstanceRequest) (*pb.InstanceInfo, error) {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return c.StartInstance(ctx, req)
+}
+
+func (wc grpcWorkerClient) StopInstance(ctx context.Context, node_ip string, req *pb.StopInstanceRequest) error {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = c.StopInstance(ctx, req)
+	return err
+}
+
+func (wc grpcWorkerClient) ReserveRendezvousPort(ctx context.Context, node_ip string, instance_id string) (string, error) {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	resp, err := c.ReserveRendezvousPort(ctx, &pb.ReserveRendezvousPortRequest{InstanceId: instance_id})
+	if err != nil {
+		return "", err
+	}
+	return resp.GetPort(), nil
+}
+
+func (wc grpcWorkerClient) GetInstance(ctx context.Context, node_ip string, instance_id string) (*pb.InstanceInfo, error) {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return c.GetInstance(ctx, &pb.GetInstanceRequest{InstanceId: instance_id})
+}
+
+func (wc grpcWorkerClient) ListInstances(ctx context.Context, node_ip string, req *pb.ListInstancesRequest) ([]*pb.InstanceInfo, error) {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	resp, err := c.ListInstances(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Instances, nil
+}
+
+func (wc grpcWorkerClient) Infer(ctx context.Context, node_ip string, req *pb.InferRequest) (string, error) {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	resp, err := c.Infer(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+func (wc grpcWorkerClient) InferStream(ctx context.Context, node_ip string, req *pb.InferRequest, chunk func(*pb.GenerateChunk) error) error {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := c.InferStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		gc, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := chunk(gc); err != nil {
+			return err
+		}
+	}
+}
+
+func (wc grpcWorkerClient) StreamLogs(ctx context.Context, node_ip string, req *pb.LogsRequest, w io.Writer) error {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := c.StreamLogs(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (wc grpcWorkerClient) PullImage(ctx context.Context, node_ip string, req *pb.PullImageRequest, progress func(*pb.PullProgress)) error {
+	conn, c, err := wc.dialWorker(node_ip)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := c.PullImage(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		progress(p)
+	}
+}
+
+// SetWorkerClient 替换访问工作节点的客户端，需要在开始调度之前调用
+func (q *TaskWaitQueue) SetWorkerClient(c WorkerClient) {
+	q.workers = c
+}
+
+// 把任务的提示词发给实例，返回完整结果，流式任务生成的内容同时转发给客户端
+func (q *TaskWaitQueue) infer(task *Task, node_ip, instance_id string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), workerInferTimeout)
+	defer cancel()
+	req := &pb.InferRequest{InstanceId: instance_id, Prompt: task.OriginPrompt}
+	if task.stream != nil {
+		return q.relayGeneration(ctx, task, node_ip, req)
+	}
+	return q.workers.Infer(ctx, node_ip, req)
+}
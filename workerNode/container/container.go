@@ -2,144 +2,117 @@ package container
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount" // 挂载相关
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat" // 端口映射相关
 )
 
-// 创建推理实例，要加载的模型名称，通过环境变量传入
-func StartModelContainer(modelName string) (string, error) {
-	// 设置环境变量，以免docker 客户端与服务端api版本不一致报错
-	os.Setenv("DOCKER_API_VERSION", "1.43")
-	config, exists := modelConfigs[modelName]
+// StartOptions 启动容器时除模型配置之外的参数
+type StartOptions struct {
+	// 额外的环境变量，会覆盖模型配置中的同名变量
+	Env map[string]string
+	// 容器8000端口映射到的主机端口
+	HostPort string
+	// 组调度时分布式组使用的主机端口，为空表示不是组调度的成员
+	RendezvousPort string
+	// 组调度中的序号和成员数，单节点实例的成员数为0或1
+	Rank      int32
+	WorldSize int32
+	// 实例ID和触发启动的任务ID，用于生成容器名和标签
+	InstanceID string
+	TaskID     string
+	// 容器使用的GPU编号，为空时使用所有GPU；Exclusive只记录在标签上，由工作节点的GPU账本保证独占
+	GPUIDs    []string
+	Exclusive bool
+}
+
+// 创建推理实例，要加载的模型名称，通过环境变量传入，返回容器ID。
+// ctx 取消时停止创建，已经创建的容器会被删除
+func StartModelContainer(ctx context.Context, rt Runtime, modelName string, opts StartOptions) (string, error) {
+	config, exists := LookupModel(modelName)
 	if !exists {
 		return "", fmt.Errorf("model %s not supported", modelName)
 	}
 
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv)
-	if err != nil {
-		return "", err
-	}
-
 	// 准备环境变量
-	var envVars []string
-	for k, v := range config.EnvVars {
-		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
+	env := make(map[string]string, len(config.Env)+len(opts.Env))
+	for k, v := range config.Env {
+		env[k] = v
 	}
-
-	// 准备挂载卷
-	var mounts []mount.Mount
-	for src, dst := range config.VolumeMounts {
-		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: src,
-			Target: dst,
-		})
+	for k, v := range opts.Env {
+		env[k] = v
 	}
 
-	// TODO：获取系统中一个可用的端口号
-	host_port := "31122"
-
-	// 定义端口映射
-	portBindings := nat.PortMap{
-		"8000/tcp": []nat.PortBinding{
-			{
-				HostIP:   "0.0.0.0",
-				HostPort: host_port,
-			},
-		},
+	// 主机端口由工作节点的端口分配器分配
+	if opts.HostPort == "" {
+		return "", fmt.Errorf("host port is required")
+	}
+	if opts.InstanceID == "" {
+		return "", fmt.Errorf("instance id is required")
 	}
 
-	// TODO: 把容器名字设置成和任务ID相关
-	containerName := "tsif"
-	// 创建容器
-	resp, err := cli.ContainerCreate(ctx,
-		&container.Config{
-			Image: config.ImageName,
-			Cmd:   config.Command,
-			Env:   envVars,
-			// 容器暴露的端口
-			ExposedPorts: nat.PortSet{
-				"8000/tcp": struct{}{},
-			},
-		},
-		&container.HostConfig{
-			PortBindings: portBindings,
-			Mounts:       mounts,
-			Privileged:   true,
-			// Runtime:    "nvidia",
-			Resources: container.Resources{
-				DeviceRequests: []container.DeviceRequest{
-					{
-						Driver:       "nvidia",
-						Count:        -1,
-						Capabilities: [][]string{{"gpu", "nvidia", "compute", "utility"}},
-					},
-				},
-			},
-		},
-		nil, nil, containerName)
+	id, err := rt.Create(ctx, Spec{
+		Name:           ContainerName(opts.InstanceID),
+		Image:          config.Image,
+		Command:        config.Command,
+		Env:            env,
+		Mounts:         config.Mounts,
+		HostPort:       opts.HostPort,
+		RendezvousPort: opts.RendezvousPort,
+		GPUs:           opts.GPUIDs,
+		NoGPU:          config.GPUMemoryMB == 0,
+		Resources:      config.Resources,
+		// 标记容器属于light_scheduler，节点重启后据此接管或清理
+		Labels: ownerLabels(modelName, opts),
+	})
 	if err != nil {
 		return "", err
 	}
 
-	// 启动容器
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+	// 启动容器，启动失败时删除已经创建的容器，以免占用容器名
+	if err := rt.Start(ctx, id); err != nil {
+		// ctx 可能已经取消，删除容器不能依赖它
+		rt.Remove(context.WithoutCancel(ctx), id)
 		return "", err
 	}
 
-	return host_port, nil
+	return id, nil
 }
 
-func DeleteContainer(containerName string) error {
-	//  client.WithAPIVersionNegotiation()防止api版本不对齐而报错
-	// 创建Docker客户端
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// ContainerRunning 检查容器是否还在运行，容器不存在时返回false
+func ContainerRunning(rt Runtime, containerID string) (bool, error) {
+	state, err := rt.Inspect(context.Background(), containerID)
 	if err != nil {
-		log.Fatalf("无法创建docker客户端: %v", err)
-		return err
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
 	}
-	defer cli.Close()
+	return state.Running, nil
+}
 
-	// 获取所有容器
-	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
-		All: true, // 包括停止的容器
-	})
+// DeleteContainer 按名称删除容器，找不到容器时返回ErrNotFound
+func DeleteContainer(ctx context.Context, rt Runtime, containerName string) error {
+	// 获取所有容器，包括停止的容器
+	containers, err := rt.List(ctx, nil)
 	if err != nil {
-		log.Fatalf("Error listing containers: %v", err)
-		return err
+		return fmt.Errorf("error listing containers: %w", err)
 	}
 
 	// 查找指定名称的容器
 	var containerID string
-	for _, container := range containers {
-		for _, name := range container.Names {
-			if name == "/"+containerName {
-				containerID = container.ID
-				break
-			}
-		}
-		if containerID != "" {
+	for _, c := range containers {
+		if c.Name == containerName {
+			containerID = c.ID
 			break
 		}
 	}
 
 	if containerID == "" {
-		log.Fatalf("Container with name '%s' not found", containerName)
+		return fmt.Errorf("%w: %s", ErrNotFound, containerName)
 	}
 
-	// 删除容器 - 使用新的container.RemoveOptions
-	err = cli.ContainerRemove(context.Background(), containerID, container.RemoveOptions{
-		Force: true, // 强制删除运行中的容器
-	})
-	if err != nil {
-		log.Fatalf("Error removing container: %v", err)
+	if err := rt.Remove(ctx, containerID); err != nil {
+		return fmt.Errorf("error removing container: %w", err)
 	}
 
 	fmt.Printf("成功删除容器: %s\n", containerName)
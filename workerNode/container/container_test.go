@@ -0,0 +1,66 @@
+package container
+
+import (
+	"catalog"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStartModelContainerAppliesResources(t *testing.T) {
+	rt := NewFakeRuntime()
+	if _, err := StartModelContainer(context.Background(), rt, "llama3-8b", StartOptions{HostPort: "31000", InstanceID: "inst-1"}); err != nil {
+		t.Fatal(err)
+	}
+	specs := rt.Specs()
+	if len(specs) != 1 {
+		t.Fatalf("创建了 %d 个容器", len(specs))
+	}
+	got := specs[0].Resources
+	if got.ShmSizeMB != 8*1024 || got.MemoryMB != 32*1024 || got.Privileged {
+		t.Errorf("容器的资源配置 %+v 和模型配置不一致", got)
+	}
+}
+
+func TestDeleteContainerUsesRuntime(t *testing.T) {
+	rt := NewFakeRuntime()
+	if _, err := StartModelContainer(context.Background(), rt, "llama3-8b", StartOptions{HostPort: "31000", InstanceID: "inst-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteContainer(context.Background(), rt, ContainerName("inst-1")); err != nil {
+		t.Fatal(err)
+	}
+	if specs := rt.Specs(); len(specs) != 0 {
+		t.Fatalf("容器没有删除: %v", specs)
+	}
+	if err := DeleteContainer(context.Background(), rt, ContainerName("inst-1")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("删除不存在的容器返回 %v，期望 ErrNotFound", err)
+	}
+}
+
+func TestCPUOnlyModelGetsNoGPU(t *testing.T) {
+	c := &catalog.Catalog{Models: map[string]catalog.Model{
+		"cpu-only": {Image: "cpu:v1"},
+		"gpu":      {Image: "gpu:v1", GPUMemoryMB: 1024},
+	}}
+	SetModels(c)
+	t.Cleanup(func() { SetModels(catalog.Default()) })
+
+	rt := NewFakeRuntime()
+	for _, name := range []string{"cpu-only", "gpu"} {
+		if _, err := StartModelContainer(context.Background(), rt, name, StartOptions{HostPort: "31000", InstanceID: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	specs := rt.Specs()
+	if !specs[0].NoGPU || len(gpuRequests(specs[0])) != 0 {
+		t.Errorf("只使用CPU的模型不应该请求GPU: %+v", gpuRequests(specs[0]))
+	}
+	if specs[1].NoGPU || len(gpuRequests(specs[1])) != 1 || gpuRequests(specs[1])[0].Count != -1 {
+		t.Errorf("没有指定GPU的模型应该可以使用所有GPU: %+v", gpuRequests(specs[1]))
+	}
+	pinned := Spec{GPUs: []string{"1"}}
+	if r := gpuRequests(pinned); len(r) != 1 || len(r[0].DeviceIDs) != 1 || r[0].DeviceIDs[0] != "1" {
+		t.Errorf("指定的GPU没有传给Docker: %+v", r)
+	}
+}
@@ -0,0 +1,310 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount" // 挂载相关
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat" // 端口映射相关
+)
+
+// DockerRuntime 用Docker运行模型容器，容器使用NVIDIA运行时访问GPU
+type DockerRuntime struct {
+	cli *client.Client
+}
+
+// NewDockerRuntime 创建Docker运行时，client.WithAPIVersionNegotiation()防止api版本不对齐而报错
+func NewDockerRuntime() (*DockerRuntime, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("无法创建docker客户端: %w", err)
+	}
+	return &DockerRuntime{cli: cli}, nil
+}
+
+func (d *DockerRuntime) Name() string { return RuntimeDocker }
+
+func (d *DockerRuntime) Create(ctx context.Context, spec Spec) (string, error) {
+	// 准备环境变量
+	var envVars []string
+	for k, v := range spec.Env {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// 准备挂载卷
+	var mounts []mount.Mount
+	for src, dst := range spec.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: src,
+			Target: dst,
+		})
+	}
+
+	// 定义端口映射
+	containerPort := nat.Port(ContainerPort + "/tcp")
+	portBindings := nat.PortMap{
+		containerPort: []nat.PortBinding{
+			{
+				HostIP:   "0.0.0.0",
+				HostPort: spec.HostPort,
+			},
+		},
+	}
+	exposedPorts := nat.PortSet{
+		containerPort: struct{}{},
+	}
+	// 分布式组的端口在主机和容器内使用同一个端口号，MASTER_PORT 在两边都有效
+	if spec.RendezvousPort != "" {
+		rendezvousPort := nat.Port(spec.RendezvousPort + "/tcp")
+		portBindings[rendezvousPort] = []nat.PortBinding{
+			{
+				HostIP:   "0.0.0.0",
+				HostPort: spec.RendezvousPort,
+			},
+		}
+		exposedPorts[rendezvousPort] = struct{}{}
+	}
+
+	res := spec.Resources
+	var ulimits []*container.Ulimit
+	for _, u := range res.Ulimits {
+		ulimits = append(ulimits, &container.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	restartPolicy := container.RestartPolicy{
+		Name:              container.RestartPolicyMode(res.RestartPolicy),
+		MaximumRetryCount: res.MaxRetries,
+	}
+	if restartPolicy.Name == "" {
+		restartPolicy.Name = container.RestartPolicyDisabled
+	}
+
+	// 创建容器
+	resp, err := d.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:  spec.Image,
+			Cmd:    spec.Command,
+			Env:    envVars,
+			Labels: spec.Labels,
+			// 容器暴露的端口
+			ExposedPorts: exposedPorts,
+		},
+		&container.HostConfig{
+			PortBindings:  portBindings,
+			Mounts:        mounts,
+			Privileged:    res.Privileged,
+			IpcMode:       container.IpcMode(res.IPCMode),
+			ShmSize:       int64(res.ShmSizeMB) << 20,
+			RestartPolicy: restartPolicy,
+			// Runtime:    "nvidia",
+			Resources: container.Resources{
+				DeviceRequests: gpuRequests(spec),
+				NanoCPUs:       int64(res.CPUs * 1e9),
+				Memory:         int64(res.MemoryMB) << 20,
+				Ulimits:        ulimits,
+			},
+		},
+		nil, nil, spec.Name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// 容器的GPU请求：指定了GPU时只把这些GPU暴露给容器，否则暴露所有GPU。
+// 只使用CPU的模型不请求GPU，没有NVIDIA运行时的主机也能启动
+func gpuRequests(spec Spec) []container.DeviceRequest {
+	if spec.NoGPU {
+		return nil
+	}
+	gpuRequest := container.DeviceRequest{
+		Driver:       "nvidia",
+		Capabilities: [][]string{{"gpu", "nvidia", "compute", "utility"}},
+	}
+	if len(spec.GPUs) > 0 {
+		gpuRequest.DeviceIDs = spec.GPUs
+	} else {
+		gpuRequest.Count = -1
+	}
+	return []container.DeviceRequest{gpuRequest}
+}
+
+// GPUs 通过NVML查询主机上的GPU，容器使用NVIDIA运行时访问它们
+func (d *DockerRuntime) GPUs(ctx context.Context) (map[string]GPU, error) {
+	return nvmlGPUs()
+}
+
+func (d *DockerRuntime) Start(ctx context.Context, id string) error {
+	return wrapNotFound(d.cli.ContainerStart(ctx, id, container.StartOptions{}))
+}
+
+func (d *DockerRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+	return wrapNotFound(d.cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &seconds}))
+}
+
+func (d *DockerRuntime) Remove(ctx context.Context, id string) error {
+	err := d.cli.ContainerRemove(ctx, id, container.RemoveOptions{
+		Force: true, // 强制删除运行中的容器
+	})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *DockerRuntime) Inspect(ctx context.Context, id string) (State, error) {
+	info, err := d.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return State{}, wrapNotFound(err)
+	}
+
+	state := State{
+		ID:   info.ID,
+		Name: strings.TrimPrefix(info.Name, "/"),
+	}
+	if info.Config != nil {
+		state.Labels = info.Config.Labels
+	}
+	if info.State != nil {
+		state.Running = info.State.Running
+		state.ExitCode = info.State.ExitCode
+		state.StartedAt, _ = time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		state.FinishedAt, _ = time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+	}
+	return state, nil
+}
+
+func (d *DockerRuntime) List(ctx context.Context, labels map[string]string) ([]State, error) {
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", k+"="+v)
+	}
+	containers, err := d.cli.ContainerList(ctx, container.ListOptions{
+		All:     true, // 包括停止的容器
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(containers))
+	for _, c := range containers {
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		states = append(states, State{
+			ID:      c.ID,
+			Name:    name,
+			Labels:  c.Labels,
+			Running: c.State == "running",
+		})
+	}
+	return states, nil
+}
+
+func (d *DockerRuntime) Logs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	tail := "all"
+	if opts.Tail > 0 {
+		tail = strconv.Itoa(opts.Tail)
+	}
+	logs, err := d.cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		return nil, wrapNotFound(err)
+	}
+
+	// 没有分配终端的容器，标准输出和标准错误是复用在一个流里的，需要拆开
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, logs)
+		logs.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func (d *DockerRuntime) Images(ctx context.Context) ([]string, error) {
+	summaries, err := d.cli.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, summary := range summaries {
+		for _, tag := range summary.RepoTags {
+			if tag != "<none>:<none>" {
+				images = append(images, tag)
+			}
+		}
+	}
+	return images, nil
+}
+
+// Docker拉取镜像时返回的进度消息
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+func (d *DockerRuntime) PullImage(ctx context.Context, ref string, progress func(PullProgress)) error {
+	stream, err := d.cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// 拉取过程中每一行都是一条JSON格式的进度消息，拉取失败也是通过消息返回的
+	decoder := json.NewDecoder(stream)
+	for {
+		var msg pullMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.ErrorDetail != nil {
+			return fmt.Errorf("pull %s: %s", ref, msg.ErrorDetail.Message)
+		}
+		if progress != nil {
+			progress(PullProgress{
+				Layer:   msg.ID,
+				Status:  msg.Status,
+				Current: msg.ProgressDetail.Current,
+				Total:   msg.ProgressDetail.Total,
+			})
+		}
+	}
+}
+
+// 把Docker的找不到容器错误转换成ErrNotFound
+func wrapNotFound(err error) error {
+	if err != nil && errdefs.IsNotFound(err) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
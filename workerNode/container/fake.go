@@ -0,0 +1,228 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeRuntime 内存中的假运行时，不会真的启动任何进程，用于在没有Docker和GPU的机器上测试工作节点
+type FakeRuntime struct {
+	mu         sync.Mutex
+	next       int
+	containers map[string]*fakeContainer
+	images     map[string]bool
+	gpus       map[string]GPU
+
+	// 不为nil时Create或Start返回该错误，用于模拟启动失败
+	CreateErr error
+	StartErr  error
+}
+
+type fakeContainer struct {
+	seq   int
+	spec  Spec
+	state State
+	logs  bytes.Buffer
+}
+
+// NewFakeRuntime 创建假运行时
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		containers: make(map[string]*fakeContainer),
+		images:     make(map[string]bool),
+	}
+}
+
+func (f *FakeRuntime) Name() string { return RuntimeFake }
+
+func (f *FakeRuntime) Create(ctx context.Context, spec Spec) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.CreateErr != nil {
+		return "", f.CreateErr
+	}
+	for _, c := range f.containers {
+		if spec.Name != "" && c.spec.Name == spec.Name {
+			return "", fmt.Errorf("container name %s already in use", spec.Name)
+		}
+	}
+	f.next++
+	id := fmt.Sprintf("fake-%d", f.next)
+	f.containers[id] = &fakeContainer{
+		seq:  f.next,
+		spec: spec,
+		state: State{
+			ID:     id,
+			Name:   spec.Name,
+			Labels: copyLabels(spec.Labels),
+		},
+	}
+	return id, nil
+}
+
+func (f *FakeRuntime) Start(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.StartErr != nil {
+		return f.StartErr
+	}
+	c, exists := f.containers[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	c.state.Running = true
+	c.state.StartedAt = time.Now()
+	return nil
+}
+
+func (f *FakeRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return f.Exit(id, 0)
+}
+
+func (f *FakeRuntime) Remove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.containers, id)
+	return nil
+}
+
+func (f *FakeRuntime) Inspect(ctx context.Context, id string) (State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, exists := f.containers[id]
+	if !exists {
+		return State{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	state := c.state
+	state.Labels = copyLabels(c.state.Labels)
+	return state, nil
+}
+
+func (f *FakeRuntime) List(ctx context.Context, labels map[string]string) ([]State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var states []State
+	for _, c := range f.ordered() {
+		if matchLabels(c.state.Labels, labels) {
+			state := c.state
+			state.Labels = copyLabels(c.state.Labels)
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+// Logs 返回目前写入的日志，假运行时不支持持续输出
+func (f *FakeRuntime) Logs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, exists := f.containers[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	logs := bytes.Clone(c.logs.Bytes())
+	offset, _ := TailOffset(bytes.NewReader(logs), int64(len(logs)), opts.Tail)
+	return io.NopCloser(bytes.NewReader(logs[offset:])), nil
+}
+
+func (f *FakeRuntime) Images(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	images := make([]string, 0, len(f.images))
+	for image := range f.images {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// PullImage 模拟拉取一个只有一层的镜像
+// SetGPUs 设置GPUs返回的GPU
+func (f *FakeRuntime) SetGPUs(gpus map[string]GPU) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gpus = gpus
+}
+
+// GPUs 返回SetGPUs设置的GPU，没有设置时节点上没有GPU
+func (f *FakeRuntime) GPUs(ctx context.Context) (map[string]GPU, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	gpus := make(map[string]GPU, len(f.gpus))
+	for id, gpu := range f.gpus {
+		gpus[id] = gpu
+	}
+	return gpus, nil
+}
+
+func (f *FakeRuntime) PullImage(ctx context.Context, image string, progress func(PullProgress)) error {
+	if progress != nil {
+		progress(PullProgress{Layer: "layer-1", Status: "Downloading", Current: 50, Total: 100})
+		progress(PullProgress{Layer: "layer-1", Status: "Pull complete", Current: 100, Total: 100})
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[image] = true
+	return nil
+}
+
+// Exit 模拟容器退出
+func (f *FakeRuntime) Exit(id string, code int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, exists := f.containers[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if c.state.Running {
+		c.state.Running = false
+		c.state.ExitCode = code
+		c.state.FinishedAt = time.Now()
+	}
+	return nil
+}
+
+// WriteLog 模拟容器输出日志
+func (f *FakeRuntime) WriteLog(id, line string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, exists := f.containers[id]; exists {
+		c.logs.WriteString(line)
+	}
+}
+
+// Specs 按创建顺序返回所有现存容器的规格
+func (f *FakeRuntime) Specs() []Spec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var specs []Spec
+	for _, c := range f.ordered() {
+		specs = append(specs, c.spec)
+	}
+	return specs
+}
+
+// 按创建顺序排列的容器，调用方需要持有锁
+func (f *FakeRuntime) ordered() []*fakeContainer {
+	containers := make([]*fakeContainer, 0, len(f.containers))
+	for _, c := range f.containers {
+		containers = append(containers, c)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].seq < containers[j].seq
+	})
+	return containers
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// GPU 节点上的一张GPU
+type GPU struct {
+	UUID          string
+	Model         string // 显卡型号
+	TotalMemoryMB uint64
+	FreeMemoryMB  uint64
+}
+
+// 通过NVML查询本节点上的GPU，key是GPU编号
+func nvmlGPUs() (map[string]GPU, error) {
+	// 1. 初始化 NVML
+	ret := nvml.Init()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("NVML init failed: %s", nvml.ErrorString(ret))
+	}
+	defer nvml.Shutdown()
+
+	// 2. 获取 GPU 数量
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device count: %s", nvml.ErrorString(ret))
+	}
+
+	gpus := make(map[string]GPU)
+	for i := 0; i < count; i++ {
+		// 3. 获取 GPU 句柄
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue // 跳过错误设备
+		}
+
+		// 4. 获取 GPU 名称和UUID
+		name, ret := device.GetName()
+		if ret != nvml.SUCCESS {
+			name = "unknown"
+		}
+		uuid, _ := device.GetUUID()
+
+		// 5. 获取显存信息
+		memInfo, ret := device.GetMemoryInfo()
+		if ret != nvml.SUCCESS {
+			continue // 跳过无法读取显存的设备
+		}
+
+		gpus[fmt.Sprint(i)] = GPU{
+			UUID:          uuid,
+			Model:         name,
+			TotalMemoryMB: memInfo.Total / 1024 / 1024, // 转换为 MB
+			FreeMemoryMB:  memInfo.Free / 1024 / 1024,
+		}
+	}
+	return gpus, nil
+}
+
+// GPUIndex 把GPU的UUID转换成编号，已经是编号或者找不到时原样返回
+func GPUIndex(gpus map[string]GPU, gpuID string) string {
+	if _, exists := gpus[gpuID]; exists {
+		return gpuID
+	}
+	for index, gpu := range gpus {
+		if gpu.UUID != "" && gpu.UUID == gpuID {
+			return index
+		}
+	}
+	return gpuID
+}
@@ -0,0 +1,101 @@
+package container
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 工作节点启动的容器都带有这些标签，重启后用它们找回自己的容器
+const (
+	LabelOwner          = "light_scheduler.owner"
+	LabelModel          = "light_scheduler.model"
+	LabelInstance       = "light_scheduler.instance"
+	LabelTask           = "light_scheduler.task"
+	LabelHostPort       = "light_scheduler.host_port"
+	LabelRendezvousPort = "light_scheduler.rendezvous_port"
+	LabelRank           = "light_scheduler.rank"
+	LabelWorldSize      = "light_scheduler.world_size"
+	LabelGPUs           = "light_scheduler.gpus"
+	LabelExclusive      = "light_scheduler.exclusive"
+
+	// LabelOwner 的取值
+	OwnerValue = "light_scheduler"
+)
+
+// 容器名中不允许出现的字符
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// ContainerName 根据实例ID生成容器名，同一节点上的实例ID不重复，容器名也就不会冲突
+func ContainerName(instanceID string) string {
+	return "ls-" + invalidNameChars.ReplaceAllString(instanceID, "-")
+}
+
+// 启动容器时打上的标签
+func ownerLabels(modelName string, opts StartOptions) map[string]string {
+	return map[string]string{
+		LabelOwner:          OwnerValue,
+		LabelModel:          modelName,
+		LabelInstance:       opts.InstanceID,
+		LabelTask:           opts.TaskID,
+		LabelHostPort:       opts.HostPort,
+		LabelRendezvousPort: opts.RendezvousPort,
+		LabelRank:           strconv.Itoa(int(opts.Rank)),
+		LabelWorldSize:      strconv.Itoa(int(opts.WorldSize)),
+		LabelGPUs:           strings.Join(opts.GPUIDs, ","),
+		LabelExclusive:      strconv.FormatBool(opts.Exclusive),
+	}
+}
+
+// ManagedContainer 带有light_scheduler标签的容器
+type ManagedContainer struct {
+	ID         string
+	Name       string
+	ModelName  string
+	InstanceID string
+	TaskID     string
+	HostPort   string
+	// 组调度成员的分布式组端口，不是组调度的成员时为空
+	RendezvousPort string
+	// 组调度中的序号和成员数，旧版本启动的容器没有这两个标签，按单节点实例处理
+	Rank      int32
+	WorldSize int32
+	GPUIDs    []string
+	Exclusive bool
+	Running   bool
+}
+
+// ListManagedContainers 列出运行时中所有由light_scheduler启动的容器，包括已经停止的
+func ListManagedContainers(rt Runtime) ([]ManagedContainer, error) {
+	states, err := rt.List(context.Background(), map[string]string{LabelOwner: OwnerValue})
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make([]ManagedContainer, 0, len(states))
+	for _, c := range states {
+		var gpus []string
+		if c.Labels[LabelGPUs] != "" {
+			gpus = strings.Split(c.Labels[LabelGPUs], ",")
+		}
+		exclusive, _ := strconv.ParseBool(c.Labels[LabelExclusive])
+		rank, _ := strconv.Atoi(c.Labels[LabelRank])
+		world_size, _ := strconv.Atoi(c.Labels[LabelWorldSize])
+		managed = append(managed, ManagedContainer{
+			ID:             c.ID,
+			Name:           c.Name,
+			ModelName:      c.Labels[LabelModel],
+			InstanceID:     c.Labels[LabelInstance],
+			TaskID:         c.Labels[LabelTask],
+			HostPort:       c.Labels[LabelHostPort],
+			RendezvousPort: c.Labels[LabelRendezvousPort],
+			Rank:           int32(rank),
+			WorldSize:      int32(world_size),
+			GPUIDs:         gpus,
+			Exclusive:      exclusive,
+			Running:        c.Running,
+		})
+	}
+	return managed, nil
+}
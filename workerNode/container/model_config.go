@@ -1,24 +1,44 @@
 package container
 
-type ModelConfig struct {
-	ImageName    string
-	ModelPath    string
-	PortMapping  string
-	EnvVars      map[string]string
-	VolumeMounts map[string]string
-	Command      []string
+import (
+	"sync"
+	"time"
+
+	"catalog"
+)
+
+// ModelConfig 模型的定义，来自master和工作节点共用的模型目录
+type ModelConfig = catalog.Model
+
+// 当前使用的模型目录，SetModels 会在目录文件变化时替换它
+var (
+	modelsMu     sync.RWMutex
+	modelConfigs = catalog.Default().Models
+)
+
+// SetModels 替换模型目录，已经在运行的实例不受影响
+func SetModels(c *catalog.Catalog) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	modelConfigs = c.Models
+}
+
+// LookupModel 查询模型配置
+func LookupModel(modelName string) (ModelConfig, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	config, exists := modelConfigs[modelName]
+	return config, exists
+}
+
+// IdleTimeout 模型实例的空闲超时时间，0表示不卸载
+func IdleTimeout(modelName string) time.Duration {
+	config, _ := LookupModel(modelName)
+	return config.IdleTimeout()
 }
 
-var modelConfigs = map[string]ModelConfig{
-	"llama3-8b": {
-		ImageName:    "model:v1",
-		ModelPath:    "/models/Meta-Llama-3-8B",
-		PortMapping:  "8000:8000",
-		EnvVars:      map[string]string{"MODEL_NAME": "/models/Meta-Llama-3-8B"},
-		VolumeMounts: map[string]string{"/root/Models": "/models"},
-		Command:      []string{"python", "/app/server.py"},
-	},
-	"gpt-neo-2.7b": {
-		// 其他模型配置
-	},
+// ReadyTimeout 等待模型服务就绪的最长时间
+func ReadyTimeout(modelName string) time.Duration {
+	config, _ := LookupModel(modelName)
+	return config.ReadyTimeout()
 }
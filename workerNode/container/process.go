@@ -0,0 +1,438 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"catalog"
+)
+
+// ProcessRuntime 把模型服务作为工作节点的子进程运行，适用于没有Docker的机器。
+// 进程直接使用主机环境，Spec中的Image和Mounts会被忽略，监听端口通过环境变量PORT传入，
+// 指定的GPU通过CUDA_VISIBLE_DEVICES传入，标准输出和标准错误写入logDir下的日志文件。
+// 进程按Resources中的重启策略在退出后重新启动，Ulimits和MemoryMB通过rlimit限制（只支持Linux），
+// 没有cgroup，CPUs、ShmSizeMB、IPCMode和Privileged不起作用。
+// 子进程在工作节点退出时会被结束：正常退出时由Close停止，工作节点崩溃时由内核发送SIGKILL（Linux）
+type ProcessRuntime struct {
+	mu     sync.Mutex
+	logDir string
+	next   uint64
+	procs  map[string]*process
+	// 进程退出后等待多久再重新启动
+	restartDelay time.Duration
+}
+
+// 一个受管理的子进程
+type process struct {
+	spec    Spec
+	state   State
+	logPath string
+	// 当前运行的进程，重新启动后换成新的进程
+	cmd *exec.Cmd
+	// 已经重新启动的次数
+	restarts int
+	// Stop 被调用后关闭，之后不再重新启动
+	stopping bool
+	stop     chan struct{}
+	// 进程退出并且不再重新启动后关闭
+	done chan struct{}
+}
+
+// 默认的重启间隔
+const processRestartDelay = time.Second
+
+// NewProcessRuntime 创建本地进程运行时，logDir为空时使用系统临时目录
+func NewProcessRuntime(logDir string) *ProcessRuntime {
+	if logDir == "" {
+		logDir = filepath.Join(os.TempDir(), "light_scheduler-logs")
+	}
+	return &ProcessRuntime{
+		logDir:       logDir,
+		procs:        make(map[string]*process),
+		restartDelay: processRestartDelay,
+	}
+}
+
+func (p *ProcessRuntime) Name() string { return RuntimeProcess }
+
+func (p *ProcessRuntime) Create(ctx context.Context, spec Spec) (string, error) {
+	if len(spec.Command) == 0 {
+		return "", errors.New("process runtime requires a command")
+	}
+	if err := os.MkdirAll(p.logDir, 0o755); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, proc := range p.procs {
+		if spec.Name != "" && proc.spec.Name == spec.Name {
+			return "", fmt.Errorf("container name %s already in use", spec.Name)
+		}
+	}
+
+	if ignored := unsupportedResources(spec.Resources); len(ignored) > 0 {
+		log.Printf("进程运行时不支持 %s，进程 %s 不受这些限制", strings.Join(ignored, "、"), spec.Name)
+	}
+
+	p.next++
+	id := fmt.Sprintf("proc-%d", p.next)
+	// 先创建空的日志文件，进程启动前也能读取日志
+	logPath := filepath.Join(p.logDir, id+".log")
+	if err := os.WriteFile(logPath, nil, 0o644); err != nil {
+		return "", err
+	}
+	p.procs[id] = &process{
+		spec: spec,
+		state: State{
+			ID:     id,
+			Name:   spec.Name,
+			Labels: copyLabels(spec.Labels),
+		},
+		logPath: logPath,
+	}
+	return id, nil
+}
+
+func (p *ProcessRuntime) Start(ctx context.Context, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, exists := p.procs[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if proc.state.Running {
+		return nil
+	}
+
+	cmd, err := spawn(proc.spec, proc.logPath)
+	if err != nil {
+		return err
+	}
+	proc.cmd = cmd
+	proc.restarts = 0
+	proc.stopping = false
+	proc.stop = make(chan struct{})
+	proc.done = make(chan struct{})
+	proc.state.Running = true
+	proc.state.ExitCode = 0
+	proc.state.StartedAt = time.Now()
+	proc.state.FinishedAt = time.Time{}
+
+	go p.supervise(proc, cmd)
+	return nil
+}
+
+// 按规格启动一个子进程，标准输出和标准错误追加到日志文件
+func spawn(spec Spec, logPath string) (*exec.Cmd, error) {
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// 子进程持有自己的文件描述符，启动后就可以关闭
+	defer logFile.Close()
+
+	cmd := exec.Command(spec.Command[0], spec.Command[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if spec.HostPort != "" {
+		cmd.Env = append(cmd.Env, "PORT="+spec.HostPort)
+	}
+	switch {
+	case spec.NoGPU:
+		// 只使用CPU的模型看不到任何GPU
+		cmd.Env = append(cmd.Env, "CUDA_VISIBLE_DEVICES=")
+	case len(spec.GPUs) > 0:
+		cmd.Env = append(cmd.Env, "CUDA_VISIBLE_DEVICES="+strings.Join(spec.GPUs, ","))
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = childProcAttr()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if err := applyLimits(cmd.Process.Pid, spec.Resources); err != nil {
+		signalGroup(cmd, syscall.SIGKILL)
+		cmd.Wait()
+		return nil, fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	return cmd, nil
+}
+
+// 等待进程退出，按重启策略重新启动，直到被停止或者不再重启
+func (p *ProcessRuntime) supervise(proc *process, cmd *exec.Cmd) {
+	defer close(proc.done)
+	for {
+		cmd.Wait()
+		exitCode := cmd.ProcessState.ExitCode()
+
+		p.mu.Lock()
+		proc.state.ExitCode = exitCode
+		if proc.stopping || !shouldRestart(proc.spec.Resources, exitCode, proc.restarts) {
+			proc.state.Running = false
+			proc.state.FinishedAt = time.Now()
+			p.mu.Unlock()
+			return
+		}
+		proc.restarts++
+		log.Printf("进程 %s 退出（退出码 %d），%v 后第 %d 次重启", proc.spec.Name, exitCode, p.restartDelay, proc.restarts)
+		p.mu.Unlock()
+
+		select {
+		case <-proc.stop:
+		case <-time.After(p.restartDelay):
+		}
+
+		p.mu.Lock()
+		var err error
+		if !proc.stopping {
+			cmd, err = spawn(proc.spec, proc.logPath)
+			if err != nil {
+				log.Printf("重启进程 %s 失败: %v", proc.spec.Name, err)
+			}
+		}
+		if proc.stopping || err != nil {
+			proc.state.Running = false
+			proc.state.FinishedAt = time.Now()
+			p.mu.Unlock()
+			return
+		}
+		proc.cmd = cmd
+		proc.state.StartedAt = time.Now()
+		p.mu.Unlock()
+	}
+}
+
+// 按重启策略判断退出的进程是否需要重新启动，和Docker的重启策略含义相同
+func shouldRestart(res catalog.Resources, exitCode, restarts int) bool {
+	switch res.RestartPolicy {
+	case catalog.RestartAlways, catalog.RestartUnlessStopped:
+		return true
+	case catalog.RestartOnFailure:
+		return exitCode != 0 && (res.MaxRetries == 0 || restarts < res.MaxRetries)
+	}
+	return false
+}
+
+// 进程运行时做不到的资源限制
+func unsupportedResources(res catalog.Resources) []string {
+	var ignored []string
+	if res.CPUs > 0 {
+		ignored = append(ignored, "cpus")
+	}
+	if res.ShmSizeMB > 0 {
+		ignored = append(ignored, "shm_size_mb")
+	}
+	if res.IPCMode != "" {
+		ignored = append(ignored, "ipc_mode")
+	}
+	if res.Privileged {
+		ignored = append(ignored, "privileged")
+	}
+	return ignored
+}
+
+func (p *ProcessRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	p.mu.Lock()
+	proc, exists := p.procs[id]
+	if !exists {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if !proc.state.Running {
+		p.mu.Unlock()
+		return nil
+	}
+	// 标记为停止之后不会再启动新的进程，proc.cmd 就是最后一个进程
+	if !proc.stopping {
+		proc.stopping = true
+		close(proc.stop)
+	}
+	cmd, done := proc.cmd, proc.done
+	p.mu.Unlock()
+
+	// 先让进程自己退出，超时后强制结束。进程的子进程在同一个进程组里，一起结束
+	signalGroup(cmd, syscall.SIGTERM)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	signalGroup(cmd, syscall.SIGKILL)
+	<-done
+	return nil
+}
+
+// 工作节点退出时等待子进程自己退出的时间
+const processCloseTimeout = 10 * time.Second
+
+// Close 停止所有子进程。子进程不能在工作节点重启后被接管，工作节点退出时要一起结束
+func (p *ProcessRuntime) Close() error {
+	p.mu.Lock()
+	ids := make([]string, 0, len(p.procs))
+	for id := range p.procs {
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			p.Stop(context.Background(), id, processCloseTimeout)
+		}(id)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (p *ProcessRuntime) Remove(ctx context.Context, id string) error {
+	if err := p.Stop(ctx, id, 0); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	p.mu.Lock()
+	proc, exists := p.procs[id]
+	delete(p.procs, id)
+	p.mu.Unlock()
+	if exists {
+		os.Remove(proc.logPath)
+	}
+	return nil
+}
+
+func (p *ProcessRuntime) Inspect(ctx context.Context, id string) (State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, exists := p.procs[id]
+	if !exists {
+		return State{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	state := proc.state
+	state.Labels = copyLabels(proc.state.Labels)
+	return state, nil
+}
+
+func (p *ProcessRuntime) List(ctx context.Context, labels map[string]string) ([]State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var states []State
+	for _, proc := range p.procs {
+		if matchLabels(proc.state.Labels, labels) {
+			state := proc.state
+			state.Labels = copyLabels(proc.state.Labels)
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func (p *ProcessRuntime) Logs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	p.mu.Lock()
+	proc, exists := p.procs[id]
+	var done chan struct{}
+	if exists {
+		done = proc.done
+	}
+	p.mu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	f, err := os.Open(proc.logPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Tail > 0 {
+		info, err := f.Stat()
+		if err == nil {
+			var offset int64
+			offset, err = TailOffset(f, info.Size(), opts.Tail)
+			if err == nil {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if !opts.Follow || done == nil {
+		return f, nil
+	}
+	return &followReader{ctx: ctx, f: f, done: done}, nil
+}
+
+// Images 本地进程不使用镜像
+func (p *ProcessRuntime) Images(ctx context.Context) ([]string, error) {
+	return nil, ErrNoImageStore
+}
+
+// GPUs 通过NVML查询主机上的GPU。没有NVIDIA驱动的机器（比如只有CPU的机器）上返回空，
+// 模型服务只使用CPU
+func (p *ProcessRuntime) GPUs(ctx context.Context) (map[string]GPU, error) {
+	gpus, err := nvmlGPUs()
+	if err != nil {
+		return map[string]GPU{}, nil
+	}
+	return gpus, nil
+}
+
+// PullImage 本地进程不使用镜像
+func (p *ProcessRuntime) PullImage(ctx context.Context, image string, progress func(PullProgress)) error {
+	return ErrNoImageStore
+}
+
+// 日志文件读到末尾时等待进程继续写入，进程退出并且读完之后返回io.EOF
+type followReader struct {
+	ctx  context.Context
+	f    *os.File
+	done chan struct{}
+}
+
+// 读到文件末尾后再次尝试读取的间隔
+const followPollInterval = 200 * time.Millisecond
+
+func (r *followReader) Read(buf []byte) (int, error) {
+	for {
+		n, err := r.f.Read(buf)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		select {
+		case <-r.done:
+			// 进程已经退出，把剩下的内容读完
+			return r.f.Read(buf)
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,76 @@
+package container
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"catalog"
+
+	"golang.org/x/sys/unix"
+)
+
+// 子进程放在自己的进程组里，停止时连同它启动的进程一起结束；
+// 工作节点意外退出时由内核给子进程发送SIGKILL，不会留下没有人管理的模型服务
+func childProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// 给进程所在的进程组发送信号
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+		cmd.Process.Signal(sig)
+	}
+}
+
+// Docker ulimit名称对应的rlimit
+var rlimitResources = map[string]int{
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+// -1 表示不限制
+func rlimitValue(v int64) uint64 {
+	if v < 0 {
+		return unix.RLIM_INFINITY
+	}
+	return uint64(v)
+}
+
+// 用rlimit限制子进程的资源。没有cgroup，MemoryMB 用数据段上限（RLIMIT_DATA）近似，
+// 不限制地址空间，CUDA会预留远大于实际使用量的虚拟地址
+func applyLimits(pid int, res catalog.Resources) error {
+	for _, u := range res.Ulimits {
+		resource, ok := rlimitResources[u.Name]
+		if !ok {
+			return fmt.Errorf("unknown ulimit %q", u.Name)
+		}
+		limit := unix.Rlimit{Cur: rlimitValue(u.Soft), Max: rlimitValue(u.Hard)}
+		if err := unix.Prlimit(pid, resource, &limit, nil); err != nil {
+			return fmt.Errorf("ulimit %s: %w", u.Name, err)
+		}
+	}
+	if res.MemoryMB > 0 {
+		limit := unix.Rlimit{Cur: res.MemoryMB << 20, Max: res.MemoryMB << 20}
+		if err := unix.Prlimit(pid, unix.RLIMIT_DATA, &limit, nil); err != nil {
+			return fmt.Errorf("memory limit: %w", err)
+		}
+	}
+	return nil
+}
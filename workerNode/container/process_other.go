@@ -0,0 +1,24 @@
+//go:build !linux
+
+package container
+
+import (
+	"os/exec"
+	"syscall"
+
+	"catalog"
+)
+
+// 其他系统上子进程和工作节点使用同一个进程组，工作节点意外退出时子进程不会被结束
+func childProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	cmd.Process.Signal(sig)
+}
+
+// 其他系统不支持rlimit，资源限制不起作用
+func applyLimits(pid int, res catalog.Resources) error {
+	return nil
+}
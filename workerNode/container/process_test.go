@@ -0,0 +1,127 @@
+package container
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"catalog"
+)
+
+func TestProcessRuntimeLifecycle(t *testing.T) {
+	rt := NewProcessRuntime(t.TempDir())
+	ctx := context.Background()
+
+	id, err := rt.Create(ctx, Spec{
+		Name:     "echo",
+		Command:  []string{"sh", "-c", "echo listening on $PORT; exec sleep 30"},
+		HostPort: "31000",
+		Labels:   map[string]string{LabelOwner: OwnerValue},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Start(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := rt.Inspect(ctx, id); !state.Running {
+		t.Fatal("进程应该在运行")
+	}
+	if states, _ := rt.List(ctx, map[string]string{LabelOwner: OwnerValue}); len(states) != 1 {
+		t.Fatalf("按标签列出 %d 个进程，期望 1 个", len(states))
+	}
+
+	// 持续读取日志，进程停止后读取结束
+	logs, err := rt.Logs(ctx, id, LogOptions{Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		rt.Stop(ctx, id, time.Second)
+	}()
+	out, err := io.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "listening on 31000") {
+		t.Fatalf("日志是 %q，期望包含监听端口", out)
+	}
+	if state, _ := rt.Inspect(ctx, id); state.Running {
+		t.Fatal("进程应该已经停止")
+	}
+
+	if err := rt.Remove(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Inspect(ctx, id); err == nil {
+		t.Fatal("删除后不应该还能查到进程")
+	}
+}
+
+func TestProcessRuntimeRestartPolicy(t *testing.T) {
+	rt := NewProcessRuntime(t.TempDir())
+	rt.restartDelay = 10 * time.Millisecond
+	ctx := context.Background()
+
+	// 失败退出后最多重启2次，一共运行3次
+	spec := Spec{Name: "crash", Command: []string{"sh", "-c", "echo run; exit 3"}}
+	spec.Resources.RestartPolicy = "on-failure"
+	spec.Resources.MaxRetries = 2
+	id, _ := rt.Create(ctx, spec)
+	if err := rt.Start(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	logs, _ := rt.Logs(ctx, id, LogOptions{Follow: true})
+	defer logs.Close()
+	out, _ := io.ReadAll(logs)
+	if n := strings.Count(string(out), "run"); n != 3 {
+		t.Fatalf("进程运行了 %d 次，期望 3 次", n)
+	}
+	if state, _ := rt.Inspect(ctx, id); state.Running || state.ExitCode != 3 {
+		t.Fatalf("running=%v exit=%d，期望已经退出，退出码3", state.Running, state.ExitCode)
+	}
+}
+
+func TestProcessRuntimeCloseStopsChildren(t *testing.T) {
+	rt := NewProcessRuntime(t.TempDir())
+	rt.restartDelay = 10 * time.Millisecond
+	ctx := context.Background()
+
+	// 总是重启的进程被停止后也不会再启动
+	spec := Spec{Name: "server", Command: []string{"sleep", "30"}}
+	spec.Resources.RestartPolicy = "always"
+	id, _ := rt.Create(ctx, spec)
+	if err := rt.Start(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if state, _ := rt.Inspect(ctx, id); state.Running {
+		t.Fatal("工作节点退出时子进程应该被停止")
+	}
+}
+
+func TestProcessRuntimeAppliesUlimits(t *testing.T) {
+	rt := NewProcessRuntime(t.TempDir())
+	ctx := context.Background()
+
+	// 上限在进程启动后设置，等一会儿再读取
+	spec := Spec{Name: "limits", Command: []string{"sh", "-c", "sleep 0.2; ulimit -n"}}
+	spec.Resources.Ulimits = []catalog.Ulimit{{Name: "nofile", Soft: 256, Hard: 256}}
+	id, _ := rt.Create(ctx, spec)
+	if err := rt.Start(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	logs, _ := rt.Logs(ctx, id, LogOptions{Follow: true})
+	defer logs.Close()
+	out, _ := io.ReadAll(logs)
+	if strings.TrimSpace(string(out)) != "256" {
+		t.Fatalf("子进程的 nofile 上限是 %q，期望 256", out)
+	}
+}
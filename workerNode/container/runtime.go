@@ -0,0 +1,162 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"catalog"
+)
+
+// 运行时名称
+const (
+	RuntimeDocker  = "docker"
+	RuntimeProcess = "process"
+	RuntimeFake    = "fake"
+)
+
+// ContainerPort 模型服务在容器内监听的端口
+const ContainerPort = "8000"
+
+// ErrNotFound 运行时中不存在该容器
+var ErrNotFound = errors.New("container not found")
+
+// ErrNoImageStore 运行时不使用镜像，没有本地镜像缓存
+var ErrNoImageStore = errors.New("runtime has no image store")
+
+// Runtime 运行模型服务的容器运行时，工作节点只通过它管理模型实例
+type Runtime interface {
+	// Name 运行时名称
+	Name() string
+	// Create 按规格创建容器，返回容器ID，创建后容器处于停止状态
+	Create(ctx context.Context, spec Spec) (string, error)
+	// Start 启动已经创建的容器
+	Start(ctx context.Context, id string) error
+	// Stop 停止容器，容器在timeout内没有退出时强制结束
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	// Remove 删除容器，运行中的容器会被强制结束，容器不存在时不报错
+	Remove(ctx context.Context, id string) error
+	// Inspect 查询容器状态，容器不存在时返回ErrNotFound
+	Inspect(ctx context.Context, id string) (State, error)
+	// List 列出带有全部指定标签的容器，包括已经停止的
+	List(ctx context.Context, labels map[string]string) ([]State, error)
+	// Logs 读取容器的标准输出和标准错误
+	Logs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error)
+	// Images 列出本地已经缓存的镜像，运行时不使用镜像时返回ErrNoImageStore
+	Images(ctx context.Context) ([]string, error)
+	// PullImage 拉取镜像，progress 在拉取过程中被多次调用，运行时不使用镜像时返回ErrNoImageStore
+	PullImage(ctx context.Context, image string, progress func(PullProgress)) error
+	// GPUs 查询本节点上可以给模型实例使用的GPU，key是GPU编号，没有GPU时返回空
+	GPUs(ctx context.Context) (map[string]GPU, error)
+}
+
+// PullProgress 镜像拉取进度
+type PullProgress struct {
+	// 镜像层ID，整体状态时为空
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+// LogOptions 读取日志的参数
+type LogOptions struct {
+	// 持续输出新的日志，直到容器退出或ctx取消
+	Follow bool
+	// 只返回最后几行，0表示全部
+	Tail int
+}
+
+// Spec 创建容器的规格
+type Spec struct {
+	Name    string
+	Image   string
+	Command []string
+	Env     map[string]string
+	// 主机路径 -> 容器内路径
+	Mounts map[string]string
+	// ContainerPort 映射到的主机端口
+	HostPort string
+	// 分布式组使用的端口，主机和容器内使用同一个端口号，其他节点上的成员通过它连接，为空时不映射
+	RendezvousPort string
+	Labels         map[string]string
+	// 容器可以使用的GPU编号或UUID，为空时可以使用所有GPU
+	GPUs []string
+	// 模型只使用CPU，不把任何GPU暴露给容器，GPUs被忽略
+	NoGPU bool
+	// 资源限制和运行参数
+	Resources catalog.Resources
+}
+
+// State 容器状态
+type State struct {
+	ID         string
+	Name       string
+	Labels     map[string]string
+	Running    bool
+	ExitCode   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// NewRuntime 按名称创建运行时
+func NewRuntime(name string) (Runtime, error) {
+	switch name {
+	case RuntimeDocker, "":
+		return NewDockerRuntime()
+	case RuntimeProcess:
+		return NewProcessRuntime(""), nil
+	case RuntimeFake:
+		return NewFakeRuntime(), nil
+	}
+	return nil, fmt.Errorf("unknown container runtime %q", name)
+}
+
+// 复制一份标签，避免调用方修改运行时内部的数据
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// 容器的标签包含全部指定的标签
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// TailOffset 计算最后n行日志的起始位置，n不大于0时从头开始。末尾的换行不算新的一行
+func TailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 64*1024)
+	lines := 0
+	pos := size
+	for pos > 0 {
+		chunk := min(int64(len(buf)), pos)
+		pos -= chunk
+		if _, err := r.ReadAt(buf[:chunk], pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			if buf[i] != '\n' || pos+i == size-1 {
+				continue
+			}
+			lines++
+			if lines == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,19 @@
+package container
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTailOffset(t *testing.T) {
+	logs := "a\nb\nc\n"
+	for tail, want := range map[int]string{0: logs, 1: "c\n", 2: "b\nc\n", 5: logs} {
+		offset, err := TailOffset(strings.NewReader(logs), int64(len(logs)), tail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := logs[offset:]; got != want {
+			t.Errorf("tail=%d 得到 %q，期望 %q", tail, got, want)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 
 import os
+import json
+from threading import Thread
 from typing import Optional
 from fastapi import FastAPI
+from fastapi.responses import StreamingResponse
 from pydantic import BaseModel
 import torch
-from transformers import AutoModelForCausalLM, AutoTokenizer
+from transformers import AutoModelForCausalLM, AutoTokenizer, TextIteratorStreamer
 
 app = FastAPI()
 
@@ -22,11 +25,35 @@ class InferenceRequest(BaseModel):
     prompt: str
     max_length: Optional[int] = 100
     temperature: Optional[float] = 0.7
+    # 为True时以SSE的形式边生成边返回
+    stream: Optional[bool] = False
+
+def generate_in_background(**kwargs):
+    with torch.no_grad():
+        model.generate(**kwargs)
 
 @app.post("/generate")
 async def generate_text(request: InferenceRequest):
     inputs = tokenizer(request.prompt, return_tensors="pt").to("cuda")
-    
+
+    if request.stream:
+        streamer = TextIteratorStreamer(tokenizer, skip_prompt=True, skip_special_tokens=True)
+        Thread(target=generate_in_background, kwargs=dict(
+            **inputs,
+            max_length=request.max_length,
+            temperature=request.temperature,
+            do_sample=True,
+            streamer=streamer,
+        )).start()
+
+        def events():
+            for text in streamer:
+                if text:
+                    yield f"data: {json.dumps({'text': text}, ensure_ascii=False)}\n\n"
+            yield "data: [DONE]\n\n"
+
+        return StreamingResponse(events(), media_type="text/event-stream")
+
     with torch.no_grad():
         outputs = model.generate(
             **inputs,
@@ -44,4 +71,5 @@ async def health_check():
 
 if __name__ == "__main__":
     import uvicorn
-    uvicorn.run(app, host="0.0.0.0", port=8000)
\ No newline at end of file
+    # 以本地进程运行时由工作节点通过PORT指定监听端口
+    uvicorn.run(app, host="0.0.0.0", port=int(os.getenv("PORT", "8000")))
\ No newline at end of file
@@ -3,13 +3,18 @@ module workerNode
 go 1.24.1
 
 require (
+	api v0.0.0-00010101000000-000000000000
+	catalog v0.0.0-00010101000000-000000000000
+	github.com/NVIDIA/go-nvml v0.12.4-1
 	github.com/docker/docker v28.0.4+incompatible
 	github.com/docker/go-connections v0.5.0
+	golang.org/x/sys v0.30.0
+	google.golang.org/grpc v1.71.1
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
 	github.com/Microsoft/go-winio v0.4.14 // indirect
-	github.com/NVIDIA/go-nvml v0.12.4-1 // indirect
 	github.com/containerd/log v0.1.0 // indirect
 	github.com/distribution/reference v0.6.0 // indirect
 	github.com/docker/go-units v0.5.0 // indirect
@@ -30,11 +35,15 @@ require (
 	go.opentelemetry.io/otel/metric v1.35.0 // indirect
 	go.opentelemetry.io/otel/trace v1.35.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
-	google.golang.org/grpc v1.71.1 // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gotest.tools/v3 v3.5.2 // indirect
 )
+
+// master和工作节点之间的接口定义
+replace api => ../api
+
+// 模型目录由master和工作节点共用
+replace catalog => ../catalog
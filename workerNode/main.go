@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	"workerNode/container"
 	"workerNode/worker"
 )
 
@@ -19,17 +20,34 @@ func main() {
 
 	// 创建节点配置
 	config := &worker.Config{
-		NodeID:    "node-1",
-		IP:        "127.0.0.1",
-		Port:      "7070",
-		ServerURL: "http://localhost:8080",
-		Interval:  200000 * time.Second,
-		Timeout:   10 * time.Second,
+		NodeID:     "node-1",
+		IP:         "127.0.0.1",
+		Port:       "7070",
+		MasterAddr: "localhost:8080",
+		Interval:   200000 * time.Second,
+		Timeout:    10 * time.Second,
+
+		PortRangeStart: worker.DefaultPortRangeStart,
+		PortRangeEnd:   worker.DefaultPortRangeEnd,
+
+		Runtime: container.RuntimeDocker,
+
+		ModelCatalog: os.Getenv("MODEL_CATALOG"),
+
+		PKIDir:    "pki",
+		JoinToken: os.Getenv("JOIN_TOKEN"),
+		CAHash:    os.Getenv("CA_HASH"),
+		Insecure:  os.Getenv("INSECURE") == "true",
 	}
 
 	// 创建工作节点
 	node := worker.NewWorker(config)
 
+	// 读取节点证书，第一次启动时用加入令牌向master申请
+	if err := node.LoadCredentials(); err != nil {
+		log.Fatalf("加载证书失败: %v", err)
+	}
+
 	// 连接到集群中，注册节点，并且开启心跳协程
 	go func() {
 		if err := node.StartLink(); err != nil {
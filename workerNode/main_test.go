@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"testing"
 	"workerNode/container"
 )
@@ -8,5 +9,7 @@ import (
 // 定义测试函数，函数名必须以Test开头
 func Test(t *testing.T) {
 	// container.StartModelContainer("llama3-8b")
-	container.DeleteContainer("tsif")
+	if rt, err := container.NewDockerRuntime(); err == nil {
+		container.DeleteContainer(context.Background(), rt, "tsif")
+	}
 }
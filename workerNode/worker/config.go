@@ -4,10 +4,22 @@ import "time"
 
 // Config 客户端配置
 type Config struct {
-	NodeID    string        `json:"node_id"`    // 节点ID
-	IP        string        `json:"ip"`         // 节点IP
-	Port      string        `json:"port"`       // 节点端口
-	ServerURL string        `json:"server_url"` // 服务端地址
-	Interval  time.Duration `json:"interval"`   // 心跳间隔
-	Timeout   time.Duration `json:"timeout"`    // 请求超时时间
+	NodeID     string        `json:"node_id"`     // 节点ID
+	IP         string        `json:"ip"`          // 节点IP
+	Port       string        `json:"port"`        // 节点端口
+	MasterAddr string        `json:"master_addr"` // master控制流服务的地址，host:port
+	Interval   time.Duration `json:"interval"`    // 心跳间隔
+	Timeout    time.Duration `json:"timeout"`     // 请求超时时间
+
+	PortRangeStart int `json:"port_range_start"` // 模型容器主机端口范围起点
+	PortRangeEnd   int `json:"port_range_end"`   // 模型容器主机端口范围终点
+
+	Runtime string `json:"runtime"` // 容器运行时：docker 或 process
+
+	ModelCatalog string `json:"model_catalog"` // 模型目录文件，修改后自动重新加载，为空时使用内置目录
+
+	PKIDir    string `json:"pki_dir"`    // 节点证书所在的目录
+	JoinToken string `json:"join_token"` // 还没有证书时用来申请证书的一次性令牌
+	CAHash    string `json:"ca_hash"`    // master的CA指纹，第一次连接时用它确认master的身份
+	Insecure  bool   `json:"insecure"`   // 不使用TLS，只用于本地调试
 }
@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"time"
+
+	"api/pki"
+	pb "api/schedule"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 节点证书的文件名，node.crt 和 node.key
+const nodeCertName = "node"
+
+// 加入集群和续期证书的超时时间
+const joinTimeout = 30 * time.Second
+
+// LoadCredentials 读取节点证书，还没有证书时用加入令牌向master申请，
+// 之后在证书快到期时自动续期，不需要重启节点
+func (w *Worker) LoadCredentials() error {
+	if w.config.Insecure {
+		log.Println("警告: 没有启用TLS，任何人都可以冒充master或者本节点")
+		return nil
+	}
+
+	creds, err := pki.LoadCredentials(w.config.PKIDir, nodeCertName)
+	if errors.Is(err, fs.ErrNotExist) {
+		creds, err = w.join()
+	}
+	if err != nil {
+		return err
+	}
+	w.creds = creds
+	log.Printf("节点证书有效期到 %s", creds.Leaf().NotAfter.Format(time.RFC3339))
+	go pki.Rotate(creds, w.renew, w.stopChan)
+	return nil
+}
+
+// 用加入令牌向master申请证书并保存。这时还不信任任何CA，
+// 靠CA指纹确认连接的是真正的master
+func (w *Worker) join() (*pki.Credentials, error) {
+	if w.config.JoinToken == "" || w.config.CAHash == "" {
+		return nil, errors.New("还没有节点证书，需要提供加入令牌和CA指纹（JOIN_TOKEN、CA_HASH）")
+	}
+	conn, err := grpc.NewClient(w.config.MasterAddr,
+		grpc.WithTransportCredentials(credentials.NewTLS(pki.BootstrapConfig(w.config.CAHash))))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 证书中的地址由master决定，是节点连接master时使用的IP
+	keyPEM, csrPEM, err := pki.NewKeyAndCSR(w.config.NodeID, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), joinTimeout)
+	defer cancel()
+	resp, err := pb.NewJoinServiceClient(conn).Join(ctx, &pb.JoinRequest{
+		Token:  w.config.JoinToken,
+		NodeId: w.config.NodeID,
+		CsrPem: csrPEM,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("加入集群失败: %w", err)
+	}
+	if err := pki.VerifyCAHash(resp.GetCaPem(), w.config.CAHash); err != nil {
+		return nil, err
+	}
+
+	creds, err := pki.NewCredentials(resp.GetCertPem(), keyPEM, resp.GetCaPem())
+	if err != nil {
+		return nil, err
+	}
+	if err := pki.SaveCredentials(w.config.PKIDir, nodeCertName, resp.GetCertPem(), keyPEM, resp.GetCaPem()); err != nil {
+		return nil, err
+	}
+	log.Println("已加入集群，节点证书保存在", w.config.PKIDir)
+	return creds, nil
+}
+
+// 用当前的证书向master申请新证书并保存
+func (w *Worker) renew() (certPEM, keyPEM, caPEM []byte, err error) {
+	conn, err := grpc.NewClient(w.config.MasterAddr, grpc.WithTransportCredentials(w.transportCredentials()))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer conn.Close()
+
+	keyPEM, csrPEM, err := pki.NewKeyAndCSR(w.config.NodeID, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), joinTimeout)
+	defer cancel()
+	resp, err := pb.NewJoinServiceClient(conn).Renew(ctx, &pb.RenewRequest{CsrPem: csrPEM})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// 先确认新证书可用再覆盖旧文件
+	if _, err := pki.NewCredentials(resp.GetCertPem(), keyPEM, resp.GetCaPem()); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := pki.SaveCredentials(w.config.PKIDir, nodeCertName, resp.GetCertPem(), keyPEM, resp.GetCaPem()); err != nil {
+		return nil, nil, nil, err
+	}
+	return resp.GetCertPem(), keyPEM, resp.GetCaPem(), nil
+}
+
+// 连接master使用的传输凭证，没有证书时不使用TLS。
+// 其他节点的证书也由同一个CA签发，还要确认对端是master
+func (w *Worker) transportCredentials() credentials.TransportCredentials {
+	if w.creds == nil {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(w.creds.ClientConfig(pki.AllowCommonName(pki.MasterName)))
+}
+
+// 调度服务器的选项：有证书时只接受master的证书
+func (w *Worker) serverOptions() []grpc.ServerOption {
+	if w.creds == nil {
+		log.Println("警告: 调度服务器没有启用TLS")
+		return nil
+	}
+	config := w.creds.ServerConfig(tls.RequireAndVerifyClientCert, pki.AllowCommonName(pki.MasterName))
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}
+}
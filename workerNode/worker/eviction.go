@@ -0,0 +1,276 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+
+	"workerNode/container"
+)
+
+// 卸载实例的原因
+const (
+	EvictIdle   = "idle"
+	EvictLRU    = "lru"
+	EvictExited = "exited"
+	EvictFailed = "failed"
+	// 节点正在排空
+	EvictDrained = "drained"
+	// master要求停止
+	EvictStopped = "stopped"
+)
+
+// ErrInsufficientGPUMemory 卸载所有空闲实例后显存仍然不够
+var ErrInsufficientGPUMemory = errors.New("insufficient GPU memory")
+
+// 查找实例并标记为正在处理请求，处理中的实例不会被卸载，
+// 查找和标记在同一把锁内完成，避免实例在两者之间被卸载
+func (s *server) acquireInstance(id string) (*instance, bool) {
+	if id == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, exists := s.instances[id]
+	if exists {
+		inst.inFlight++
+		inst.lastUsed = s.now()
+	}
+	return inst, exists
+}
+
+// 实例处理完请求，刷新最近使用时间
+func (s *server) release(inst *instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.inFlight--
+	inst.lastUsed = s.now()
+}
+
+// 实例可以被卸载：没有正在处理的请求，并且不是组调度实例的成员。
+// 组调度实例的各个成员互相依赖，它们的生命周期由master管理。调用方需要持有锁
+func (inst *instance) evictable() bool {
+	return inst.inFlight == 0 && inst.worldSize <= 1
+}
+
+// 卸载空闲超过模型超时时间的实例，节点排空时卸载所有空闲的实例
+func (s *server) evictIdle() {
+	now := s.now()
+	s.mu.Lock()
+	reason := EvictIdle
+	if s.draining {
+		reason = EvictDrained
+	}
+	var idle []*instance
+	for id, inst := range s.instances {
+		if !inst.evictable() {
+			continue
+		}
+		ttl := container.IdleTimeout(inst.modelName)
+		if s.draining || (ttl > 0 && now.Sub(inst.lastUsed) > ttl) {
+			delete(s.instances, id)
+			idle = append(idle, inst)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, inst := range idle {
+		s.stopInstance(inst, reason)
+	}
+}
+
+// 排空节点：不再启动新实例，马上停止空闲的实例，
+// 正在处理请求的实例在之后的定期检查中空闲下来后停止
+func (s *server) drain() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	log.Println("节点开始排空")
+	s.evictIdle()
+}
+
+// 节点是否正在排空
+func (s *server) isDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// 为即将启动的实例腾出显存，按最近使用时间从旧到新卸载空闲实例，直到空闲显存足够。
+// 组调度的成员只需要模型显存的一份，和master一样按节点数平均分担，再平均分到指定的每张GPU上；
+// 指定了GPU时逐张检查空闲显存，只卸载使用这些GPU的实例。
+// 容器删除后NVML不会马上看到显存被释放，所以只查询一次空闲显存，
+// 之后按被卸载实例的模型已知的显存占用累加。无法获取显存信息时不卸载，交给容器启动自己判断
+func (s *server) makeRoom(model_name string, gpu_ids []string, world_size int32) error {
+	config, _ := container.LookupModel(model_name)
+	if config.GPUMemoryMB == 0 {
+		return nil
+	}
+	need_MB := splitMemoryMB(config.GPUMemoryMB, world_size)
+
+	sampled, err := s.freeMemory()
+	if err != nil {
+		log.Printf("获取空闲显存失败，跳过LRU卸载: %v", err)
+		return nil
+	}
+	free := maps.Clone(sampled)
+	for {
+		shortage := memoryShortage(free, gpu_ids, need_MB)
+		if shortage == "" {
+			return nil
+		}
+
+		victim := s.takeLRU(gpu_ids)
+		if victim == nil {
+			return fmt.Errorf("%w: model %s %s", ErrInsufficientGPUMemory, model_name, shortage)
+		}
+		s.stopInstance(victim, EvictLRU)
+		for gpu_id, mb := range victim.memoryMB(free) {
+			free[gpu_id] += mb
+		}
+	}
+}
+
+// 组调度的每个成员分担的显存，向上取整
+func splitMemoryMB(memory_MB uint64, world_size int32) uint64 {
+	if world_size <= 1 {
+		return memory_MB
+	}
+	return (memory_MB + uint64(world_size) - 1) / uint64(world_size)
+}
+
+// 实例在每张GPU上占用的显存，按模型的显存需求和master一样平均切分。
+// 没有指定GPU的实例可以使用所有GPU，不知道实际用了哪张，把占用平均算到free里的每张GPU上
+func (inst *instance) memoryMB(free map[string]uint64) map[string]uint64 {
+	config, _ := container.LookupModel(inst.modelName)
+	total_MB := splitMemoryMB(config.GPUMemoryMB, inst.worldSize)
+	gpu_ids := inst.gpuIDs
+	if len(gpu_ids) == 0 {
+		gpu_ids = slices.Collect(maps.Keys(free))
+	}
+	if len(gpu_ids) == 0 {
+		return nil
+	}
+	per_GPU_MB := (total_MB + uint64(len(gpu_ids)) - 1) / uint64(len(gpu_ids))
+	used := make(map[string]uint64, len(gpu_ids))
+	for _, gpu_id := range gpu_ids {
+		used[gpu_id] = per_GPU_MB
+	}
+	return used
+}
+
+// 检查空闲显存能否放下need_MB，放得下时返回空字符串，否则返回缺口的描述。
+// 没有指定GPU时容器可以使用所有GPU，按所有GPU的空闲显存之和计算
+func memoryShortage(free map[string]uint64, gpu_ids []string, need_MB uint64) string {
+	if len(gpu_ids) == 0 {
+		var total uint64
+		for _, mb := range free {
+			total += mb
+		}
+		if total < need_MB {
+			return fmt.Sprintf("needs %d MB, %d MB free", need_MB, total)
+		}
+		return ""
+	}
+	// 向上取整，和master切分显存的方式一致
+	per_GPU_MB := (need_MB + uint64(len(gpu_ids)) - 1) / uint64(len(gpu_ids))
+	for _, gpu_id := range gpu_ids {
+		if free[gpu_id] < per_GPU_MB {
+			return fmt.Sprintf("needs %d MB on GPU %s, %d MB free", per_GPU_MB, gpu_id, free[gpu_id])
+		}
+	}
+	return ""
+}
+
+// 实例使用了指定GPU中的至少一张。没有指定GPU的实例可以使用所有GPU，
+// 只使用CPU的实例不占用任何GPU，卸载它腾不出显存
+func (inst *instance) usesAnyGPU(gpu_ids []string) bool {
+	if config, _ := container.LookupModel(inst.modelName); config.GPUMemoryMB == 0 {
+		return false
+	}
+	if len(gpu_ids) == 0 || len(inst.gpuIDs) == 0 {
+		return true
+	}
+	for _, a := range inst.gpuIDs {
+		for _, b := range gpu_ids {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 从登记表中取出使用指定GPU的、最久未使用的可卸载实例，没有指定GPU时在所有实例中选择
+func (s *server) takeLRU(gpu_ids []string) *instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var candidates []*instance
+	for _, inst := range s.instances {
+		if inst.evictable() && inst.usesAnyGPU(gpu_ids) {
+			candidates = append(candidates, inst)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+	delete(s.instances, candidates[0].id)
+	return candidates[0]
+}
+
+// 从登记表中移除没能就绪的实例并清理它的容器
+func (s *server) discard(inst *instance) {
+	s.mu.Lock()
+	_, exists := s.instances[inst.id]
+	delete(s.instances, inst.id)
+	s.mu.Unlock()
+	if exists {
+		s.stopInstance(inst, EvictFailed)
+	}
+}
+
+// 停止已经从登记表中取出的实例，保存日志后删除容器，回收端口和GPU，并通知master
+func (s *server) stopInstance(inst *instance, reason string) {
+	s.teardown(inst, reason)
+	if s.onEvict != nil {
+		s.onEvict(inst.id, reason)
+	}
+}
+
+// 删除实例的容器并回收端口和GPU，不通知master
+func (s *server) teardown(inst *instance, reason string) {
+	s.archiveLogs(inst)
+	if err := s.rt.Remove(context.Background(), inst.containerID); err != nil {
+		log.Printf("删除实例 %s 的容器失败: %v", inst.id, err)
+	}
+	if port, err := strconv.Atoi(inst.hostPort); err == nil {
+		s.ports.Release(port)
+	}
+	if port, err := strconv.Atoi(inst.rendezvousPort); err == nil {
+		s.ports.Release(port)
+	}
+	s.gpus.Release(inst.id)
+	log.Printf("卸载实例 %s（模型 %s，端口 %s），原因: %s", inst.id, inst.modelName, inst.hostPort, reason)
+}
+
+// 通过容器运行时查询本节点每张GPU的空闲显存，key是GPU编号
+func (s *server) freeMemoryMB() (map[string]uint64, error) {
+	gpus, err := s.rt.GPUs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	free := make(map[string]uint64, len(gpus))
+	for id, gpu := range gpus {
+		free[id] = gpu.FreeMemoryMB
+	}
+	return free, nil
+}
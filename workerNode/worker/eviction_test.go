@@ -0,0 +1,217 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"catalog"
+	"context"
+	"testing"
+	"time"
+	"workerNode/container"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 登记一个空闲的单节点实例，最近使用时间是now之前idle
+func addIdleInstance(s *server, id string, idle time.Duration) {
+	s.addInstance(&instance{id: id, modelName: "llama3-8b", containerID: "c-" + id})
+	s.instances[id].lastUsed = s.now().Add(-idle)
+}
+
+func evictionServer() (*server, *[]string) {
+	ports, _ := NewPortAllocator(31000, 31009)
+	s := newServer(container.NewFakeRuntime(), ports)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	var evicted []string
+	s.onEvict = func(instance_id, reason string) {
+		evicted = append(evicted, instance_id+":"+reason)
+	}
+	return s, &evicted
+}
+
+func TestEvictIdleInstances(t *testing.T) {
+	s, evicted := evictionServer()
+	ttl := container.IdleTimeout("llama3-8b")
+	addIdleInstance(s, "old", ttl+time.Minute)
+	addIdleInstance(s, "recent", time.Minute)
+	addIdleInstance(s, "busy", ttl+time.Minute)
+	s.instances["busy"].inFlight = 1
+
+	s.evictIdle()
+
+	if len(*evicted) != 1 || (*evicted)[0] != "old:idle" {
+		t.Fatalf("卸载了 %v，期望只卸载空闲超时的实例", *evicted)
+	}
+	if _, ok := s.lookupInstance("busy"); !ok {
+		t.Fatal("正在处理请求的实例不应该被卸载")
+	}
+}
+
+func TestMakeRoomEvictsLeastRecentlyUsed(t *testing.T) {
+	s, evicted := evictionServer()
+	addIdleInstance(s, "a", 3*time.Minute)
+	addIdleInstance(s, "b", 2*time.Minute)
+	addIdleInstance(s, "c", time.Minute)
+	s.instances["a"].gpuIDs = []string{"0"}
+	s.instances["b"].gpuIDs = []string{"0"}
+	s.instances["c"].gpuIDs = []string{"0"}
+
+	// NVML还没有看到显存被释放，卸载实例后查询到的空闲显存不变
+	s.freeMemory = func() (map[string]uint64, error) { return map[string]uint64{"0": 4 * 1024}, nil }
+
+	// 启动llama3-8b需要16GB，卸载一个16GB的实例就够了
+	if err := s.makeRoom("llama3-8b", []string{"0"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(*evicted) != 1 || (*evicted)[0] != "a:lru" {
+		t.Fatalf("卸载了 %v，期望只卸载最久未使用的 a", *evicted)
+	}
+
+	// 剩下的实例都在使用中，显存不够时返回错误
+	s.instances["b"].inFlight = 1
+	s.instances["c"].inFlight = 1
+	if err := s.makeRoom("llama3-8b", []string{"0"}, 0); err == nil {
+		t.Fatal("没有可卸载的实例时应该返回错误")
+	}
+}
+
+// 只使用CPU的实例不占用GPU，卸载它腾不出显存，不会为了GPU模型被卸载
+func TestMakeRoomSkipsCPUOnlyInstances(t *testing.T) {
+	c := &catalog.Catalog{Models: map[string]catalog.Model{"cpu-only": {Image: "cpu:v1"}}}
+	for name, m := range catalog.Default().Models {
+		c.Models[name] = m
+	}
+	container.SetModels(c)
+	t.Cleanup(func() { container.SetModels(catalog.Default()) })
+
+	s, evicted := evictionServer()
+	addIdleInstance(s, "cpu", time.Minute)
+	s.instances["cpu"].modelName = "cpu-only"
+	s.freeMemory = func() (map[string]uint64, error) { return map[string]uint64{"0": 4 * 1024}, nil }
+
+	if err := s.makeRoom("llama3-8b", nil, 0); err == nil {
+		t.Fatal("没有可以腾出显存的实例时应该返回错误")
+	}
+	if len(*evicted) != 0 {
+		t.Fatalf("卸载了 %v，只使用CPU的实例不应该被卸载", *evicted)
+	}
+	// 只使用CPU的模型启动时不需要腾出显存
+	if err := s.makeRoom("cpu-only", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 组调度的成员只需要自己的那份显存，并且只按指定的GPU检查空闲显存、卸载实例
+func TestMakeRoomChecksPinnedGPUs(t *testing.T) {
+	s, evicted := evictionServer()
+	addIdleInstance(s, "on-gpu0", time.Minute)
+	addIdleInstance(s, "on-gpu1", 2*time.Minute) // 更久没有使用，但不在要启动的GPU上
+	s.instances["on-gpu0"].gpuIDs = []string{"0"}
+	s.instances["on-gpu1"].gpuIDs = []string{"1"}
+
+	// 所有GPU的空闲显存之和足够，但GPU 0上只有4GB
+	free := map[string]uint64{"0": 4 * 1024, "1": 70 * 1024}
+	s.freeMemory = func() (map[string]uint64, error) { return free, nil }
+	s.onEvict = func(instance_id, reason string) {
+		*evicted = append(*evicted, instance_id+":"+reason)
+		if instance_id == "on-gpu0" {
+			free["0"] += 10 * 1024
+		}
+	}
+
+	// llama3-8b 需要16GB，两个节点的组调度每个成员只需要8GB
+	if err := s.makeRoom("llama3-8b", []string{"0"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(*evicted) != 1 || (*evicted)[0] != "on-gpu0:lru" {
+		t.Fatalf("卸载了 %v，期望只卸载GPU 0上的实例", *evicted)
+	}
+
+	// GPU 0上已经没有可卸载的实例，放不下整个模型时返回错误，不会去卸载GPU 1上的实例
+	if err := s.makeRoom("llama3-8b", []string{"0"}, 1); err == nil {
+		t.Fatal("指定的GPU显存不够时应该返回错误")
+	}
+	if _, ok := s.lookupInstance("on-gpu1"); !ok {
+		t.Fatal("其他GPU上的实例不应该被卸载")
+	}
+}
+
+// master把模型调度到显存被空闲实例占满的GPU上，启动时卸载最久未使用的实例腾出显存
+func TestStartInstanceEvictsLeastRecentlyUsed(t *testing.T) {
+	s, _ := fakeServer(t)
+	addIdleInstance(s, "older", 2*time.Minute)
+	addIdleInstance(s, "newer", time.Minute)
+	s.instances["older"].gpuIDs = []string{"0"}
+	s.instances["newer"].gpuIDs = []string{"0"}
+
+	free := uint64(4 * 1024)
+	s.freeMemory = func() (map[string]uint64, error) { return map[string]uint64{"0": free}, nil }
+	var evicted []string
+	s.onEvict = func(instance_id, reason string) {
+		evicted = append(evicted, instance_id+":"+reason)
+		free += 16 * 1024
+	}
+
+	_, err := s.StartInstance(context.Background(), &pb.StartInstanceRequest{
+		InstanceId: "inst-new",
+		ModelName:  "llama3-8b",
+		GpuIds:     []string{"0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0] != "older:lru" {
+		t.Fatalf("卸载了 %v，期望只卸载最久未使用的实例", evicted)
+	}
+	if _, ok := s.lookupInstance("newer"); !ok {
+		t.Fatal("腾出显存之后不应该继续卸载实例")
+	}
+}
+
+func TestDrainStopsIdleInstancesAndRefusesStarts(t *testing.T) {
+	s, evicted := evictionServer()
+	addIdleInstance(s, "idle", time.Minute)
+	addIdleInstance(s, "busy", time.Minute)
+	s.instances["busy"].inFlight = 1
+
+	s.drain()
+	if len(*evicted) != 1 || (*evicted)[0] != "idle:drained" {
+		t.Fatalf("卸载了 %v，期望只卸载空闲的实例", *evicted)
+	}
+
+	// 排空后不再启动新实例
+	_, err := s.launch(context.Background(), "inst-new", &pb.StartInstanceRequest{ModelName: "llama3-8b"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("排空后启动实例应该返回 FailedPrecondition，得到 %v", err)
+	}
+
+	// 正在处理请求的实例处理完后在定期检查中停止
+	s.release(s.instances["busy"])
+	s.evictIdle()
+	if len(*evicted) != 2 || (*evicted)[1] != "busy:drained" {
+		t.Fatalf("卸载了 %v，期望处理完请求的实例也被卸载", *evicted)
+	}
+}
+
+// GPU信息来自容器运行时，没有GPU的节点也能正常查询
+func TestGPUInfoComesFromRuntime(t *testing.T) {
+	rt := container.NewFakeRuntime()
+	rt.SetGPUs(map[string]container.GPU{
+		"0": {UUID: "GPU-aaaa", FreeMemoryMB: 4 * 1024},
+		"1": {UUID: "GPU-bbbb", FreeMemoryMB: 80 * 1024},
+	})
+	ports, _ := NewPortAllocator(31000, 31009)
+	s := newServer(rt, ports)
+	if got := s.resolveGPU("GPU-bbbb"); got != "1" {
+		t.Errorf("GPU-bbbb 的编号是 %q，期望 1", got)
+	}
+	if free, err := s.freeMemory(); err != nil || free["0"] != 4*1024 || free["1"] != 80*1024 {
+		t.Errorf("空闲显存 %v %v", free, err)
+	}
+
+	w := NewWorker(&Config{Runtime: container.RuntimeFake, Timeout: time.Second})
+	if gpus, err := w.gpuInfo(); err != nil || len(gpus) != 0 {
+		t.Errorf("没有GPU的节点查询GPU得到 %v %v", gpus, err)
+	}
+}
@@ -0,0 +1,291 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	pb "api/schedule"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 查找可以处理提示词的实例：已经就绪的单节点实例或者组调度实例的rank 0。
+// 返回的实例算作正在使用，用完之后要调用release
+func (s *server) servingInstance(id string) (*instance, error) {
+	inst, exists := s.acquireInstance(id)
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "instance %s not found", id)
+	}
+	s.mu.Lock()
+	ready, rank := inst.ready, inst.rank
+	s.mu.Unlock()
+	switch {
+	case !ready:
+		s.release(inst)
+		return nil, status.Errorf(codes.FailedPrecondition, "instance %s is still loading", id)
+	case rank > 0:
+		// 组调度中rank大于0的成员不处理提示词
+		s.release(inst)
+		return nil, status.Errorf(codes.FailedPrecondition, "rank %d of instance %s does not serve prompts", rank, id)
+	}
+	return inst, nil
+}
+
+// 把提示词发给实例，返回完整的生成结果
+func (s *server) infer(ctx context.Context, inst *instance, prompt string) (string, error) {
+	var result strings.Builder
+	err := generate(ctx, "http://localhost:"+inst.hostPort, prompt, func(text string) error {
+		result.WriteString(text)
+		return nil
+	})
+	return result.String(), err
+}
+
+// Infer 把提示词发给已经就绪的实例，返回完整结果
+func (s *server) Infer(ctx context.Context, req *pb.InferRequest) (*pb.InferResponse, error) {
+	inst, err := s.servingInstance(req.GetInstanceId())
+	if err != nil {
+		return nil, err
+	}
+	defer s.release(inst)
+
+	text, err := s.infer(ctx, inst, req.GetPrompt())
+	if err != nil {
+		return nil, generateError(inst, err)
+	}
+	return &pb.InferResponse{Text: text}, nil
+}
+
+// InferStream 把提示词发给已经就绪的实例，生成的内容一边产生一边返回给master。
+// 模型服务可以返回SSE、分块传输的纯文本，或者不支持流式时返回一整个JSON
+func (s *server) InferStream(req *pb.InferRequest, stream grpc.ServerStreamingServer[pb.GenerateChunk]) error {
+	inst, err := s.servingInstance(req.GetInstanceId())
+	if err != nil {
+		return err
+	}
+	defer s.release(inst)
+
+	// 第一段只告诉master实例的端口
+	if err := stream.Send(&pb.GenerateChunk{Port: inst.hostPort}); err != nil {
+		return err
+	}
+
+	err = generate(stream.Context(), "http://localhost:"+inst.hostPort, req.GetPrompt(), func(text string) error {
+		return stream.Send(&pb.GenerateChunk{Text: text})
+	})
+	if err != nil {
+		return generateError(inst, err)
+	}
+	return nil
+}
+
+// GenerateStatusError 模型服务的生成接口返回了非200的状态码
+type GenerateStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *GenerateStatusError) Error() string {
+	return fmt.Sprintf("generate returned %d: %s", e.StatusCode, e.Body)
+}
+
+// 把生成失败的错误转换成gRPC状态。master把Unavailable当作实例已经不可用，
+// 所以只有连不上模型服务或者连接中断时才返回Unavailable，
+// 模型服务自己返回的错误说明实例还活着，不能让master停掉共享的实例
+func generateError(inst *instance, err error) error {
+	if _, ok := status.FromError(err); ok {
+		// 发送给master失败，已经是gRPC状态
+		return err
+	}
+	var status_err *GenerateStatusError
+	var net_err net.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.As(err, &status_err) && status_err.StatusCode < 500:
+		return status.Errorf(codes.InvalidArgument, "instance %s: %v", inst.id, err)
+	case errors.As(err, &status_err):
+		return status.Errorf(codes.Internal, "instance %s: %v", inst.id, err)
+	case errors.As(err, &net_err), errors.Is(err, io.ErrUnexpectedEOF):
+		return status.Errorf(codes.Unavailable, "instance %s on port %s unreachable: %v", inst.id, inst.hostPort, err)
+	default:
+		// 模型服务返回的内容无法解析
+		return status.Errorf(codes.Internal, "instance %s: %v", inst.id, err)
+	}
+}
+
+// 请求模型服务的流式生成接口，每收到一段文本调用一次send
+func generate(ctx context.Context, url, prompt string, send func(text string) error) error {
+	body, err := json.Marshal(map[string]any{
+		"prompt": prompt,
+		"stream": true,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/generate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &GenerateStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	media_type, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch media_type {
+	case "text/event-stream":
+		return relaySSE(resp.Body, send)
+	case "application/json":
+		// 不支持流式的模型服务一次返回全部结果
+		text, err := chunkText(resp.Body)
+		if err != nil {
+			return err
+		}
+		return send(text)
+	default:
+		return relayChunks(resp.Body, send)
+	}
+}
+
+// 转发SSE事件，每个事件的data是一段文本或者带有文本字段的JSON，收到[DONE]时结束
+func relaySSE(r io.Reader, send func(text string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data []string
+	flush := func() (bool, error) {
+		if len(data) == 0 {
+			return false, nil
+		}
+		payload := strings.Join(data, "\n")
+		data = data[:0]
+		if payload == "[DONE]" {
+			return true, nil
+		}
+		text, err := chunkText(strings.NewReader(payload))
+		if err != nil {
+			// 不是JSON，本身就是文本
+			text = payload
+		}
+		if text == "" {
+			return false, nil
+		}
+		return false, send(strings.ToValidUTF8(text, "�"))
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// 空行表示一个事件结束
+			done, err := flush()
+			if done || err != nil {
+				return err
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+		// 其他字段（event、id、注释）不需要转发
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	_, err := flush()
+	return err
+}
+
+// 转发分块传输的纯文本，每次读到的内容作为一段，不完整的UTF-8字符留到下一段
+func relayChunks(r io.Reader, send func(text string) error) error {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			complete, rest := splitUTF8(pending)
+			if len(complete) > 0 {
+				if err := send(string(complete)); err != nil {
+					return err
+				}
+			}
+			pending = append(pending[:0], rest...)
+		}
+		if err == io.EOF {
+			if len(pending) > 0 {
+				return send(strings.ToValidUTF8(string(pending), "�"))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 把末尾不完整的UTF-8字符分出来
+func splitUTF8(b []byte) (complete, rest []byte) {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i], b[i:]
+			}
+			break
+		}
+	}
+	return b, nil
+}
+
+// 从JSON中取出生成的文本，兼容常见的字段名和OpenAI风格的choices
+func chunkText(r io.Reader) (string, error) {
+	var fields map[string]any
+	if err := json.NewDecoder(r).Decode(&fields); err != nil {
+		return "", err
+	}
+	if text, ok := textField(fields); ok {
+		return text, nil
+	}
+	if choices, ok := fields["choices"].([]any); ok && len(choices) > 0 {
+		if choice, ok := choices[0].(map[string]any); ok {
+			if text, ok := textField(choice); ok {
+				return text, nil
+			}
+			if delta, ok := choice["delta"].(map[string]any); ok {
+				if text, ok := textField(delta); ok {
+					return text, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no text field in %v", fields)
+}
+
+func textField(fields map[string]any) (string, bool) {
+	for _, key := range []string{"text", "token", "content", "result"} {
+		if text, ok := fields[key].(string); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
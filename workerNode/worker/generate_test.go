@@ -0,0 +1,147 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 收集发送给master的生成结果
+type fakeGenerateStream struct {
+	grpc.ServerStream
+	chunks []*pb.GenerateChunk
+}
+
+func (f *fakeGenerateStream) Context() context.Context { return context.Background() }
+
+func (f *fakeGenerateStream) Send(chunk *pb.GenerateChunk) error {
+	f.chunks = append(f.chunks, chunk)
+	return nil
+}
+
+func TestGenerateRelaysStreamingFormats(t *testing.T) {
+	cases := map[string]struct {
+		contentType string
+		body        string
+		want        []string
+	}{
+		"sse": {
+			contentType: "text/event-stream",
+			body:        "data: {\"text\": \"你\"}\n\n: keep-alive\n\ndata: 好\n\ndata: {\"choices\": [{\"delta\": {\"content\": \"!\"}}]}\n\ndata: [DONE]\n\ndata: ignored\n\n",
+			want:        []string{"你", "好", "!"},
+		},
+		"chunked": {
+			contentType: "text/plain",
+			body:        "hello world",
+			want:        []string{"hello world"},
+		},
+		"json": {
+			contentType: "application/json",
+			body:        `{"result": "whole answer"}`,
+			want:        []string{"whole answer"},
+		},
+	}
+	for name, c := range cases {
+		model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", c.contentType)
+			w.Write([]byte(c.body))
+		}))
+		var got []string
+		err := generate(context.Background(), model.URL, "hi", func(text string) error {
+			got = append(got, text)
+			return nil
+		})
+		model.Close()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("%s: 得到 %q，期望 %q", name, got, c.want)
+		}
+	}
+}
+
+func TestRelayChunksKeepsRunesWhole(t *testing.T) {
+	// 每次只读一个字节，多字节字符会被拆开
+	var got []string
+	err := relayChunks(&oneByteReader{s: "你好"}, func(text string) error {
+		got = append(got, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != "你|好" {
+		t.Fatalf("得到 %q", got)
+	}
+}
+
+type oneByteReader struct{ s string }
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	p[0] = r.s[0]
+	r.s = r.s[1:]
+	return 1, nil
+}
+
+func TestInferKeepsModelErrorsApartFromUnreachable(t *testing.T) {
+	generate_status := http.StatusInternalServerError
+	s, _ := fakeServerWithModel(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/generate" {
+			http.Error(w, "model error", generate_status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	ctx := context.Background()
+	if _, err := s.StartInstance(ctx, &pb.StartInstanceRequest{InstanceId: "inst-1", ModelName: "llama3-8b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模型服务返回500说明实例还活着，master不能把它当作不可用
+	_, err := s.Infer(ctx, &pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("模型服务返回500时 Infer 返回 %v", err)
+	}
+	stream := &fakeGenerateStream{}
+	if err := s.InferStream(&pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}, stream); status.Code(err) != codes.Internal {
+		t.Fatalf("模型服务返回500时 InferStream 返回 %v", err)
+	}
+
+	generate_status = http.StatusBadRequest
+	if _, err := s.Infer(ctx, &pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("模型服务返回400时 Infer 返回 %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Infer(cancelled, &pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}); status.Code(err) != codes.Canceled {
+		t.Fatalf("ctx被取消时 Infer 返回 %v", err)
+	}
+}
+
+func TestGenerateErrorUnreachable(t *testing.T) {
+	// 没有服务监听的端口
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	err := generate(context.Background(), closed.URL, "hi", func(string) error { return nil })
+	if err == nil {
+		t.Fatal("连不上模型服务时应该返回错误")
+	}
+	if code := status.Code(generateError(&instance{id: "inst-1"}, err)); code != codes.Unavailable {
+		t.Fatalf("连不上模型服务时返回 %v", code)
+	}
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrGPUBusy 要分配的GPU已经被独占，或者独占实例要的GPU已经有实例在用
+var ErrGPUBusy = errors.New("GPU busy")
+
+// GPULedger 记录本节点每块GPU分给了哪些实例。
+// 独占实例使用的GPU不能再分给任何实例，已经有实例在用的GPU也不能再分给独占实例，
+// 共享实例之间可以共用同一块GPU，显存由master按预留记录控制
+type GPULedger struct {
+	mu      sync.Mutex
+	holders map[string]map[string]bool // GPU -> 实例ID -> 是否独占
+}
+
+// NewGPULedger 创建GPU分配账本
+func NewGPULedger() *GPULedger {
+	return &GPULedger{holders: make(map[string]map[string]bool)}
+}
+
+// Acquire 把一组GPU分配给实例，任何一块GPU冲突时都不分配
+func (l *GPULedger) Acquire(instanceID string, gpuIDs []string, exclusive bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, gpu := range gpuIDs {
+		for holder, holderExclusive := range l.holders[gpu] {
+			if holder == instanceID {
+				continue
+			}
+			if exclusive || holderExclusive {
+				return fmt.Errorf("%w: GPU %s is already held by instance %s", ErrGPUBusy, gpu, holder)
+			}
+		}
+	}
+
+	for _, gpu := range gpuIDs {
+		if l.holders[gpu] == nil {
+			l.holders[gpu] = make(map[string]bool)
+		}
+		l.holders[gpu][instanceID] = exclusive
+	}
+	return nil
+}
+
+// Release 归还实例持有的所有GPU
+func (l *GPULedger) Release(instanceID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for gpu, holders := range l.holders {
+		delete(holders, instanceID)
+		if len(holders) == 0 {
+			delete(l.holders, gpu)
+		}
+	}
+}
+
+// Holders 获取每块GPU上的实例ID，按实例ID排序
+func (l *GPULedger) Holders() map[string][]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make(map[string][]string, len(l.holders))
+	for gpu, holders := range l.holders {
+		for id := range holders {
+			result[gpu] = append(result[gpu], id)
+		}
+		sort.Strings(result[gpu])
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	pb "api/schedule"
+	"catalog"
+	"workerNode/container"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 启动实例之前确认模型镜像已经在本地，不在时先拉取。
+// 这会让这次启动变慢很多，master可以通过PullImage提前拉取
+func (s *server) ensureImage(ctx context.Context, model_name string) error {
+	config, _ := container.LookupModel(model_name)
+	if config.Image == "" {
+		return nil
+	}
+	images, err := s.rt.Images(ctx)
+	if errors.Is(err, container.ErrNoImageStore) {
+		// 运行时不使用镜像，不需要拉取，也不用通知master
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hasImage(images, config.Image) {
+		return nil
+	}
+
+	log.Printf("镜像 %s 不在本地，开始拉取", config.Image)
+	return s.pullImage(ctx, config.Image, func(p container.PullProgress) {
+		if p.Total > 0 && p.Current == p.Total {
+			log.Printf("拉取镜像 %s: %s %s", config.Image, p.Layer, p.Status)
+		}
+	})
+}
+
+// 本地缓存的镜像中是否有image，同一个镜像的不同写法（例如 nginx 和 docker.io/library/nginx:latest）都算
+func hasImage(images []string, image string) bool {
+	return slices.ContainsFunc(images, func(cached string) bool {
+		return catalog.SameImage(cached, image)
+	})
+}
+
+// 拉取镜像，完成后通知master镜像缓存有变化
+func (s *server) pullImage(ctx context.Context, image string, progress func(container.PullProgress)) error {
+	if err := s.rt.PullImage(ctx, image, progress); err != nil {
+		return fmt.Errorf("pull image %s: %w", image, err)
+	}
+	log.Printf("镜像 %s 拉取完成", image)
+	if s.onImagesChanged != nil {
+		s.onImagesChanged()
+	}
+	return nil
+}
+
+// PullImage 按master的要求预先拉取镜像，拉取过程中持续返回进度
+func (s *server) PullImage(req *pb.PullImageRequest, stream grpc.ServerStreamingServer[pb.PullProgress]) error {
+	image, err := requestedImage(req)
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	err = s.pullImage(stream.Context(), image, func(p container.PullProgress) {
+		if sendErr != nil {
+			return
+		}
+		sendErr = stream.Send(&pb.PullProgress{
+			Image:   image,
+			Layer:   p.Layer,
+			Status:  p.Status,
+			Current: p.Current,
+			Total:   p.Total,
+		})
+	})
+	if errors.Is(err, container.ErrNoImageStore) {
+		return status.Errorf(codes.FailedPrecondition, "%s runtime does not use images", s.rt.Name())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.Send(&pb.PullProgress{Image: image, Status: "done", Done: true})
+}
+
+// 拉取请求指定的镜像，没有指定时使用模型的镜像
+func requestedImage(req *pb.PullImageRequest) (string, error) {
+	if image := req.GetImage(); image != "" {
+		return image, nil
+	}
+	config, exists := container.LookupModel(req.GetModelName())
+	if !exists || config.Image == "" {
+		return "", status.Errorf(codes.NotFound, "model %s has no image", req.GetModelName())
+	}
+	return config.Image, nil
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	pb "api/schedule"
+	"workerNode/container"
+)
+
+func TestProcessMessagePullsMissingImage(t *testing.T) {
+	s, rt := fakeServer(t)
+	changed := 0
+	s.onImagesChanged = func() { changed++ }
+
+	r, err := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{
+		ModelName:  "llama3-8b",
+		InstanceId: "inst-1",
+	})
+	if err != nil || !r.Success {
+		t.Fatalf("ProcessMessage = %v, %v", r, err)
+	}
+	images, _ := rt.Images(context.Background())
+	if !slices.Contains(images, "model:v1") {
+		t.Fatalf("images = %v, want model:v1 pulled before start", images)
+	}
+	if changed != 1 {
+		t.Fatalf("onImagesChanged called %d times, want 1", changed)
+	}
+
+	// 镜像已经在本地时不再拉取
+	r, err = s.ProcessMessage(context.Background(), &pb.ScheduleRequest{
+		ModelName:  "llama3-8b",
+		InstanceId: "inst-1",
+	})
+	if err != nil || !r.Success || changed != 1 {
+		t.Fatalf("second ProcessMessage = %v, %v, changed %d", r, err, changed)
+	}
+}
+
+func TestEnsureImageMatchesNormalizedReferences(t *testing.T) {
+	s, rt := fakeServer(t)
+	changed := 0
+	s.onImagesChanged = func() { changed++ }
+
+	// llama3-8b 的镜像是 model:v1，本地缓存的是它的完整写法
+	rt.PullImage(context.Background(), "docker.io/library/model:v1", func(container.PullProgress) {})
+	if err := s.ensureImage(context.Background(), "llama3-8b"); err != nil {
+		t.Fatal(err)
+	}
+	images, _ := rt.Images(context.Background())
+	if len(images) != 1 || changed != 0 {
+		t.Fatalf("已经缓存的镜像不应该再拉取，镜像 %v，通知 %d 次", images, changed)
+	}
+}
+
+// 不使用镜像的运行时，启动实例时不拉取镜像，也不通知master
+type noImageRuntime struct {
+	*container.FakeRuntime
+}
+
+func (noImageRuntime) Images(ctx context.Context) ([]string, error) {
+	return nil, container.ErrNoImageStore
+}
+
+func (noImageRuntime) PullImage(ctx context.Context, image string, progress func(container.PullProgress)) error {
+	return container.ErrNoImageStore
+}
+
+func TestEnsureImageSkipsRuntimeWithoutImages(t *testing.T) {
+	s, rt := fakeServer(t)
+	s.rt = noImageRuntime{rt}
+	changed := 0
+	s.onImagesChanged = func() { changed++ }
+
+	if err := s.ensureImage(context.Background(), "llama3-8b"); err != nil || changed != 0 {
+		t.Fatalf("ensureImage = %v，通知 %d 次", err, changed)
+	}
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	pb "api/schedule"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 启动实例并等待模型服务就绪，实例已经存在时直接复用。
+// 返回的实例算作正在使用，用完之后要调用release；就绪失败时容器会被清理
+func (s *server) launch(ctx context.Context, id string, req *pb.StartInstanceRequest) (*instance, error) {
+	model_name := req.GetModelName()
+	if inst, exists := s.acquireInstance(id); exists {
+		if inst.modelName != model_name {
+			s.release(inst)
+			return nil, status.Errorf(codes.FailedPrecondition, "instance %s serves model %s, not %s", inst.id, inst.modelName, model_name)
+		}
+		fmt.Printf("复用实例 %s，端口 %s \n", inst.id, inst.hostPort)
+		return inst, nil
+	}
+
+	if s.isDraining() {
+		return nil, status.Error(codes.FailedPrecondition, "node is draining")
+	}
+	inst, err := s.startInstance(ctx, id, req)
+	if err != nil {
+		return nil, startError(err)
+	}
+	// 先登记实例，这样容器在加载过程中退出时端口也能被回收，
+	// 加载期间实例算作正在使用，不会被卸载
+	inst.inFlight = 1
+	s.addInstance(inst)
+
+	// 等待容器加载完毕，等待服务就绪，失败时清理容器
+	if err := s.ready(ctx, inst); err != nil {
+		s.discard(inst)
+		s.release(inst)
+		return nil, readinessStatus(err)
+	}
+	s.mu.Lock()
+	inst.ready = true
+	s.mu.Unlock()
+	return inst, nil
+}
+
+// 把启动实例的错误转换成gRPC状态，资源不够时master可以换一个节点重试
+func startError(err error) error {
+	switch {
+	case errors.Is(err, ErrInsufficientGPUMemory), errors.Is(err, ErrNoFreePort), errors.Is(err, ErrGPUBusy):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// 把等待就绪失败的错误转换成gRPC状态，master根据状态码区分加载超时和容器退出。
+// 容器退出时状态的消息里带着退出码
+func readinessStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrReadyTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, ErrContainerExited):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// 实例的当前信息
+func (s *server) info(inst *instance) *pb.InstanceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := pb.InstanceState_INSTANCE_STATE_STARTING
+	if inst.ready {
+		state = pb.InstanceState_INSTANCE_STATE_READY
+	}
+	return &pb.InstanceInfo{
+		InstanceId: inst.id,
+		ModelName:  inst.modelName,
+		State:      state,
+		Port:       inst.hostPort,
+		GpuIds:     inst.gpuIDs,
+		Rank:       inst.rank,
+		WorldSize:  inst.worldSize,
+		InFlight:   int32(inst.inFlight),
+		LastUsed:   inst.lastUsed.Unix(),
+	}
+}
+
+// StartInstance 启动master指定的实例，直到模型服务就绪才返回
+func (s *server) StartInstance(ctx context.Context, req *pb.StartInstanceRequest) (*pb.InstanceInfo, error) {
+	if req.GetInstanceId() == "" || req.GetModelName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "instance_id and model_name are required")
+	}
+	inst, err := s.launch(ctx, req.GetInstanceId(), req)
+	if err != nil {
+		return nil, err
+	}
+	s.release(inst)
+	return s.info(inst), nil
+}
+
+// StopInstance 停止实例，默认不停止还在处理请求的实例。
+// 停止是master要求的，不再发送卸载通知
+func (s *server) StopInstance(ctx context.Context, req *pb.StopInstanceRequest) (*pb.StopInstanceResponse, error) {
+	s.mu.Lock()
+	inst, exists := s.instances[req.GetInstanceId()]
+	if !exists {
+		s.mu.Unlock()
+		// 实例没有启动，归还它可能已经预留的分布式组端口
+		if s.releaseRendezvousPort(req.GetInstanceId()) {
+			return &pb.StopInstanceResponse{}, nil
+		}
+		return nil, status.Errorf(codes.NotFound, "instance %s not found", req.GetInstanceId())
+	}
+	if inst.inFlight > 0 && !req.GetForce() {
+		s.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "instance %s is serving %d requests", inst.id, inst.inFlight)
+	}
+	delete(s.instances, inst.id)
+	s.mu.Unlock()
+
+	reason := req.GetReason()
+	if reason == "" {
+		reason = EvictStopped
+	}
+	s.teardown(inst, reason)
+	return &pb.StopInstanceResponse{}, nil
+}
+
+// GetInstance 查询实例
+func (s *server) GetInstance(ctx context.Context, req *pb.GetInstanceRequest) (*pb.InstanceInfo, error) {
+	inst, exists := s.lookupInstance(req.GetInstanceId())
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "instance %s not found", req.GetInstanceId())
+	}
+	return s.info(inst), nil
+}
+
+// 本节点上所有实例的ID，包括还在加载的实例
+func (s *server) instanceIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.instances))
+	for id := range s.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ListInstances 列出本节点上的实例，按实例ID排序
+func (s *server) ListInstances(ctx context.Context, req *pb.ListInstancesRequest) (*pb.ListInstancesResponse, error) {
+	s.mu.Lock()
+	insts := make([]*instance, 0, len(s.instances))
+	for _, inst := range s.instances {
+		if req.GetModelName() == "" || inst.modelName == req.GetModelName() {
+			insts = append(insts, inst)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(insts, func(i, j int) bool { return insts[i].id < insts[j].id })
+
+	resp := &pb.ListInstancesResponse{}
+	for _, inst := range insts {
+		resp.Instances = append(resp.Instances, s.info(inst))
+	}
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInstanceLifecycle(t *testing.T) {
+	s, rt := fakeServer(t)
+	ctx := context.Background()
+
+	info, err := s.StartInstance(ctx, &pb.StartInstanceRequest{InstanceId: "inst-1", ModelName: "llama3-8b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != pb.InstanceState_INSTANCE_STATE_READY || info.Port == "" || info.InFlight != 0 {
+		t.Fatalf("启动后的实例 %v", info)
+	}
+
+	// 启动和推理是分开的，同一个实例可以处理多次请求
+	for i := 0; i < 2; i++ {
+		r, err := s.Infer(ctx, &pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"})
+		if err != nil || r.Text != "generated" {
+			t.Fatalf("Infer = %v, %v", r, err)
+		}
+	}
+	stream := &fakeGenerateStream{}
+	if err := s.InferStream(&pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.chunks) != 2 || stream.chunks[0].Port != info.Port || stream.chunks[1].Text != "generated" {
+		t.Fatalf("InferStream 返回 %v", stream.chunks)
+	}
+
+	list, _ := s.ListInstances(ctx, &pb.ListInstancesRequest{ModelName: "llama3-8b"})
+	if len(list.Instances) != 1 || list.Instances[0].InstanceId != "inst-1" {
+		t.Fatalf("ListInstances = %v", list)
+	}
+	if len(rt.Specs()) != 1 {
+		t.Fatalf("只应该启动一个容器，实际 %d 个", len(rt.Specs()))
+	}
+
+	if _, err := s.StopInstance(ctx, &pb.StopInstanceRequest{InstanceId: "inst-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetInstance(ctx, &pb.GetInstanceRequest{InstanceId: "inst-1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("停止后查询实例返回 %v", err)
+	}
+	if _, err := s.Infer(ctx, &pb.InferRequest{InstanceId: "inst-1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("停止后推理返回 %v", err)
+	}
+	if len(rt.Specs()) != 0 || len(s.ports.Owners()) != 0 {
+		t.Fatal("停止后容器和端口应该被回收")
+	}
+}
+
+func TestStopInstanceRefusesBusyInstance(t *testing.T) {
+	s, _ := fakeServer(t)
+	ctx := context.Background()
+	if _, err := s.StartInstance(ctx, &pb.StartInstanceRequest{InstanceId: "inst-1", ModelName: "llama3-8b"}); err != nil {
+		t.Fatal(err)
+	}
+	inst, _ := s.acquireInstance("inst-1")
+
+	if _, err := s.StopInstance(ctx, &pb.StopInstanceRequest{InstanceId: "inst-1"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("停止正在处理请求的实例返回 %v", err)
+	}
+	if _, err := s.StopInstance(ctx, &pb.StopInstanceRequest{InstanceId: "inst-1", Force: true}); err != nil {
+		t.Fatalf("强制停止失败: %v", err)
+	}
+	s.release(inst)
+}
+
+func TestGangMemberDoesNotServePrompts(t *testing.T) {
+	s, _ := fakeServer(t)
+	ctx := context.Background()
+	_, err := s.StartInstance(ctx, &pb.StartInstanceRequest{
+		InstanceId: "inst-1",
+		ModelName:  "llama3-8b",
+		Rank:       1,
+		WorldSize:  2,
+		PeerAddrs:  []string{"10.0.0.1:29500", "10.0.0.2:29500"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := s.GetInstance(ctx, &pb.GetInstanceRequest{InstanceId: "inst-1"})
+	if info.Rank != 1 || info.WorldSize != 2 {
+		t.Fatalf("实例信息 %v，期望 rank 1/2", info)
+	}
+	// 提示词只能发给rank 0
+	if _, err := s.Infer(ctx, &pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("rank 1 推理返回 %v，期望 FailedPrecondition", err)
+	}
+	if err := s.InferStream(&pb.InferRequest{InstanceId: "inst-1", Prompt: "hi"}, &fakeGenerateStream{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("rank 1 流式推理返回 %v，期望 FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	pb "api/schedule"
+	"workerNode/container"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 实例被删除前保存的日志
+const (
+	// 保存最后多少行
+	archiveTailLines = 1000
+	// 每个实例最多保存多少字节
+	archiveMaxBytes = 1 << 20
+	// 保存多久
+	archiveRetention = time.Hour
+	// 读取日志的超时时间
+	archiveTimeout = 5 * time.Second
+)
+
+// 每次发送给master的日志块大小
+const logChunkSize = 32 * 1024
+
+// 已经删除的实例最后的日志，容器删除后还能在一段时间内查看加载失败的原因
+type logArchive struct {
+	mu      sync.Mutex
+	entries map[string]archivedLog
+}
+
+type archivedLog struct {
+	data       []byte
+	archivedAt time.Time
+}
+
+func newLogArchive() *logArchive {
+	return &logArchive{entries: make(map[string]archivedLog)}
+}
+
+func (a *logArchive) put(instance_id string, data []byte, now time.Time) {
+	if len(data) > archiveMaxBytes {
+		data = data[len(data)-archiveMaxBytes:]
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries[instance_id] = archivedLog{data: data, archivedAt: now}
+}
+
+func (a *logArchive) get(instance_id string) ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, exists := a.entries[instance_id]
+	return entry.data, exists
+}
+
+// 删除超过保存时间的日志
+func (a *logArchive) prune(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, entry := range a.entries {
+		if now.Sub(entry.archivedAt) > archiveRetention {
+			delete(a.entries, id)
+		}
+	}
+}
+
+// 删除容器之前保存它最后的日志
+func (s *server) archiveLogs(inst *instance) {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+
+	logs, err := s.rt.Logs(ctx, inst.containerID, container.LogOptions{Tail: archiveTailLines})
+	if err != nil {
+		log.Printf("保存实例 %s 的日志失败: %v", inst.id, err)
+		return
+	}
+	defer logs.Close()
+	data, err := io.ReadAll(logs)
+	if err != nil && len(data) == 0 {
+		log.Printf("保存实例 %s 的日志失败: %v", inst.id, err)
+		return
+	}
+	s.logs.put(inst.id, data, s.now())
+}
+
+// StreamLogs 把实例的日志发送给master，实例已经删除时返回保存的最后日志
+func (s *server) StreamLogs(req *pb.LogsRequest, stream grpc.ServerStreamingServer[pb.LogChunk]) error {
+	var logs io.Reader
+	if inst, exists := s.lookupInstance(req.GetInstanceId()); exists {
+		rc, err := s.rt.Logs(stream.Context(), inst.containerID, container.LogOptions{
+			Follow: req.GetFollow(),
+			Tail:   int(req.GetTail()),
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "read logs of instance %s: %v", inst.id, err)
+		}
+		defer rc.Close()
+		logs = rc
+	} else if data, exists := s.logs.get(req.GetInstanceId()); exists {
+		offset, _ := container.TailOffset(bytes.NewReader(data), int64(len(data)), int(req.GetTail()))
+		logs = bytes.NewReader(data[offset:])
+	} else {
+		return status.Errorf(codes.NotFound, "instance %s not found", req.GetInstanceId())
+	}
+
+	buf := make([]byte, logChunkSize)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.LogChunk{Data: bytes.Clone(buf[:n])}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// master断开连接时正常结束
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return status.Errorf(codes.Internal, "read logs: %v", err)
+		}
+	}
+}
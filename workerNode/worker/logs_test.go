@@ -0,0 +1,57 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 收集发送给master的日志
+type fakeLogStream struct {
+	grpc.ServerStream
+	data []byte
+}
+
+func (f *fakeLogStream) Context() context.Context { return context.Background() }
+
+func (f *fakeLogStream) Send(chunk *pb.LogChunk) error {
+	f.data = append(f.data, chunk.Data...)
+	return nil
+}
+
+func TestStreamLogsKeepsLogsAfterExit(t *testing.T) {
+	s, rt := fakeServer(t)
+	if r, _ := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{ModelName: "llama3-8b", InstanceId: "inst-1"}); !r.Success {
+		t.Fatalf("启动失败: %s", r.Message)
+	}
+	inst, _ := s.lookupInstance("inst-1")
+	rt.WriteLog(inst.containerID, "loading weights\nCUDA out of memory\n")
+
+	stream := &fakeLogStream{}
+	if err := s.StreamLogs(&pb.LogsRequest{InstanceId: "inst-1", Tail: 1}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(stream.data); got != "CUDA out of memory\n" {
+		t.Fatalf("最后一行日志是 %q", got)
+	}
+
+	// 容器退出并被删除后，仍然可以读取保存的日志
+	rt.Exit(inst.containerID, 1)
+	s.reap()
+	stream = &fakeLogStream{}
+	if err := s.StreamLogs(&pb.LogsRequest{InstanceId: "inst-1"}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(stream.data); got != "loading weights\nCUDA out of memory\n" {
+		t.Fatalf("保存的日志是 %q", got)
+	}
+
+	err := s.StreamLogs(&pb.LogsRequest{InstanceId: "inst-2"}, &fakeLogStream{})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("不存在的实例应该返回NotFound，得到 %v", err)
+	}
+}
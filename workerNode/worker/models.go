@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"log"
+
+	"catalog"
+	"workerNode/container"
+)
+
+// 加载配置中指定的模型目录，并在文件变化时重新加载，没有指定时使用内置目录
+func (w *Worker) loadModels() error {
+	if w.config.ModelCatalog == "" {
+		return nil
+	}
+	c, err := catalog.Load(w.config.ModelCatalog)
+	if err != nil {
+		return err
+	}
+	container.SetModels(c)
+	log.Printf("加载模型目录 %s，共 %d 个模型", w.config.ModelCatalog, len(c.Models))
+
+	go catalog.Watch(w.config.ModelCatalog, catalog.DefaultWatchInterval, w.stopChan, container.SetModels)
+	return nil
+}
@@ -0,0 +1,274 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pb "api/schedule"
+	"workerNode/container"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// 控制流断开后重新连接的等待时间，每次失败翻倍，不超过上限
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// 后台拉取镜像的超时时间
+const pullImageTimeout = 30 * time.Minute
+
+// 节点未注册的错误定义
+var (
+	ErrNotRegistered = errors.New("节点未注册")
+)
+
+// 连接master的控制流服务，连接静默时定期ping，master掉线时很快就能发现
+func dialMaster(addr string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                10 * time.Second,
+			Timeout:             5 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+}
+
+// 打开控制流并注册节点，随后立即发送一次心跳
+func (w *Worker) connect() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pb.NewNodeServiceClient(w.conn).Connect(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// 重新注册时带上排空状态和现有的实例，master据此恢复断线之前的状态
+	reg := &pb.RegisterNode{
+		NodeId:     w.config.NodeID,
+		Ip:         w.config.IP,
+		Port:       w.config.Port,
+		ApiVersion: pb.CurrentVersion(),
+	}
+	if srv := w.server(); srv != nil {
+		reg.Draining = srv.isDraining()
+		reg.InstanceIds = srv.instanceIDs()
+		reg.InstancesReported = true
+	}
+	err = stream.Send(&pb.NodeMessage{Payload: &pb.NodeMessage_Register{Register: reg}})
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	w.sendMu.Lock()
+	w.stream = stream
+	w.cancelStream = cancel
+	w.sendMu.Unlock()
+	log.Println("节点注册成功")
+	w.heartbeatNow()
+	return nil
+}
+
+// 关闭当前的控制流
+func (w *Worker) closeStream() {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+	if w.cancelStream != nil {
+		w.cancelStream()
+	}
+	w.stream = nil
+	w.cancelStream = nil
+}
+
+// 通过控制流给master发送一条消息，控制流断开时返回ErrNotRegistered
+func (w *Worker) send(msg *pb.NodeMessage) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+	if w.stream == nil {
+		return ErrNotRegistered
+	}
+	return w.stream.Send(msg)
+}
+
+// 接收master下发的命令，控制流断开后按指数退避重新连接并注册，直到节点停止
+func (w *Worker) serveLink() {
+	defer w.wg.Done()
+	for {
+		err := w.receiveCommands()
+		w.closeStream()
+		select {
+		case <-w.stopChan:
+			return
+		default:
+		}
+		if status.Code(err) == codes.FailedPrecondition {
+			// 接口版本不兼容，需要升级master或者工作节点，在此之前按退避时间继续重试
+			log.Printf("master拒绝了本节点（接口版本 v%s）: %s", pb.FormatVersion(pb.CurrentVersion()), status.Convert(err).Message())
+		} else {
+			log.Printf("与master的控制流断开: %v", err)
+		}
+
+		backoff := reconnectMinBackoff
+		for {
+			select {
+			case <-w.stopChan:
+				return
+			case <-time.After(backoff):
+			}
+			err := w.connect()
+			if err == nil {
+				break
+			}
+			log.Printf("重新注册失败: %v", err)
+			backoff = min(backoff*2, reconnectMaxBackoff)
+		}
+	}
+}
+
+// 从当前的控制流接收命令，每个命令在单独的协程里执行，直到控制流断开
+func (w *Worker) receiveCommands() error {
+	w.sendMu.Lock()
+	stream := w.stream
+	w.sendMu.Unlock()
+	if stream == nil {
+		return ErrNotRegistered
+	}
+	for {
+		cmd, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		go w.handleCommand(cmd)
+	}
+}
+
+// 持续发送心跳
+func (w *Worker) heartbeat() {
+	defer w.wg.Done()
+	// 设置一个定时器，每隔一段时间向ticker.C通道发送信号
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	// 死循环持续监听事件
+	for {
+		select {
+		// ticker发来信号，则发送心跳，控制流断开期间的心跳由重新注册补上
+		case <-ticker.C:
+			w.heartbeatNow()
+			// 接收到停止信号则停止监听
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// 发送一次心跳，心跳中包含节点信息,包括GPU信息和镜像缓存
+func (w *Worker) sendHeartbeat() error {
+	// 查询出节点当前的GPU状况，记下采集的时间
+	sampled_at := time.Now()
+	gpus, err := w.gpuInfo()
+	if err != nil {
+		return fmt.Errorf("获取gpu信息失败:%v", err)
+	}
+	images, reported := w.cachedImages()
+
+	heartbeat := &pb.NodeHeartbeat{
+		Gpus:           make(map[string]*pb.GPUStatus, len(gpus)),
+		Images:         images,
+		ImagesReported: reported,
+		ApiVersion:     pb.CurrentVersion(),
+		SampledAtMs:    sampled_at.UnixMilli(),
+	}
+	for id, gpu := range gpus {
+		heartbeat.Gpus[id] = &pb.GPUStatus{
+			GpuModel:      gpu.GPUModel,
+			TotalMemoryMb: gpu.TotalMemoryMB,
+			FreeMemoryMb:  gpu.FreeMemoryMB,
+		}
+	}
+	return w.send(&pb.NodeMessage{Payload: &pb.NodeMessage_Heartbeat{Heartbeat: heartbeat}})
+}
+
+// 立即发送一次心跳，让master尽快看到节点的变化
+func (w *Worker) heartbeatNow() {
+	if err := w.sendHeartbeat(); err != nil {
+		log.Printf("心跳失败: %v", err)
+	}
+}
+
+// 通知master实例已被卸载，随后立即发送一次心跳，让master马上看到释放出来的显存
+func (w *Worker) reportEviction(instance_id, reason string) {
+	err := w.send(&pb.NodeMessage{Payload: &pb.NodeMessage_InstanceEvent{InstanceEvent: &pb.InstanceEvent{
+		Type:       pb.InstanceEventType_INSTANCE_EVENT_STOPPED,
+		InstanceId: instance_id,
+		Reason:     reason,
+	}}})
+	if err != nil {
+		log.Printf("通知master卸载实例 %s 失败: %v", instance_id, err)
+		return
+	}
+	w.heartbeatNow()
+}
+
+// 执行master下发的命令，把结果发回master
+func (w *Worker) handleCommand(cmd *pb.NodeCommand) {
+	result := &pb.CommandResult{CommandId: cmd.GetCommandId()}
+	if err := w.execute(cmd); err != nil {
+		log.Printf("执行命令 %s 失败: %v", cmd.GetCommandId(), err)
+		result.Error = err.Error()
+	}
+	if err := w.send(&pb.NodeMessage{Payload: &pb.NodeMessage_CommandResult{CommandResult: result}}); err != nil {
+		log.Printf("返回命令 %s 的结果失败: %v", cmd.GetCommandId(), err)
+	}
+}
+
+// 执行一条命令，返回的错误会发回master
+func (w *Worker) execute(cmd *pb.NodeCommand) error {
+	srv := w.server()
+	if srv == nil {
+		return errors.New("调度服务器还没有启动")
+	}
+
+	switch c := cmd.GetCommand().(type) {
+	case *pb.NodeCommand_StopInstance:
+		if _, err := srv.StopInstance(context.Background(), c.StopInstance); err != nil {
+			return err
+		}
+		// 停止是master要求的，不发卸载通知，但要让master看到释放出来的显存
+		w.heartbeatNow()
+		return nil
+
+	case *pb.NodeCommand_Drain:
+		srv.drain()
+		return nil
+
+	case *pb.NodeCommand_PullImage:
+		image, err := requestedImage(c.PullImage)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), pullImageTimeout)
+		defer cancel()
+		return srv.pullImage(ctx, image, func(p container.PullProgress) {})
+
+	default:
+		return fmt.Errorf("unknown command %T", c)
+	}
+}
+
+// 获取调度服务器
+func (w *Worker) server() *server {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.srv
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// 默认分配给模型容器的主机端口范围
+const (
+	DefaultPortRangeStart = 31000
+	DefaultPortRangeEnd   = 31999
+)
+
+var ErrNoFreePort = errors.New("没有可用的主机端口")
+
+// PortAllocator 为模型容器分配主机端口，记录每个端口属于哪个实例。
+// 分配时会实际监听一次端口，确认端口没有被其他进程（包括重启前遗留的容器）占用，
+// 所以工作节点重启后，旧容器仍然占着的端口会被跳过，旧容器退出后端口自然回收
+type PortAllocator struct {
+	mu     sync.Mutex
+	start  int
+	end    int
+	next   int
+	owners map[int]string // 端口 -> 实例ID
+	// 检查端口是否空闲，测试时可以替换
+	isFree func(port int) bool
+}
+
+// NewPortAllocator 创建端口分配器，端口范围是 [start, end]
+func NewPortAllocator(start, end int) (*PortAllocator, error) {
+	if start <= 0 || end > 65535 || start > end {
+		return nil, fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+	return &PortAllocator{
+		start:  start,
+		end:    end,
+		next:   start,
+		owners: make(map[int]string),
+		isFree: portFree,
+	}, nil
+}
+
+// 在所有网卡上监听一次端口，能监听说明端口空闲
+func portFree(port int) bool {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	lis.Close()
+	return true
+}
+
+// Allocate 为实例分配一个空闲端口，从上次分配的位置开始轮询，避免刚释放的端口马上被复用
+func (a *PortAllocator) Allocate(owner string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	size := a.end - a.start + 1
+	for i := 0; i < size; i++ {
+		port := a.next
+		a.next++
+		if a.next > a.end {
+			a.next = a.start
+		}
+		if _, used := a.owners[port]; used {
+			continue
+		}
+		if !a.isFree(port) {
+			continue
+		}
+		a.owners[port] = owner
+		return port, nil
+	}
+	return 0, fmt.Errorf("%w: %d-%d", ErrNoFreePort, a.start, a.end)
+}
+
+// Claim 登记一个已经被实例占用的端口，用于接管重启前启动的容器
+func (a *PortAllocator) Claim(port int, owner string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if current, used := a.owners[port]; used && current != owner {
+		return fmt.Errorf("port %d already held by %s", port, current)
+	}
+	a.owners[port] = owner
+	return nil
+}
+
+// Release 归还端口
+func (a *PortAllocator) Release(port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.owners, port)
+}
+
+// Owners 获取所有已分配端口及其所属实例
+func (a *PortAllocator) Owners() map[int]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	owners := make(map[int]string, len(a.owners))
+	for port, owner := range a.owners {
+		owners[port] = owner
+	}
+	return owners
+}
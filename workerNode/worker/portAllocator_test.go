@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	pb "api/schedule"
+)
+
+func TestPortAllocator(t *testing.T) {
+	type step struct {
+		op    string // allocate、claim或者release
+		owner string
+		port  int
+		// allocate期望分配到的端口，0表示期望没有可用端口
+		want int
+		// claim期望失败
+		conflict bool
+	}
+	cases := map[string]struct {
+		busy  map[int]bool // 被其他进程占用的端口
+		steps []step
+	}{
+		"wraps around the range": {
+			steps: []step{
+				{op: "allocate", owner: "a", want: 31000},
+				{op: "allocate", owner: "b", want: 31001},
+				{op: "allocate", owner: "c", want: 31002},
+				{op: "allocate", owner: "d", want: 0},
+				// 归还后从范围开头重新轮询
+				{op: "release", port: 31001},
+				{op: "allocate", owner: "d", want: 31001},
+			},
+		},
+		"does not reuse a released port right away": {
+			steps: []step{
+				{op: "allocate", owner: "a", want: 31000},
+				{op: "release", port: 31000},
+				{op: "allocate", owner: "b", want: 31001},
+				{op: "allocate", owner: "c", want: 31002},
+				{op: "allocate", owner: "d", want: 31000},
+			},
+		},
+		"skips ports busy outside the allocator": {
+			busy: map[int]bool{31000: true, 31002: true},
+			steps: []step{
+				{op: "allocate", owner: "a", want: 31001},
+				{op: "allocate", owner: "b", want: 0},
+			},
+		},
+		"claim conflicts with another owner": {
+			steps: []step{
+				{op: "claim", owner: "a", port: 31001},
+				// 同一个实例重复登记没有问题
+				{op: "claim", owner: "a", port: 31001},
+				{op: "claim", owner: "b", port: 31001, conflict: true},
+				{op: "allocate", owner: "c", want: 31000},
+				{op: "allocate", owner: "d", want: 31002},
+				{op: "release", port: 31001},
+				{op: "claim", owner: "b", port: 31001},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		a, err := NewPortAllocator(31000, 31002)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.isFree = func(port int) bool { return !c.busy[port] }
+
+		for i, s := range c.steps {
+			switch s.op {
+			case "allocate":
+				port, err := a.Allocate(s.owner)
+				if s.want == 0 {
+					if !errors.Is(err, ErrNoFreePort) {
+						t.Errorf("%s 第%d步: 期望没有可用端口，得到 %d, %v", name, i, port, err)
+					}
+					continue
+				}
+				if err != nil || port != s.want {
+					t.Errorf("%s 第%d步: 分配到 %d, %v，期望 %d", name, i, port, err, s.want)
+				}
+			case "claim":
+				if err := a.Claim(s.port, s.owner); (err != nil) != s.conflict {
+					t.Errorf("%s 第%d步: Claim(%d, %s) = %v", name, i, s.port, s.owner, err)
+				}
+			case "release":
+				a.Release(s.port)
+			}
+		}
+	}
+}
+
+func TestNewPortAllocatorRejectsInvalidRange(t *testing.T) {
+	for _, r := range [][2]int{{0, 10}, {31001, 31000}, {65000, 65536}} {
+		if _, err := NewPortAllocator(r[0], r[1]); err == nil {
+			t.Errorf("端口范围 %d-%d 应该不合法", r[0], r[1])
+		}
+	}
+}
+
+// 实例的容器退出后端口被回收，工作节点重启后接管的容器重新登记端口
+func TestPortsReclaimedAfterExitAndRestart(t *testing.T) {
+	s, rt := fakeServer(t)
+	ctx := context.Background()
+
+	// 端口池里只有一个端口
+	if _, err := s.StartInstance(ctx, &pb.StartInstanceRequest{InstanceId: "inst-1", ModelName: "llama3-8b"}); err != nil {
+		t.Fatal(err)
+	}
+	inst, _ := s.lookupInstance("inst-1")
+	rt.Exit(inst.containerID, 1)
+	s.reap()
+	if owners := s.ports.Owners(); len(owners) != 0 {
+		t.Fatalf("容器退出后端口没有归还: %v", owners)
+	}
+
+	info, err := s.StartInstance(ctx, &pb.StartInstanceRequest{InstanceId: "inst-2", ModelName: "llama3-8b"})
+	if err != nil {
+		t.Fatalf("归还的端口应该可以再分配: %v", err)
+	}
+
+	// 工作节点重启，新的端口分配器从对账中接管inst-2的端口
+	port, _ := strconv.Atoi(info.Port)
+	ports, _ := NewPortAllocator(port, port)
+	ports.isFree = func(int) bool { return true }
+	restarted := newServer(rt, ports)
+	restarted.probe = func(host_port, path string) bool { return true }
+	if err := restarted.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if owners := ports.Owners(); owners[port] != "inst-2" {
+		t.Fatalf("重启后端口登记为 %v，期望属于 inst-2", owners)
+	}
+	if _, err := ports.Allocate("inst-3"); !errors.Is(err, ErrNoFreePort) {
+		t.Fatalf("接管的端口不应该再分配出去: %v", err)
+	}
+}
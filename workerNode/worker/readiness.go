@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"workerNode/container"
+)
+
+// 模型没有配置探测间隔时，探测容器健康检查接口的间隔
+const readyRetryInterval = 2 * time.Second
+
+var (
+	// ErrReadyTimeout 模型服务在就绪超时时间内没有就绪
+	ErrReadyTimeout = errors.New("model server not ready before timeout")
+	// ErrContainerExited 容器在加载模型的过程中退出了
+	ErrContainerExited = errors.New("container exited while loading")
+)
+
+// ReadinessError 等待实例就绪失败，Err是ErrReadyTimeout、ErrContainerExited或者ctx被取消的错误
+type ReadinessError struct {
+	InstanceID string
+	ModelName  string
+	// 容器退出时的退出码
+	ExitCode int
+	Err      error
+}
+
+func (e *ReadinessError) Error() string {
+	if errors.Is(e.Err, ErrContainerExited) {
+		return fmt.Sprintf("instance %s (%s): %v with code %d", e.InstanceID, e.ModelName, e.Err, e.ExitCode)
+	}
+	return fmt.Sprintf("instance %s (%s): %v", e.InstanceID, e.ModelName, e.Err)
+}
+
+func (e *ReadinessError) Unwrap() error {
+	return e.Err
+}
+
+// 探测容器的健康检查接口，直到模型服务就绪。
+// 超过模型的就绪超时时间、ctx被取消或者容器已经退出时返回*ReadinessError
+func (s *server) waitForReady(ctx context.Context, inst *instance) error {
+	config, _ := container.LookupModel(inst.modelName)
+	ctx, cancel := context.WithTimeout(ctx, config.ReadyTimeout())
+	defer cancel()
+	interval := s.readyInterval
+	if config.Probe.Interval > 0 {
+		interval = time.Duration(config.Probe.Interval)
+	}
+
+	fail := func(err error, exitCode int) error {
+		return &ReadinessError{InstanceID: inst.id, ModelName: inst.modelName, ExitCode: exitCode, Err: err}
+	}
+	url_ready := "http://localhost:" + inst.hostPort + config.ProbePath()
+
+	for {
+		// 容器已经退出就没有必要再等了
+		state, err := s.rt.Inspect(ctx, inst.containerID)
+		switch {
+		case errors.Is(err, container.ErrNotFound):
+			return fail(ErrContainerExited, 0)
+		case err == nil && !state.Running:
+			return fail(ErrContainerExited, state.ExitCode)
+		}
+
+		err = checkHealth(ctx, url_ready)
+		if err == nil {
+			fmt.Printf("容器已经就绪，可以开始访问\n")
+			return nil
+		}
+		fmt.Printf("容器还没有就绪: %v，将在 %v 后重试\n", err, interval)
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fail(ErrReadyTimeout, 0)
+			}
+			return fail(ctx.Err(), 0)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 请求一次健康检查接口，返回200并且响应体是合法的JSON时认为服务已经就绪
+func checkHealth(ctx context.Context, url_ready string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url_ready, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+
+	// 定义一个 HealthResponse 结构体实例用于解析响应体
+	var healthResp struct {
+		Status string `json:"status"`
+		Device string `json:"device"`
+	}
+	return json.Unmarshal(body, &healthResp)
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"workerNode/container"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 模型服务一直在加载，健康检查返回503
+func loadingInstance(t *testing.T, rt *container.FakeRuntime) *instance {
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(model.Close)
+	u, _ := url.Parse(model.URL)
+
+	id, _ := rt.Create(context.Background(), container.Spec{Name: "loading"})
+	rt.Start(context.Background(), id)
+	return &instance{id: "inst-1", modelName: "llama3-8b", containerID: id, hostPort: u.Port()}
+}
+
+func TestWaitForReadyDetectsExitedContainer(t *testing.T) {
+	s, rt := fakeServer(t)
+	inst := loadingInstance(t, rt)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rt.Exit(inst.containerID, 137)
+	}()
+	err := s.waitForReady(context.Background(), inst)
+
+	var readyErr *ReadinessError
+	if !errors.As(err, &readyErr) || !errors.Is(err, ErrContainerExited) || readyErr.ExitCode != 137 {
+		t.Fatalf("期望容器退出的错误，得到 %v", err)
+	}
+}
+
+func TestWaitForReadyHonoursContextDeadline(t *testing.T) {
+	s, rt := fakeServer(t)
+	inst := loadingInstance(t, rt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := s.waitForReady(ctx, inst)
+
+	if !errors.Is(err, ErrReadyTimeout) {
+		t.Fatalf("期望就绪超时的错误，得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("ctx取消后 %v 才返回", elapsed)
+	}
+}
+
+func TestProcessMessageCleansUpUnreadyInstance(t *testing.T) {
+	s, rt := fakeServer(t)
+	s.ready = func(ctx context.Context, inst *instance) error {
+		return &ReadinessError{InstanceID: inst.id, Err: ErrContainerExited}
+	}
+
+	r, err := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{ModelName: "llama3-8b", InstanceId: "inst-1"})
+	if err != nil || r.Success {
+		t.Fatalf("没有就绪的实例应该返回失败: %v %v", err, r)
+	}
+	if _, ok := s.lookupInstance("inst-1"); ok {
+		t.Fatal("没有就绪的实例应该从登记表中移除")
+	}
+	if specs := rt.Specs(); len(specs) != 0 {
+		t.Fatalf("没有就绪的容器应该被删除，还剩 %v", specs)
+	}
+	if owners := s.ports.Owners(); len(owners) != 0 {
+		t.Fatalf("端口没有归还: %v", owners)
+	}
+}
+
+func TestStartInstanceReportsReadinessFailures(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		"timeout": {err: ErrReadyTimeout, code: codes.DeadlineExceeded},
+		"exited":  {err: ErrContainerExited, code: codes.Aborted, msg: "with code 137"},
+	}
+	for name, c := range cases {
+		s, _ := fakeServer(t)
+		s.ready = func(ctx context.Context, inst *instance) error {
+			return &ReadinessError{InstanceID: inst.id, ModelName: inst.modelName, ExitCode: 137, Err: c.err}
+		}
+		_, err := s.StartInstance(context.Background(), &pb.StartInstanceRequest{InstanceId: "inst-1", ModelName: "llama3-8b"})
+		if status.Code(err) != c.code || !strings.Contains(status.Convert(err).Message(), c.msg) {
+			t.Errorf("%s: 得到 %v，期望状态码 %v", name, err, c.code)
+		}
+	}
+}
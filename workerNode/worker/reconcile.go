@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"workerNode/container"
+)
+
+// 探测已有容器健康检查接口的超时时间
+const probeTimeout = 2 * time.Second
+
+// 节点启动时对账：接管上次运行时启动的、仍然健康的容器，删除其余带标签的容器。
+// 这样工作节点重启后，旧容器的端口被重新登记，已经退出或不可用的容器也不会遗留下来
+func (s *server) reconcile() error {
+	containers, err := container.ListManagedContainers(s.rt)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if reason := s.adopt(c); reason != "" {
+			log.Printf("删除遗留容器 %s（%s）: %s", c.Name, c.ID, reason)
+			if err := s.rt.Remove(context.Background(), c.ID); err != nil {
+				log.Printf("删除容器 %s 失败: %v", c.Name, err)
+			}
+			continue
+		}
+		log.Printf("接管容器 %s，实例 %s，模型 %s，端口 %s", c.Name, c.InstanceID, c.ModelName, c.HostPort)
+	}
+	return nil
+}
+
+// 尝试把容器登记为本节点的实例，不能接管时返回原因
+func (s *server) adopt(c container.ManagedContainer) string {
+	if !c.Running {
+		return "容器没有运行"
+	}
+	if c.InstanceID == "" || c.ModelName == "" {
+		return "缺少实例标签"
+	}
+	if _, exists := s.lookupInstance(c.InstanceID); exists {
+		return "实例ID重复"
+	}
+	port, err := strconv.Atoi(c.HostPort)
+	if err != nil {
+		return "端口标签无效"
+	}
+	config, _ := container.LookupModel(c.ModelName)
+	if !s.probe(c.HostPort, config.ProbePath()) {
+		return "健康检查失败"
+	}
+	if err := s.ports.Claim(port, c.InstanceID); err != nil {
+		return err.Error()
+	}
+	rendezvous_port := 0
+	if c.RendezvousPort != "" {
+		if rendezvous_port, err = strconv.Atoi(c.RendezvousPort); err != nil {
+			s.ports.Release(port)
+			return "分布式组端口标签无效"
+		}
+		if err := s.ports.Claim(rendezvous_port, c.InstanceID); err != nil {
+			s.ports.Release(port)
+			return err.Error()
+		}
+	}
+	if err := s.gpus.Acquire(c.InstanceID, c.GPUIDs, c.Exclusive); err != nil {
+		s.ports.Release(port)
+		if rendezvous_port != 0 {
+			s.ports.Release(rendezvous_port)
+		}
+		return err.Error()
+	}
+
+	s.addInstance(&instance{
+		id:             c.InstanceID,
+		modelName:      c.ModelName,
+		containerID:    c.ID,
+		hostPort:       c.HostPort,
+		rendezvousPort: c.RendezvousPort,
+		gpuIDs:         c.GPUIDs,
+		rank:           c.Rank,
+		worldSize:      c.WorldSize,
+		// 能通过健康检查的容器才会被接管
+		ready: true,
+	})
+	return ""
+}
+
+// 请求一次容器的健康检查接口
+func probeHealth(host_port, path string) bool {
+	client := &http.Client{Timeout: probeTimeout}
+	resp, err := client.Get("http://localhost:" + host_port + path)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"workerNode/container"
+)
+
+// 在假运行时中放一个带标签的容器，返回容器ID
+func addManagedContainer(rt *container.FakeRuntime, instance_id, host_port string, running bool) string {
+	labels := map[string]string{
+		container.LabelOwner:    container.OwnerValue,
+		container.LabelModel:    "llama3-8b",
+		container.LabelInstance: instance_id,
+		container.LabelHostPort: host_port,
+	}
+	id, _ := rt.Create(context.Background(), container.Spec{Name: "c-" + host_port, Labels: labels})
+	if running {
+		rt.Start(context.Background(), id)
+	}
+	return id
+}
+
+func TestReconcileAdoptsHealthyAndRemovesOrphans(t *testing.T) {
+	ports, _ := NewPortAllocator(31000, 31009)
+	ports.isFree = func(int) bool { return true }
+	rt := container.NewFakeRuntime()
+	s := newServer(rt, ports)
+
+	healthy := addManagedContainer(rt, "inst-1", "31000", true)
+	addManagedContainer(rt, "inst-2", "31001", false) // 已经退出
+	addManagedContainer(rt, "inst-3", "31002", true)  // 健康检查失败
+	addManagedContainer(rt, "", "31003", true)        // 缺少实例标签
+	// 不属于light_scheduler的容器不受影响
+	rt.Create(context.Background(), container.Spec{Name: "other"})
+	// 只有31000上的容器能通过健康检查
+	s.probe = func(host_port, path string) bool { return host_port == "31000" }
+
+	if err := s.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inst, ok := s.lookupInstance("inst-1"); !ok || inst.containerID != healthy {
+		t.Fatalf("健康的容器没有被接管: %v", inst)
+	}
+	if owners := ports.Owners(); len(owners) != 1 || owners[31000] != "inst-1" {
+		t.Fatalf("接管的端口登记错误: %v", owners)
+	}
+	specs := rt.Specs()
+	if len(specs) != 2 || specs[0].Name != "c-31000" || specs[1].Name != "other" {
+		t.Fatalf("剩下的容器是 %v，期望只剩接管的容器和无关的容器", specs)
+	}
+
+	// 接管之后新分配的端口要跳过31000
+	if port, _ := ports.Allocate("inst-5"); port == 31000 {
+		t.Fatal("接管的端口被重复分配")
+	}
+}
+
+// 工作节点重启后接管的组调度成员保留rank和成员数，不会被当成单节点实例空闲卸载或者处理提示词
+func TestReconcileRestoresGangMember(t *testing.T) {
+	ports, _ := NewPortAllocator(31000, 31009)
+	ports.isFree = func(int) bool { return true }
+	rt := container.NewFakeRuntime()
+	_, err := container.StartModelContainer(context.Background(), rt, "llama3-8b", container.StartOptions{
+		HostPort:       "31000",
+		RendezvousPort: "31001",
+		InstanceID:     "inst-1",
+		Rank:           1,
+		WorldSize:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(rt, ports)
+	s.probe = func(host_port, path string) bool { return true }
+	if err := s.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	inst, ok := s.lookupInstance("inst-1")
+	if !ok {
+		t.Fatal("组调度成员没有被接管")
+	}
+	if inst.rank != 1 || inst.worldSize != 2 || inst.rendezvousPort != "31001" {
+		t.Fatalf("接管的实例 rank=%d world_size=%d rendezvous=%q", inst.rank, inst.worldSize, inst.rendezvousPort)
+	}
+	if inst.evictable() {
+		t.Error("组调度成员不应该被空闲卸载")
+	}
+	if owners := ports.Owners(); len(owners) != 2 {
+		t.Fatalf("服务端口和分布式组端口都要登记: %v", owners)
+	}
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 预留的分布式组端口在这段时间内没有被实例使用时自动归还，
+// master在预留之后马上启动实例，超时说明master放弃了这次启动
+const rendezvousReserveTimeout = time.Minute
+
+// ReserveRendezvousPort 从端口池中为组调度的成员预留分布式组使用的端口。
+// 成员的地址要在启动之前告诉所有成员，所以端口不能等到启动实例时再分配。
+// 同一个实例重复预留时返回同一个端口
+func (s *server) ReserveRendezvousPort(ctx context.Context, req *pb.ReserveRendezvousPortRequest) (*pb.ReserveRendezvousPortResponse, error) {
+	id := req.GetInstanceId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "instance_id is required")
+	}
+	if s.isDraining() {
+		return nil, status.Error(codes.FailedPrecondition, "node is draining")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port, exists := s.rendezvous[id]; exists {
+		return &pb.ReserveRendezvousPortResponse{Port: strconv.Itoa(port)}, nil
+	}
+	if _, exists := s.instances[id]; exists {
+		return nil, status.Errorf(codes.AlreadyExists, "instance %s already started", id)
+	}
+	port, err := s.ports.Allocate(id)
+	if err != nil {
+		return nil, startError(err)
+	}
+	s.rendezvous[id] = port
+	time.AfterFunc(rendezvousReserveTimeout, func() {
+		s.mu.Lock()
+		expired := s.rendezvous[id] == port
+		if expired {
+			delete(s.rendezvous, id)
+		}
+		s.mu.Unlock()
+		if expired {
+			s.ports.Release(port)
+		}
+	})
+	return &pb.ReserveRendezvousPortResponse{Port: strconv.Itoa(port)}, nil
+}
+
+// 取出实例预留的分布式组端口，之后由实例负责归还。
+// rank 0 是分布式组的主地址，必须有预留的端口，其他成员没有预留时不映射端口
+func (s *server) takeRendezvousPort(id string, req *pb.StartInstanceRequest) (string, error) {
+	if req.GetWorldSize() <= 1 {
+		return "", nil
+	}
+	s.mu.Lock()
+	port, exists := s.rendezvous[id]
+	delete(s.rendezvous, id)
+	s.mu.Unlock()
+	if !exists {
+		if req.GetRank() == 0 {
+			return "", status.Errorf(codes.FailedPrecondition, "no rendezvous port reserved for instance %s", id)
+		}
+		return "", nil
+	}
+	return strconv.Itoa(port), nil
+}
+
+// 归还还没有被实例使用的预留端口，没有预留时返回false
+func (s *server) releaseRendezvousPort(id string) bool {
+	s.mu.Lock()
+	port, exists := s.rendezvous[id]
+	delete(s.rendezvous, id)
+	s.mu.Unlock()
+	if exists {
+		s.ports.Release(port)
+	}
+	return exists
+}
@@ -1,20 +1,20 @@
 package worker
 
 import (
-	"bytes"
+	pb "api/schedule"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
-	pb "workerNode/schedule"
 
 	"workerNode/container"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
 // 开启调度服务器
@@ -24,8 +24,35 @@ func (worker *Worker) StartScheduler(port string) {
 		log.Fatalf("工作节点调度服务器failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterScheduleServiceServer(s, &server{})
+	if err := worker.loadModels(); err != nil {
+		log.Fatalf("加载模型目录失败: %v", err)
+	}
+	ports, err := NewPortAllocator(worker.config.PortRangeStart, worker.config.PortRangeEnd)
+	if err != nil {
+		log.Fatalf("端口范围配置错误: %v", err)
+	}
+	rt, err := worker.runtime()
+	if err != nil {
+		log.Fatalf("创建容器运行时失败: %v", err)
+	}
+	log.Printf("使用容器运行时: %s", rt.Name())
+	srv := newServer(rt, ports)
+	srv.onEvict = func(instance_id, reason string) {
+		go worker.reportEviction(instance_id, reason)
+	}
+	srv.onImagesChanged = func() {
+		go worker.heartbeatNow()
+	}
+	if err := srv.reconcile(); err != nil {
+		log.Printf("启动时对账容器失败: %v", err)
+	}
+	go srv.reapLoop(worker.stopChan, reapInterval)
+	worker.mu.Lock()
+	worker.srv = srv
+	worker.mu.Unlock()
+
+	s := grpc.NewServer(worker.serverOptions()...)
+	pb.RegisterScheduleServiceServer(s, srv)
 
 	log.Println("调度Server started on port " + port)
 	if err := s.Serve(lis); err != nil {
@@ -33,138 +60,308 @@ func (worker *Worker) StartScheduler(port string) {
 	}
 }
 
+// 检查实例容器是否已经退出、是否空闲超时的间隔
+const reapInterval = 30 * time.Second
+
 type server struct {
 	pb.UnimplementedScheduleServiceServer
+	// 本节点上已经启动的模型实例，key是实例ID
+	mu        sync.Mutex
+	instances map[string]*instance
+	// 用于生成本地实例ID
+	nextLocal uint64
+	// 模型容器的主机端口池和GPU分配账本
+	ports *PortAllocator
+	gpus  *GPULedger
+	// 组调度成员预留的分布式组端口，key是实例ID，启动实例时取出
+	rendezvous map[string]int
+	// 已经删除的实例最后的日志
+	logs *logArchive
+	// 把GPU的UUID转换成编号，同一块GPU在账本里只有一个名字
+	resolveGPU func(gpu_id string) string
+	// 运行模型实例的容器运行时，测试时使用container.FakeRuntime
+	rt container.Runtime
+	// 等待容器就绪和探测容器健康，测试时可以换成假的实现
+	ready         func(ctx context.Context, inst *instance) error
+	readyInterval time.Duration
+	probe         func(host_port, path string) bool
+	// 本节点每张GPU的空闲显存（key是GPU编号）和当前时间，测试时可以换成假的实现
+	freeMemory func() (map[string]uint64, error)
+	now        func() time.Time
+	// 实例被卸载后和拉取了新镜像后的回调，用于通知master
+	onEvict         func(instance_id, reason string)
+	onImagesChanged func()
+	// 节点正在排空，不再启动新实例，空闲的实例都会被停止
+	draining bool
 }
 
-func (s *server) ProcessMessage(ctx context.Context, req *pb.ScheduleRequest) (*pb.ScheduleResponse, error) {
-
-	// 获取请求中的模型名和提示词
-	model_name := req.GetModelName()
-	origin_prompt := req.GetOriginPrompt()
-	fmt.Printf("模型名是: %s，原生提示词是: %s \n", model_name, origin_prompt)
+func newServer(rt container.Runtime, ports *PortAllocator) *server {
+	s := &server{
+		instances:     make(map[string]*instance),
+		rendezvous:    make(map[string]int),
+		rt:            rt,
+		ports:         ports,
+		gpus:          NewGPULedger(),
+		logs:          newLogArchive(),
+		readyInterval: readyRetryInterval,
+		probe:         probeHealth,
+		now:           time.Now,
+	}
+	s.ready = s.waitForReady
+	s.resolveGPU = s.gpuIndex
+	s.freeMemory = s.freeMemoryMB
+	return s
+}
 
-	// 启动容器
-	host_port, err := StartContainerInstance(model_name)
+// 通过容器运行时把GPU的UUID转换成编号，已经是编号或者无法查询时原样返回
+func (s *server) gpuIndex(gpu_id string) string {
+	gpus, err := s.rt.GPUs(context.Background())
 	if err != nil {
-		// 构造失败响应
-		success := false
-		message := err.Error()
-		port := host_port
+		return gpu_id
+	}
+	return container.GPUIndex(gpus, gpu_id)
+}
 
-		return &pb.ScheduleResponse{
-			Success: success,
-			Port:    port,
-			Message: message,
-		}, nil
+// 本节点上的一个模型实例
+type instance struct {
+	id          string
+	modelName   string
+	containerID string
+	hostPort    string
+	// 组调度成员的分布式组端口，不是组调度的成员时为空
+	rendezvousPort string
+	// 实例使用的GPU编号
+	gpuIDs []string
+	// 组调度实例中的序号和成员数，单节点实例的成员数为0或1
+	rank      int32
+	worldSize int32
+	// 模型服务已经就绪
+	ready bool
+	// 正在处理的请求数和最近使用时间，用于空闲卸载和LRU卸载
+	inFlight int
+	lastUsed time.Time
+}
+
+// 查找已经启动的实例
+func (s *server) lookupInstance(id string) (*instance, bool) {
+	if id == "" {
+		return nil, false
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, exists := s.instances[id]
+	return inst, exists
+}
 
-	// 等待容器加载完毕，等待服务就绪
-	// 定义请求的 URL
-	url_ready := "http://localhost:" + host_port + "/health"
-	// 定义重试间隔时间（这里设置为 2 秒）
-	retryInterval := 2 * time.Second
-	// 持续不断的向探活端口发出请求，直到被响应
+// 登记新启动的实例
+func (s *server) addInstance(inst *instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.lastUsed = s.now()
+	s.instances[inst.id] = inst
+}
+
+// 没有实例ID的请求（旧版本master）使用本地生成的ID，这样端口也能按实例回收，
+// 生成的ID要避开启动时接管的实例
+func (s *server) instanceID(req *pb.ScheduleRequest) string {
+	if id := req.GetInstanceId(); id != "" {
+		return id
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for {
-		// 创建一个新的 HTTP GET 请求
-		resp_ready, err := http.Get(url_ready)
-		if err != nil {
-			fmt.Printf("发送请求出错: %v，将在 %v 后重试\n", err, retryInterval)
-			time.Sleep(retryInterval)
-			continue
+		s.nextLocal++
+		id := fmt.Sprintf("local-%d", s.nextLocal)
+		if _, exists := s.instances[id]; !exists {
+			return id
 		}
-		// 确保在函数返回时关闭响应体
-		defer resp_ready.Body.Close()
+	}
+}
 
-		// 读取响应体的内容
-		body, err := io.ReadAll(resp_ready.Body)
-		if err != nil {
-			fmt.Printf("读取响应体出错: %v，将在 %v 后重试\n", err, retryInterval)
-			time.Sleep(retryInterval)
-			continue
+// 启动实例容器，显存不够时先卸载最久未使用的实例，镜像不在本地时先拉取，
+// 分配GPU和主机端口，启动失败时全部归还
+func (s *server) startInstance(ctx context.Context, id string, req *pb.StartInstanceRequest) (*instance, error) {
+	// 预留的分布式组端口在启动失败时一起归还
+	rendezvous_port, err := s.takeRendezvousPort(id, req)
+	if err != nil {
+		return nil, err
+	}
+	release_rendezvous := func() {
+		if rendezvous_port != "" {
+			port, _ := strconv.Atoi(rendezvous_port)
+			s.ports.Release(port)
 		}
+	}
 
-		// 定义一个 HealthResponse 结构体实例用于解析响应体
-		type HealthResponse struct {
-			Status string `json:"status"`
-			Device string `json:"device"`
-		}
-		var healthResp HealthResponse
-		// 将响应体解析到结构体中
-		err = json.Unmarshal(body, &healthResp)
-		if err != nil {
-			fmt.Printf("解析响应体出错: %v，将在 %v 后重试\n", err, retryInterval)
-			time.Sleep(retryInterval)
-			continue
-		}
-		// 如果走到这都没有问题，说明容器已经就绪
-		fmt.Printf("容器已经就绪，可以开始访问")
-		break
+	gpu_ids := make([]string, 0, len(req.GetGpuIds()))
+	for _, gpu_id := range req.GetGpuIds() {
+		gpu_ids = append(gpu_ids, s.resolveGPU(gpu_id))
 	}
 
-	// 把初始提示词询问容器，返回响应
-	url := "http://localhost:" + host_port
-	data := map[string]string{
-		"prompt": origin_prompt,
+	if err := s.makeRoom(req.GetModelName(), gpu_ids, req.GetWorldSize()); err != nil {
+		release_rendezvous()
+		return nil, err
 	}
-	// 将数据编码为 JSON 格式
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		fmt.Println("JSON 编码出错:", err)
+	if err := s.ensureImage(ctx, req.GetModelName()); err != nil {
+		release_rendezvous()
+		return nil, err
 	}
-	// 创建一个新的 HTTP POST 请求
-	req_infer, err := http.NewRequest("POST", url+"/generate", bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Println("创建请求出错:", err)
-	}
-	// 设置请求头，指定内容类型为 application/json
-	req_infer.Header.Set("Content-Type", "application/json")
-	// 创建一个 HTTP 客户端
-	client := &http.Client{}
-	// 发送请求
-	resp, err := client.Do(req_infer)
+	if err := s.gpus.Acquire(id, gpu_ids, req.GetExclusive()); err != nil {
+		release_rendezvous()
+		return nil, err
+	}
+
+	port, err := s.ports.Allocate(id)
 	if err != nil {
-		fmt.Println("发送请求出错:", err)
+		release_rendezvous()
+		s.gpus.Release(id)
+		return nil, err
 	}
-	// 确保在函数返回时关闭响应体
-	defer resp.Body.Close()
-	// 读取响应体的内容
-	body, err := io.ReadAll(resp.Body)
+	host_port := strconv.Itoa(port)
+
+	containerID, err := container.StartModelContainer(ctx, s.rt, req.GetModelName(), container.StartOptions{
+		Env:            distributedEnv(req),
+		HostPort:       host_port,
+		RendezvousPort: rendezvous_port,
+		Rank:           req.GetRank(),
+		WorldSize:      req.GetWorldSize(),
+		InstanceID:     id,
+		TaskID:         req.GetTaskId(),
+		GPUIDs:         gpu_ids,
+		Exclusive:      req.GetExclusive(),
+	})
 	if err != nil {
-		fmt.Println("读取响应体出错:", err)
+		release_rendezvous()
+		s.ports.Release(port)
+		s.gpus.Release(id)
+		return nil, err
+	}
+	fmt.Printf("请访问端口和模型对话：%s\n", host_port)
+
+	return &instance{
+		id:             id,
+		modelName:      req.GetModelName(),
+		containerID:    containerID,
+		hostPort:       host_port,
+		rendezvousPort: rendezvous_port,
+		gpuIDs:         gpu_ids,
+		rank:           req.GetRank(),
+		worldSize:      req.GetWorldSize(),
+	}, nil
+}
+
+// 定期检查实例容器，直到stop被关闭
+func (s *server) reapLoop(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reap()
+			s.evictIdle()
+			s.logs.prune(s.now())
+		case <-stop:
+			return
+		}
 	}
-	// 定义一个结构体用于解析响应体
-	type Response struct {
-		Result string `json:"result"`
+}
+
+// 移除容器已经退出的实例，回收它们的端口
+func (s *server) reap() {
+	s.mu.Lock()
+	insts := make([]*instance, 0, len(s.instances))
+	for _, inst := range s.instances {
+		insts = append(insts, inst)
 	}
-	var response Response
-	// 将响应体解析到结构体中
-	err = json.Unmarshal(body, &response)
+	s.mu.Unlock()
+
+	for _, inst := range insts {
+		running, err := container.ContainerRunning(s.rt, inst.containerID)
+		if err != nil {
+			log.Printf("检查实例 %s 的容器失败: %v", inst.id, err)
+			continue
+		}
+		if running {
+			continue
+		}
+		s.mu.Lock()
+		_, exists := s.instances[inst.id]
+		delete(s.instances, inst.id)
+		s.mu.Unlock()
+		if exists {
+			s.stopInstance(inst, EvictExited)
+		}
+	}
+}
+
+// ProcessMessage 旧接口：实例不存在时先启动实例，再把提示词发给rank 0的实例，返回完整结果
+func (s *server) ProcessMessage(ctx context.Context, req *pb.ScheduleRequest) (*pb.ScheduleResponse, error) {
+
+	// 获取请求中的模型名和提示词
+	model_name := req.GetModelName()
+	origin_prompt := req.GetOriginPrompt()
+	fmt.Printf("模型名是: %s，原生提示词是: %s \n", model_name, origin_prompt)
+
+	inst, err := s.launch(ctx, s.instanceID(req), &pb.StartInstanceRequest{
+		ModelName: model_name,
+		TaskId:    req.GetTaskId(),
+		Rank:      req.GetRank(),
+		WorldSize: req.GetWorldSize(),
+		PeerAddrs: req.GetPeerAddrs(),
+		GpuIds:    req.GetGpuIds(),
+		Exclusive: req.GetExclusive(),
+	})
 	if err != nil {
-		fmt.Println("解析响应体出错:", err)
+		// 构造失败响应
+		return &pb.ScheduleResponse{
+			Success: false,
+			Message: status.Convert(err).Message(),
+		}, nil
+	}
+	defer s.release(inst)
+	host_port := inst.hostPort
+
+	// 组调度中rank大于0的成员只负责加入分布式组，提示词由rank 0处理
+	if req.GetRank() > 0 {
+		return &pb.ScheduleResponse{
+			Success: true,
+			Port:    host_port,
+			Message: fmt.Sprintf("rank %d/%d joined", req.GetRank(), req.GetWorldSize()),
+		}, nil
 	}
-	generate_result := response.Result
 
-	// 构造成功响应，把响应返回
-	success := true
-	message := generate_result
-	port := host_port
+	// 把初始提示词询问容器，返回响应
+	generate_result, err := s.infer(ctx, inst, origin_prompt)
+	if err != nil {
+		// 复用的实例可能已经退出，返回失败让master重试
+		return &pb.ScheduleResponse{
+			Success: false,
+			Port:    host_port,
+			Message: fmt.Sprintf("instance %s on port %s unreachable: %v", inst.id, host_port, err),
+		}, nil
+	}
 
 	return &pb.ScheduleResponse{
-		Success: success,
-		Port:    port,
-		Message: message,
+		Success: true,
+		Port:    host_port,
+		Message: generate_result,
 	}, nil
-
 }
 
-// 在本节点上启动一个容器推理实例
-func StartContainerInstance(model_name string) (string, error) {
-	host_port, err := container.StartModelContainer(model_name)
-	if err != nil {
-		return "", err
-	} else {
-		fmt.Printf("请访问端口和模型对话：%s", host_port)
+// 跨节点组调度时传给容器的环境变量，容器用它们建立分布式组（torch.distributed 的约定）
+func distributedEnv(req *pb.StartInstanceRequest) map[string]string {
+	if req.GetWorldSize() <= 1 || len(req.GetPeerAddrs()) == 0 {
+		return nil
+	}
+	env := map[string]string{
+		"RANK":       fmt.Sprint(req.GetRank()),
+		"WORLD_SIZE": fmt.Sprint(req.GetWorldSize()),
+		"PEER_ADDRS": strings.Join(req.GetPeerAddrs(), ","),
+	}
+	// rank 0 的地址就是分布式组的主地址
+	if host, port, err := net.SplitHostPort(req.GetPeerAddrs()[0]); err == nil {
+		env["MASTER_ADDR"] = host
+		env["MASTER_PORT"] = port
 	}
-	return host_port, nil
+	return env
 }
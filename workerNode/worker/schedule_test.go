@@ -0,0 +1,212 @@
+package worker
+
+import (
+	pb "api/schedule"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+	"workerNode/container"
+)
+
+// 用httptest代替模型容器里的服务，用假的运行时代替docker
+func fakeServer(t *testing.T) (*server, *container.FakeRuntime) {
+	return fakeServerWithModel(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"result": "generated"})
+	}))
+}
+
+// 使用fake运行时的工作节点，模型服务由handler模拟
+func fakeServerWithModel(t *testing.T, handler http.Handler) (*server, *container.FakeRuntime) {
+	model := httptest.NewServer(handler)
+	t.Cleanup(model.Close)
+	u, _ := url.Parse(model.URL)
+
+	// 端口池里只有httptest监听的端口
+	port, _ := strconv.Atoi(u.Port())
+	ports, _ := NewPortAllocator(port, port)
+	ports.isFree = func(int) bool { return true }
+
+	rt := container.NewFakeRuntime()
+	s := newServer(rt, ports)
+	s.readyInterval = 10 * time.Millisecond
+	s.freeMemory = plentyOfMemory
+	return s, rt
+}
+
+// 每张GPU都有80GB空闲显存
+func plentyOfMemory() (map[string]uint64, error) {
+	return map[string]uint64{"0": 80 * 1024, "1": 80 * 1024, "2": 80 * 1024, "3": 80 * 1024}, nil
+}
+
+func TestProcessMessageGangRanks(t *testing.T) {
+	s, rt := fakeServer(t)
+	peers := []string{"10.0.0.1:29500", "10.0.0.2:29500"}
+
+	// rank 1 只启动容器并加入分布式组，不处理提示词
+	r, err := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{
+		ModelName:  "llama3-8b",
+		InstanceId: "inst-1",
+		Rank:       1,
+		WorldSize:  2,
+		PeerAddrs:  peers,
+	})
+	if err != nil || !r.Success {
+		t.Fatalf("rank 1 启动失败: %v %v", err, r)
+	}
+	if r.Message == "generated" {
+		t.Error("rank 1 不应该处理提示词")
+	}
+
+	env := rt.Specs()[0].Env
+	want := map[string]string{
+		"RANK":        "1",
+		"WORLD_SIZE":  "2",
+		"MASTER_ADDR": "10.0.0.1",
+		"MASTER_PORT": "29500",
+		"PEER_ADDRS":  "10.0.0.1:29500,10.0.0.2:29500",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("环境变量 %s=%q，期望 %q", k, env[k], v)
+		}
+	}
+}
+
+func TestProcessMessageReusesInstance(t *testing.T) {
+	s, rt := fakeServer(t)
+	req := &pb.ScheduleRequest{ModelName: "llama3-8b", OriginPrompt: "hi", InstanceId: "inst-1"}
+
+	for i := 0; i < 2; i++ {
+		r, err := s.ProcessMessage(context.Background(), req)
+		if err != nil || !r.Success || r.Message != "generated" {
+			t.Fatalf("第 %d 次请求失败: %v %v", i+1, err, r)
+		}
+	}
+	specs := rt.Specs()
+	if len(specs) != 1 {
+		t.Fatalf("启动了 %d 个容器，同一个实例应该只启动一次", len(specs))
+	}
+	if rank, ok := specs[0].Env["RANK"]; ok {
+		t.Errorf("单节点实例不需要分布式环境变量，得到 RANK=%s", rank)
+	}
+}
+
+func TestProcessMessageReleasesPortOfExitedInstance(t *testing.T) {
+	s, rt := fakeServer(t)
+
+	if r, _ := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{ModelName: "llama3-8b", InstanceId: "inst-1"}); !r.Success {
+		t.Fatalf("启动失败: %v", r.Message)
+	}
+	// 端口池只有一个端口，第二个实例分配不到端口
+	if r, _ := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{ModelName: "llama3-8b", InstanceId: "inst-2"}); r.Success {
+		t.Fatal("端口已被占用，第二个实例不应该启动成功")
+	}
+
+	// 第一个实例的容器退出后端口被回收
+	inst, _ := s.lookupInstance("inst-1")
+	rt.Exit(inst.containerID, 1)
+	s.reap()
+	if owners := s.ports.Owners(); len(owners) != 0 {
+		t.Fatalf("端口没有回收: %v", owners)
+	}
+
+	if r, _ := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{ModelName: "llama3-8b", InstanceId: "inst-2"}); !r.Success {
+		t.Fatalf("端口回收后启动失败: %v", r.Message)
+	}
+	if specs := rt.Specs(); len(specs) != 1 || specs[0].Name != container.ContainerName("inst-2") {
+		t.Fatalf("退出的容器应该被删除，只剩 inst-2 的容器，得到 %v", specs)
+	}
+}
+
+func TestProcessMessagePinsExclusiveGPUs(t *testing.T) {
+	ports, _ := NewPortAllocator(31000, 31009)
+	ports.isFree = func(int) bool { return true }
+	rt := container.NewFakeRuntime()
+	s := newServer(rt, ports)
+	s.ready = func(ctx context.Context, inst *instance) error { return nil }
+	s.freeMemory = plentyOfMemory
+	s.resolveGPU = func(gpu_id string) string {
+		if gpu_id == "GPU-aaaa" {
+			return "0"
+		}
+		return gpu_id
+	}
+
+	// rank 1 的成员只启动容器，不需要模型服务
+	start := func(instance_id string, exclusive bool, gpus ...string) *pb.ScheduleResponse {
+		r, _ := s.ProcessMessage(context.Background(), &pb.ScheduleRequest{
+			ModelName:  "llama3-8b",
+			InstanceId: instance_id,
+			Rank:       1,
+			WorldSize:  2,
+			GpuIds:     gpus,
+			Exclusive:  exclusive,
+		})
+		return r
+	}
+
+	if r := start("inst-1", true, "GPU-aaaa", "1"); !r.Success {
+		t.Fatalf("启动失败: %s", r.Message)
+	}
+	if gpus := rt.Specs()[0].GPUs; len(gpus) != 2 || gpus[0] != "0" || gpus[1] != "1" {
+		t.Fatalf("容器使用的GPU是 %v，期望 [0 1]", gpus)
+	}
+	// 同一块GPU用UUID和编号表示都算冲突
+	if r := start("inst-2", false, "0"); r.Success {
+		t.Fatal("独占实例的GPU不应该再分给其他实例")
+	}
+	if r := start("inst-3", false, "2"); !r.Success {
+		t.Fatalf("空闲的GPU应该可以分配: %s", r.Message)
+	}
+	if owners := ports.Owners(); len(owners) != 2 {
+		t.Fatalf("分配GPU失败时端口也要归还，当前端口 %v", owners)
+	}
+}
+
+// 组调度的rank 0使用预留的端口作为分布式组的主地址，并把它映射出去
+func TestStartInstancePublishesRendezvousPort(t *testing.T) {
+	ports, _ := NewPortAllocator(31000, 31009)
+	ports.isFree = func(int) bool { return true }
+	rt := container.NewFakeRuntime()
+	s := newServer(rt, ports)
+	s.ready = func(ctx context.Context, inst *instance) error { return nil }
+	s.freeMemory = plentyOfMemory
+
+	req := &pb.StartInstanceRequest{
+		InstanceId: "inst-1",
+		ModelName:  "llama3-8b",
+		Rank:       0,
+		WorldSize:  2,
+	}
+	// 没有预留端口时rank 0不能启动
+	if _, err := s.StartInstance(context.Background(), req); err == nil {
+		t.Fatal("没有预留分布式组端口时rank 0不应该启动")
+	}
+
+	reserved, err := s.ReserveRendezvousPort(context.Background(), &pb.ReserveRendezvousPortRequest{InstanceId: "inst-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PeerAddrs = []string{"10.0.0.1:" + reserved.Port, "10.0.0.2:31005"}
+	if _, err := s.StartInstance(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	spec := rt.Specs()[0]
+	if spec.RendezvousPort != reserved.Port || spec.Env["MASTER_PORT"] != reserved.Port {
+		t.Fatalf("映射的端口 %q，MASTER_PORT=%q，期望 %s", spec.RendezvousPort, spec.Env["MASTER_PORT"], reserved.Port)
+	}
+
+	// 停止实例后服务端口和分布式组端口都被归还
+	if _, err := s.StopInstance(context.Background(), &pb.StopInstanceRequest{InstanceId: "inst-1", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if owners := ports.Owners(); len(owners) != 0 {
+		t.Fatalf("端口没有回收: %v", owners)
+	}
+}